@@ -0,0 +1,168 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+)
+
+// Cards creates a Matcher for payment card numbers: sequences of 13 to 19 digits with a valid
+// Luhn check digit, optionally split into groups by single spaces or dashes, as in
+// "4111 1111 1111 1111" or "4111-1111-1111-1111". When a card number is adjacent to other
+// numbers, as in "paid 4111111111111111 2024", the longest valid grouping is matched.
+func Cards() Matcher {
+	return func(s []byte) (ms [][]int) {
+		for i := 0; i < len(s); {
+			if !isDigit(s[i]) || (i > 0 && (isIdent(s[i-1]) || s[i-1] == '-' || s[i-1] == '.')) {
+				i++
+				continue
+			}
+
+			ms, i = cardNumbers(ms, s, i)
+		}
+
+		return
+	}
+}
+
+// TokenizeCards creates a Rewriter that substitutes all payment card numbers (as matched by
+// Cards()) with format-preserving tokens: the first 6 and the last 4 digits, as well as all
+// the separators, are left intact, while the digits in the middle are replaced with
+// pseudo-random ones derived from the card number and the given secret seed. One of the
+// replaced digits is chosen so that the token passes the Luhn check, hence downstream systems
+// that validate card numbers keep working on the tokenized data. The same seed always
+// produces the same tokens. Note that a token may happen to be a valid card number.
+func TokenizeCards(seed []byte) Rewriter {
+	if len(seed) == 0 {
+		panic("empty seed in trw.TokenizeCards() function")
+	}
+
+	key := append([]byte(nil), seed...)
+
+	return mapMatches(Cards(), func(s []byte) {
+		// digit positions
+		var pos [19]int
+		var digits []byte
+
+		n := 0
+
+		for i, c := range s {
+			if isDigit(c) {
+				pos[n] = i
+				digits = append(digits, c)
+				n++
+			}
+		}
+
+		mac := hmac.New(sha256.New, key)
+
+		mac.Write(digits)
+
+		sum := mac.Sum(nil)
+
+		for k := 6; k < n-4; k++ {
+			digits[k] = '0' + sum[k]%10
+		}
+
+		// fix the last middle digit
+		for k := n - 5; !luhn(digits); {
+			if digits[k]++; digits[k] > '9' {
+				digits[k] = '0'
+			}
+		}
+
+		for k := 6; k < n-4; k++ {
+			s[pos[k]] = digits[k]
+		}
+	})
+}
+
+// cardNumbers scans the run of digit groups starting at s[i], appending all the card numbers
+// found in the run to the given list of matches. Returns the updated list and the end of the run.
+func cardNumbers(ms [][]int, s []byte, i int) ([][]int, int) {
+	// groups[k] is the span of the k-th group of digits, seps[k] is the separator
+	// between the groups k and k+1
+	var groups [][2]int
+	var seps []byte
+
+	for {
+		start := i
+
+		for i < len(s) && isDigit(s[i]) {
+			i++
+		}
+
+		groups = append(groups, [2]int{start, i})
+
+		if i+1 >= len(s) || (s[i] != ' ' && s[i] != '-') || !isDigit(s[i+1]) {
+			break
+		}
+
+		seps = append(seps, s[i])
+		i++
+	}
+
+	n := len(groups)
+
+	// the last group is glued to an identifier
+	if i < len(s) && isIdent(s[i]) {
+		n--
+	}
+
+	digits := make([]byte, 0, 19)
+
+	for g := 0; g < n; g++ {
+		// a card number cannot start after a dash
+		if g > 0 && seps[g-1] != ' ' {
+			continue
+		}
+
+		// the longest valid grouping starting at g
+		end := -1
+		digits = digits[:0]
+
+		for h := g; h < n && (h == g || seps[h-1] == seps[g]); h++ {
+			if digits = append(digits, s[groups[h][0]:groups[h][1]]...); len(digits) > 19 {
+				break
+			}
+
+			if len(digits) >= 13 && (h+1 == len(groups) || seps[h] == ' ') && luhn(digits) {
+				end = h
+			}
+		}
+
+		if end >= 0 {
+			ms = append(ms, []int{groups[g][0], groups[end][1]})
+			g = end
+		}
+	}
+
+	return ms, i
+}
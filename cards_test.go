@@ -0,0 +1,98 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCards(t *testing.T) {
+	cases := []struct {
+		src, exp string
+	}{
+		{"visa 4111111111111111, amex 3782-822463-10005.", "visa <>, amex <>."},
+		{"4111 1111 1111 1111 and 5500 0000 0000 0004", "<> and <>"},
+		{"4111111111111112 4111-1111 1111-1111 x4111111111111111 411111111111", "4111111111111112 4111-1111 1111-1111 x4111111111111111 411111111111"},
+		{"order 1234, total 99", "order 1234, total 99"},
+		{"paid 4111111111111111 2024", "paid <> 2024"},
+		{"card 4111 1111 1111 1111 12/25", "card <> 12/25"},
+		{"qty 3 4111111111111111", "qty 3 <>"},
+		{"qty 3 4111-1111-1111-1111", "qty 3 <>"},
+	}
+
+	for i, c := range cases {
+		if res := Replace(Cards(), "<>").Do([]byte(c.src)); !bytes.Equal(res, []byte(c.exp)) {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+	}
+}
+
+func TestTokenizeCards(t *testing.T) {
+	const src = "a=4111 1111 1111 1111, b=378282246310005, c=4111-1111-1111-1111"
+
+	rw := TokenizeCards([]byte("secret"))
+	res := rw.Do([]byte(src))
+
+	if !bytes.Equal(res, rw.Do([]byte(src))) {
+		t.Error("Non-deterministic result")
+		return
+	}
+
+	if bytes.Equal(res, []byte(src)) || bytes.Equal(res, TokenizeCards([]byte("other")).Do([]byte(src))) {
+		t.Errorf("Unexpected result: %q", string(res))
+		return
+	}
+
+	ms := Cards()(res)
+
+	if len(ms) != 3 {
+		t.Errorf("Invalid tokens: %q", string(res))
+		return
+	}
+
+	exp := []string{"4111 11## #### 1111", "378282#####0005", "4111-11##-####-1111"}
+
+	for i, m := range ms {
+		token := res[m[0]:m[1]]
+
+		if len(token) != len(exp[i]) {
+			t.Errorf("[%d] Unexpected token: %q", i, string(token))
+			return
+		}
+
+		for k, c := range token {
+			if exp[i][k] != '#' && c != exp[i][k] {
+				t.Errorf("[%d] Unexpected token: %q", i, string(token))
+				return
+			}
+		}
+	}
+}
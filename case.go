@@ -0,0 +1,112 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+// SnakeToCamel creates a Rewriter that converts all identifiers matched by the given Matcher
+// from snake_case to camelCase, for example, "user_id" to "userId", or "HTTP_server" to
+// "HTTPServer". The case of the first letter is preserved, as well as any leading or trailing
+// underscores; runs of underscores inside the identifier are removed altogether.
+func SnakeToCamel(match Matcher) Rewriter {
+	if match == nil {
+		panic("nil matcher in trw.SnakeToCamel() function")
+	}
+
+	return rewrite(match, func(dest, src []byte, m []int) []byte {
+		s := src[m[0]:m[1]]
+
+		// leading and trailing underscores
+		i, j := 0, len(s)
+
+		for i < j && s[i] == '_' {
+			i++
+		}
+
+		for j > i && s[j-1] == '_' {
+			j--
+		}
+
+		dest = append(dest, s[:i]...)
+
+		for up := false; i < j; i++ {
+			switch c := s[i]; {
+			case c == '_':
+				up = true
+			case up:
+				dest = append(dest, toUpperByte(c))
+				up = false
+			default:
+				dest = append(dest, c)
+			}
+		}
+
+		return append(dest, s[j:]...)
+	})
+}
+
+// CamelToSnake creates a Rewriter that converts all identifiers matched by the given Matcher
+// from camelCase or PascalCase to snake_case, for example, "userID" to "user_id", or
+// "HTTPServer" to "http_server". An underscore is inserted before every upper case letter that
+// follows a lower case letter or a digit, and before the last upper case letter in a run
+// of upper case letters that is followed by a lower case letter.
+func CamelToSnake(match Matcher) Rewriter {
+	if match == nil {
+		panic("nil matcher in trw.CamelToSnake() function")
+	}
+
+	return rewrite(match, func(dest, src []byte, m []int) []byte {
+		s := src[m[0]:m[1]]
+
+		for i, c := range s {
+			if !isUpper(c) {
+				dest = append(dest, c)
+				continue
+			}
+
+			if i > 0 && s[i-1] != '_' {
+				prev := s[i-1]
+
+				if isLower(prev) || isDigit(prev) || (isUpper(prev) && i+1 < len(s) && isLower(s[i+1])) {
+					dest = append(dest, '_')
+				}
+			}
+
+			dest = append(dest, c+('a'-'A'))
+		}
+
+		return dest
+	})
+}
+
+func isUpper(c byte) bool {
+	return c >= 'A' && c <= 'Z'
+}
+
+func isLower(c byte) bool {
+	return c >= 'a' && c <= 'z'
+}
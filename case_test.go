@@ -0,0 +1,71 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCaseConversion(t *testing.T) {
+	ident := Patt(`\b[A-Za-z_][A-Za-z0-9_]*\b`)
+
+	cases := []struct {
+		rw       Rewriter
+		src, exp string
+	}{
+		{
+			SnakeToCamel(ident),
+			"user_id = get_user_by_name(first_name, _private_x, trailing_, HTTP_server, a__b, x)",
+			"userId = getUserByName(firstName, _privateX, trailing_, HTTPServer, aB, x)",
+		},
+		{
+			SnakeToCamel(Patt(`\$[a-z_]+`)),
+			"$first_name and first_name",
+			"$firstName and first_name",
+		},
+		{
+			CamelToSnake(ident),
+			"userID = getUserByName(firstName, HTTPServer, version2Name, ID, x, Already_snake)",
+			"user_id = get_user_by_name(first_name, http_server, version2_name, id, x, already_snake)",
+		},
+		{
+			CamelToSnake(ident),
+			"parseJSONToXML MyHTTPClient2 ABCd",
+			"parse_json_to_xml my_http_client2 ab_cd",
+		},
+	}
+
+	for i, c := range cases {
+		if res := c.rw.Do([]byte(c.src)); !bytes.Equal(res, []byte(c.exp)) {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+	}
+}
@@ -0,0 +1,247 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+// ChangedRegions compares the original text with the result of rewriting it, and returns the index
+// pairs of the contiguous regions of the result that differ from the original, for example,
+// to highlight the changes in a preview. A region of deleted text is reported as an empty index
+// pair at the point of the deletion. The texts are compared word by word, where a word is a run
+// of ASCII letters, digits, and non-ASCII bytes, and every other byte is a word on its own, so that
+// a region never starts or ends in the middle of a word. The comparison uses Myers' diff algorithm,
+// which takes linear space, and time proportional to the size of the texts multiplied by the number
+// of changed words.
+func ChangedRegions(orig, res []byte) (regions [][]int) {
+	// common prefix and suffix, aligned to word boundaries
+	n := 0
+
+	for n < len(orig) && n < len(res) && orig[n] == res[n] {
+		n++
+	}
+
+	for n > 0 && isWordByte(orig[n-1]) && (wordAt(orig, n) || wordAt(res, n)) {
+		n--
+	}
+
+	if n == len(orig) && n == len(res) {
+		return nil
+	}
+
+	m := 0
+
+	for m < len(orig)-n && m < len(res)-n && orig[len(orig)-1-m] == res[len(res)-1-m] {
+		m++
+	}
+
+	for m > 0 && isWordByte(orig[len(orig)-m]) && (wordAt(orig, len(orig)-1-m) || wordAt(res, len(res)-1-m)) {
+		m--
+	}
+
+	// words
+	ids := make(map[string]int)
+	a, _ := splitWords(orig[n:len(orig)-m], n, ids)
+	b, bw := splitWords(res[n:len(res)-m], n, ids)
+
+	// walk the common runs of words, reporting the gaps between them
+	i, j := 0, 0
+	gap := func(i1, j1 int) {
+		if i1 > i || j1 > j {
+			regions = append(regions, []int{bw[j], bw[j1]})
+		}
+	}
+
+	d := newDiff(len(a) + len(b))
+
+	d.snakes(a, b, 0, 0, func(i1, j1, k int) {
+		gap(i1, j1)
+		i, j = i1+k, j1+k
+	})
+
+	gap(len(a), len(b))
+	return
+}
+
+// DoRegions applies the Rewriter to a copy of the specified byte slice, as DoCopy() does, and returns
+// the result together with the changed regions of it, as reported by ChangedRegions().
+func (rw Rewriter) DoRegions(src []byte) (result []byte, regions [][]int) {
+	result = rw.DoCopy(src)
+	regions = ChangedRegions(src, result)
+	return
+}
+
+func isWordByte(c byte) bool {
+	return isAlnum(c) || c >= 0x80
+}
+
+// wordAt checks if s[i] exists and is a word byte.
+func wordAt(s []byte, i int) bool {
+	return i >= 0 && i < len(s) && isWordByte(s[i])
+}
+
+// splitWords splits the text to words, returning the word identifiers, and the offsets of the words
+// (plus the end offset), adjusted by the given base offset.
+func splitWords(s []byte, base int, ids map[string]int) (words, offsets []int) {
+	for i := 0; i < len(s); {
+		j := i + 1
+
+		if isWordByte(s[i]) {
+			for j < len(s) && isWordByte(s[j]) {
+				j++
+			}
+		}
+
+		id, ok := ids[string(s[i:j])]
+
+		if !ok {
+			id = len(ids)
+			ids[string(s[i:j])] = id
+		}
+
+		words = append(words, id)
+		offsets = append(offsets, base+i)
+		i = j
+	}
+
+	offsets = append(offsets, base+len(s))
+	return
+}
+
+// diff holds the buffers for the forward and the backward paths of Myers' algorithm.
+type diff struct {
+	vf, vb []int
+}
+
+func newDiff(n int) *diff {
+	return &diff{vf: make([]int, n+4), vb: make([]int, n+4)}
+}
+
+// snakes invokes the given function for every run of the common elements of the two sequences,
+// in order, passing it the start indices of the run (adjusted by the base indices) and its length.
+func (d *diff) snakes(a, b []int, i0, j0 int, fn func(i, j, n int)) {
+	// common prefix
+	n := 0
+
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+
+	if n > 0 {
+		fn(i0, j0, n)
+		a, b, i0, j0 = a[n:], b[n:], i0+n, j0+n
+	}
+
+	// common suffix
+	m := 0
+
+	for m < len(a) && m < len(b) && a[len(a)-1-m] == b[len(b)-1-m] {
+		m++
+	}
+
+	a, b = a[:len(a)-m], b[:len(b)-m]
+
+	if len(a) > 0 && len(b) > 0 {
+		x, y, u, v := d.middleSnake(a, b)
+
+		d.snakes(a[:x], b[:y], i0, j0, fn)
+
+		if u > x {
+			fn(i0+x, j0+y, u-x)
+		}
+
+		d.snakes(a[u:], b[v:], i0+u, j0+v, fn)
+	}
+
+	if m > 0 {
+		fn(i0+len(a), j0+len(b), m)
+	}
+}
+
+// middleSnake finds the middle snake (x, y) - (u, v) of the shortest edit script for the two
+// sequences, which must have no common prefix or suffix.
+func (d *diff) middleSnake(a, b []int) (x, y, u, v int) {
+	n, m := len(a), len(b)
+	delta := n - m
+	odd := delta&1 != 0
+	max := (n + m + 1) / 2
+	off := max + 1
+	vf, vb := d.vf[:2*max+3], d.vb[:2*max+3]
+
+	vf[off+1], vb[off+1] = 0, 0
+
+	for k := 0; k <= max; k++ {
+		// forward path
+		for i := -k; i <= k; i += 2 {
+			if i == -k || i != k && vf[off+i-1] < vf[off+i+1] {
+				x = vf[off+i+1]
+			} else {
+				x = vf[off+i-1] + 1
+			}
+
+			y = x - i
+			u, v = x, y
+
+			for u < n && v < m && a[u] == b[v] {
+				u++
+				v++
+			}
+
+			vf[off+i] = u
+
+			if j := delta - i; odd && j >= -(k-1) && j <= k-1 && u+vb[off+j] >= n {
+				return
+			}
+		}
+
+		// backward path, in reversed coordinates
+		for j := -k; j <= k; j += 2 {
+			var p int
+
+			if j == -k || j != k && vb[off+j-1] < vb[off+j+1] {
+				p = vb[off+j+1]
+			} else {
+				p = vb[off+j-1] + 1
+			}
+
+			q := p - j
+			p0, q0 := p, q
+
+			for p < n && q < m && a[n-1-p] == b[m-1-q] {
+				p++
+				q++
+			}
+
+			vb[off+j] = p
+
+			if i := delta - j; !odd && i >= -k && i <= k && p+vf[off+i] >= n {
+				return n - p, m - q, n - p0, m - q0
+			}
+		}
+	}
+
+	panic("unreachable")
+}
@@ -0,0 +1,151 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestChangedRegions(t *testing.T) {
+	cases := []struct {
+		orig, res string
+		exp       [][]int
+	}{
+		{"", "", nil},
+		{"abc", "abc", nil},
+		{"abc", "", [][]int{{0, 0}}},
+		{"", "abc", [][]int{{0, 3}}},
+		{"ab", "abc", [][]int{{0, 3}}},
+		{"abc", "ab", [][]int{{0, 2}}},
+		{"call john now", "call [NAME] now", [][]int{{5, 11}}},
+		{"call john now", "call  now", [][]int{{5, 5}}},
+		{"a 1 b 2 c 3", "a # b # c #", [][]int{{2, 3}, {6, 7}, {10, 11}}},
+		{"x john@example.com y", "x [EMAIL] y", [][]int{{2, 9}}},
+		{"one two three", "one three", [][]int{{4, 4}}},
+		{"one three", "one two three", [][]int{{4, 8}}},
+		{"héllo wörld", "héllo world", [][]int{{7, 12}}},
+	}
+
+	for i, c := range cases {
+		if res := ChangedRegions([]byte(c.orig), []byte(c.res)); !reflect.DeepEqual(res, c.exp) {
+			t.Errorf("[%d] Unexpected result: %v instead of %v", i, res, c.exp)
+			return
+		}
+	}
+}
+
+func TestDoRegions(t *testing.T) {
+	src := []byte("user bob, phone 555-1234, user alice")
+	res, regions := Seq(Replace(Patt(`\d{3}-\d{4}`), "XXX"), Delete(Lit("user "))).DoRegions(src)
+
+	if string(src) != "user bob, phone 555-1234, user alice" {
+		t.Errorf("Source modified: %q", string(src))
+		return
+	}
+
+	const exp = "bob, phone XXX, alice"
+
+	if string(res) != exp {
+		t.Errorf("Unexpected result: %q instead of %q", string(res), exp)
+		return
+	}
+
+	if e := [][]int{{0, 0}, {11, 14}, {15, 15}}; !reflect.DeepEqual(regions, e) {
+		t.Errorf("Unexpected regions: %v instead of %v", regions, e)
+		return
+	}
+}
+
+func TestChangedRegionsMinimal(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	words := []string{"a", "b", "cd", " ", "."}
+
+	gen := func() []byte {
+		var s []byte
+
+		for n := rnd.Intn(12); n > 0; n-- {
+			s = append(s, words[rnd.Intn(len(words))]...)
+		}
+
+		return s
+	}
+
+	for n := 0; n < 2000; n++ {
+		orig, res := gen(), gen()
+		ids := make(map[string]int)
+		a, _ := splitWords(orig, 0, ids)
+		b, bw := splitWords(res, 0, ids)
+
+		// words of the result outside the changed regions
+		kept := 0
+		regions := ChangedRegions(orig, res)
+
+		for j := range b {
+			inside := false
+
+			for _, r := range regions {
+				inside = inside || (bw[j] >= r[0] && bw[j] < r[1])
+			}
+
+			if !inside {
+				kept++
+			}
+		}
+
+		if exp := lcsLen(a, b); kept != exp {
+			t.Errorf("[%d] %q -> %q: %d words kept instead of %d", n, string(orig), string(res), kept, exp)
+			return
+		}
+	}
+}
+
+func lcsLen(a, b []int) int {
+	dp := make([][]int, len(a)+1)
+
+	for i := range dp {
+		dp[i] = make([]int, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				dp[i][j] = dp[i+1][j+1] + 1
+			case dp[i+1][j] > dp[i][j+1]:
+				dp[i][j] = dp[i+1][j]
+			default:
+				dp[i][j] = dp[i][j+1]
+			}
+		}
+	}
+
+	return dp[0][0]
+}
@@ -0,0 +1,208 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import "unicode/utf8"
+
+// Squeeze creates a Rewriter that collapses every run of a repeated character from the given set
+// into a single occurrence of that character, like "tr -s" Unix command. For example, with the set
+// " -", the input "a  b--c -d" becomes "a b-c -d". The set may contain any UTF-8 characters.
+// The rewriting is done in place.
+func Squeeze(chars string) Rewriter {
+	if len(chars) == 0 {
+		panic("empty character set in trw.Squeeze() function")
+	}
+
+	var table [4]uint64 // bitmap of the bytes in the set, or of the leading bytes of multi-byte runes
+	var runes map[rune]bool
+
+	for i, r := range chars {
+		if r == utf8.RuneError {
+			panic("invalid UTF-8 character set in trw.Squeeze() function")
+		}
+
+		if r >= utf8.RuneSelf {
+			if runes == nil {
+				runes = make(map[rune]bool)
+			}
+
+			runes[r] = true
+		}
+
+		table[chars[i]>>6] |= 1 << (chars[i] & 63)
+	}
+
+	return func(dest, src []byte) ([]byte, []byte) {
+		w := 0           // write position
+		prev := rune(-1) // the last squeezable character written
+
+		for i := 0; i < len(src); {
+			c := src[i]
+
+			if table[c>>6]&(1<<(c&63)) == 0 {
+				src[w] = c
+				w++
+				i++
+				prev = -1
+				continue
+			}
+
+			r, n := rune(c), 1
+
+			if c >= utf8.RuneSelf {
+				if r, n = utf8.DecodeRune(src[i:]); !runes[r] {
+					r = -1
+				}
+			}
+
+			if r < 0 || r != prev {
+				w += copy(src[w:], src[i:i+n])
+			}
+
+			prev = r
+			i += n
+		}
+
+		return src[:w], dest
+	}
+}
+
+// Translate creates a Rewriter that replaces every character from the "from" set with the character
+// at the same position in the "to" set, like "tr" Unix command. Both sets may contain ranges like
+// "a-z" (a dash at the beginning or the end of a set is taken literally), and must be of the same
+// length after range expansion; where a character occurs in the "from" set more than once, the last
+// occurrence is used. The sets may contain any UTF-8 characters. If all the mapped characters
+// are ASCII, the translation is done strictly in place.
+func Translate(from, to string) Rewriter {
+	src, dst := expandRanges(from), expandRanges(to)
+
+	if len(src) == 0 || len(src) != len(dst) {
+		panic("invalid or mismatched character sets in trw.Translate() function")
+	}
+
+	ascii := true
+
+	for i, r := range src {
+		if r == utf8.RuneError || dst[i] == utf8.RuneError {
+			panic("invalid UTF-8 character set in trw.Translate() function")
+		}
+
+		ascii = ascii && r < utf8.RuneSelf && dst[i] < utf8.RuneSelf
+	}
+
+	if ascii {
+		var table [256]byte
+
+		for i := range table {
+			table[i] = byte(i)
+		}
+
+		for i, r := range src {
+			table[r] = byte(dst[i])
+		}
+
+		return func(dest, src []byte) ([]byte, []byte) {
+			for i, c := range src {
+				src[i] = table[c]
+			}
+
+			return src, dest
+		}
+	}
+
+	table := make(map[rune]rune, len(src))
+	inplace := true
+
+	for i, r := range src {
+		table[r] = dst[i]
+		inplace = inplace && utf8.RuneLen(r) == utf8.RuneLen(dst[i])
+	}
+
+	return func(dest, src []byte) ([]byte, []byte) {
+		if inplace {
+			for i := 0; i < len(src); {
+				r, n := utf8.DecodeRune(src[i:])
+
+				if t, ok := table[r]; ok {
+					utf8.EncodeRune(src[i:], t)
+				}
+
+				i += n
+			}
+
+			return src, dest
+		}
+
+		// (speculatively) reallocate destination slice
+		if len(src) > cap(dest) {
+			dest = make([]byte, 0, len(src)+len(src)/5) // +20%
+		}
+
+		dest = dest[:0]
+
+		for i := 0; i < len(src); {
+			r, n := utf8.DecodeRune(src[i:])
+
+			if t, ok := table[r]; ok {
+				dest = appendRune(dest, t)
+			} else {
+				dest = append(dest, src[i:i+n]...)
+			}
+
+			i += n
+		}
+
+		return dest, src
+	}
+}
+
+// expandRanges converts the given character set to a list of runes, expanding ranges like "a-z".
+func expandRanges(set string) (res []rune) {
+	runes := []rune(set)
+
+	for i := 0; i < len(runes); i++ {
+		if i+2 < len(runes) && runes[i+1] == '-' && runes[i] <= runes[i+2] {
+			for r := runes[i]; r <= runes[i+2]; r++ {
+				res = append(res, r)
+			}
+
+			i += 2
+		} else {
+			res = append(res, runes[i])
+		}
+	}
+
+	return
+}
+
+func appendRune(dest []byte, r rune) []byte {
+	var buf [utf8.UTFMax]byte
+
+	return append(dest, buf[:utf8.EncodeRune(buf[:], r)]...)
+}
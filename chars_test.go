@@ -0,0 +1,110 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSqueeze(t *testing.T) {
+	cases := []struct {
+		chars, src, exp string
+	}{
+		{" -", "a  b--c -d", "a b-c -d"},
+		{" ", "   ", " "},
+		{"ab", "aabbbaab", "abab"},
+		{"x", "abc", "abc"},
+		{"x", "", ""},
+		{"…—", "wait……… what——no——", "wait… what—no—"},
+		{"é", "ééè è", "éè è"},
+		{"a", "\xff\xffaa", "\xff\xffa"},
+	}
+
+	for i, c := range cases {
+		if res := Squeeze(c.chars).Do([]byte(c.src)); !bytes.Equal(res, []byte(c.exp)) {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	cases := []struct {
+		from, to, src, exp string
+	}{
+		{"A-Z", "a-z", "Hello, World!", "hello, world!"},
+		{"a-zA-Z", "n-za-mN-ZA-M", "Hello, World!", "Uryyb, Jbeyq!"},
+		{"-_", "_-", "a-b_c", "a_b-c"},
+		{"a-", "x+", "a-b", "x+b"},
+		{"aa", "xy", "aa", "yy"},
+		{"äöü", "aou", "Bärenüberfällöl", "Barenuberfallol"},
+		{"αβ", "ab", "αβγ", "abγ"},
+		{"ab", "αβ", "abc\xff", "αβc\xff"},
+		{"z-a", "abc", "a-z", "cba"}, // not a range
+	}
+
+	for i, c := range cases {
+		if res := Translate(c.from, c.to).Do([]byte(c.src)); !bytes.Equal(res, []byte(c.exp)) {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+	}
+}
+
+func BenchmarkSqueeze(b *testing.B) {
+	benchSqueeze(b, Squeeze(" ").Do)
+}
+
+func BenchmarkSqueezePatt(b *testing.B) {
+	benchSqueeze(b, Replace(Patt(" +"), " ").Do)
+}
+
+func benchSqueeze(b *testing.B, fn func([]byte) []byte) {
+	src := []byte("aa   bb  cc    dd aa   bb  cc    dd aa   bb  cc    dd")
+	exp := []byte("aa bb cc dd aa bb cc dd aa bb cc dd")
+	s := make([]byte, len(src), max(len(src), len(exp)))
+	ok := true
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for n := 0; n < b.N && ok; n++ {
+		s = s[:len(src)]
+		copy(s, src)
+		ok = bytes.Equal(fn(s), exp)
+	}
+
+	b.StopTimer()
+
+	if !ok {
+		b.Error("Benchmark failed!")
+		return
+	}
+}
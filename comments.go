@@ -0,0 +1,124 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import "bytes"
+
+// LineComments creates a Matcher for comments that start with the given marker and
+// continue up to (but not including) the end of the line. String literals delimited
+// by any of the quote characters are skipped over, with backslash treated as
+// an escape character inside the literals.
+func LineComments(marker, quotes string) Matcher {
+	if len(marker) == 0 {
+		panic("empty marker in trw.LineComments() function")
+	}
+
+	return commentMatcher([]byte(marker), []byte("\n"), quotes, false)
+}
+
+// BlockComments creates a Matcher for comments enclosed in the given opening and closing
+// markers. String literals delimited by any of the quote characters are skipped over,
+// with backslash treated as an escape character inside the literals. An unterminated
+// comment extends up to the end of the input.
+func BlockComments(open, close, quotes string) Matcher {
+	if len(open) == 0 || len(close) == 0 {
+		panic("empty marker in trw.BlockComments() function")
+	}
+
+	return commentMatcher([]byte(open), []byte(close), quotes, true)
+}
+
+// StripLineComments creates a Rewriter that removes all comments from the given marker up
+// to the end of the line, skipping string literals delimited by any of the quote characters.
+func StripLineComments(marker, quotes string) Rewriter {
+	return Delete(LineComments(marker, quotes))
+}
+
+// StripBlockComments creates a Rewriter that removes all comments enclosed in the given
+// markers, skipping string literals delimited by any of the quote characters.
+func StripBlockComments(open, close, quotes string) Rewriter {
+	return Delete(BlockComments(open, close, quotes))
+}
+
+func commentMatcher(open, close []byte, quotes string, inclusive bool) Matcher {
+	return func(s []byte) (ms [][]int) {
+		for i := 0; i < len(s); {
+			switch {
+			case isQuote(s[i], quotes):
+				i = skipQuoted(s, i)
+
+			case bytes.HasPrefix(s[i:], open):
+				j := i + len(open)
+
+				if k := bytes.Index(s[j:], close); k < 0 {
+					j = len(s)
+				} else if j += k; inclusive {
+					j += len(close)
+				} else if k > 0 && s[j-1] == '\r' {
+					j-- // keep CRLF line endings intact
+				}
+
+				ms = append(ms, []int{i, j})
+				i = j
+
+			default:
+				i++
+			}
+		}
+
+		return
+	}
+}
+
+// isQuote checks if the given byte is one of the quote characters.
+func isQuote(c byte, quotes string) bool {
+	for i := 0; i < len(quotes); i++ {
+		if quotes[i] == c {
+			return true
+		}
+	}
+
+	return false
+}
+
+// skipQuoted returns the index of the first byte after the string literal starting at s[i].
+func skipQuoted(s []byte, i int) int {
+	q := s[i]
+
+	for i++; i < len(s); i++ {
+		switch s[i] {
+		case q:
+			return i + 1
+		case '\\':
+			i++
+		}
+	}
+
+	return len(s)
+}
@@ -0,0 +1,93 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestStripLineComments(t *testing.T) {
+	cases := []struct {
+		src, exp string
+	}{
+		{"abc", "abc"},
+		{"abc // xyz", "abc "},
+		{"abc // xyz\ndef", "abc \ndef"},
+		{"abc // xyz\r\ndef // zzz\r\n", "abc \r\ndef \r\n"},
+		{"// xyz\n//\n", "\n\n"},
+		{`x = "http://example.com" // url`, `x = "http://example.com" `},
+		{`x = 'a"b' // "c"`, `x = 'a"b' `},
+		{`x = "a\"//b" // c`, `x = "a\"//b" `},
+		{`x = "unterminated // c`, `x = "unterminated // c`},
+	}
+
+	for i, c := range cases {
+		if res := StripLineComments("//", `"'`).Do([]byte(c.src)); !bytes.Equal(res, []byte(c.exp)) {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+	}
+}
+
+func TestStripBlockComments(t *testing.T) {
+	cases := []struct {
+		src, exp string
+	}{
+		{"abc", "abc"},
+		{"a/* x */bc", "abc"},
+		{"a/* x */b/**/c", "abc"},
+		{"a/* x\ny */bc", "abc"},
+		{`a"/* x */"bc`, `a"/* x */"bc`},
+		{`a"\"/* x */"bc/*"*/`, `a"\"/* x */"bc`},
+		{"abc /* x", "abc "},
+	}
+
+	for i, c := range cases {
+		if res := StripBlockComments("/*", "*/", `"`).Do([]byte(c.src)); !bytes.Equal(res, []byte(c.exp)) {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+	}
+}
+
+func TestStripCommentsSeq(t *testing.T) {
+	src := "a := \"/* // */\" // line\nb := `x`/* block */ + 1\n"
+	exp := "a := \"/* // */\" \nb := `x` + 1\n"
+
+	rw := Seq(
+		StripBlockComments("/*", "*/", "\"`"),
+		StripLineComments("//", "\"`"),
+	)
+
+	if res := rw.Do([]byte(src)); !bytes.Equal(res, []byte(exp)) {
+		t.Errorf("Unexpected result: %q instead of %q", string(res), exp)
+		return
+	}
+}
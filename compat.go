@@ -0,0 +1,81 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import "regexp"
+
+// Compat provides drop-in replacements for the ReplaceAll family of regexp.Regexp methods,
+// implemented via trw Rewriters, to ease an incremental migration from the regexp package.
+// For example, re.ReplaceAllString(s, repl) becomes trw.Compat.ReplaceAllString(re, s, repl).
+// As with the regexp methods, the source is never modified, and the result is always a copy.
+var Compat compat
+
+type compat struct{}
+
+// ReplaceAll is the equivalent of re.ReplaceAll(src, repl).
+func (compat) ReplaceAll(re *regexp.Regexp, src, repl []byte) []byte {
+	return ExpandRe(re, string(repl)).DoCopy(src)
+}
+
+// ReplaceAllString is the equivalent of re.ReplaceAllString(src, repl).
+func (compat) ReplaceAllString(re *regexp.Regexp, src, repl string) string {
+	return string(ExpandRe(re, repl).Do([]byte(src)))
+}
+
+// ReplaceAllLiteral is the equivalent of re.ReplaceAllLiteral(src, repl).
+func (compat) ReplaceAllLiteral(re *regexp.Regexp, src, repl []byte) []byte {
+	return ReplaceRe(re, repl).DoCopy(src)
+}
+
+// ReplaceAllLiteralString is the equivalent of re.ReplaceAllLiteralString(src, repl).
+func (compat) ReplaceAllLiteralString(re *regexp.Regexp, src, repl string) string {
+	return string(ReplaceRe(re, []byte(repl)).Do([]byte(src)))
+}
+
+// ReplaceAllFunc is the equivalent of re.ReplaceAllFunc(src, repl).
+func (compat) ReplaceAllFunc(re *regexp.Regexp, src []byte, repl func([]byte) []byte) []byte {
+	return replaceFunc(re, repl).DoCopy(src)
+}
+
+// ReplaceAllStringFunc is the equivalent of re.ReplaceAllStringFunc(src, repl).
+func (compat) ReplaceAllStringFunc(re *regexp.Regexp, src string, repl func(string) string) string {
+	return string(replaceFunc(re, func(s []byte) []byte { return []byte(repl(string(s))) }).Do([]byte(src)))
+}
+
+// replaceFunc creates a Rewriter that substitutes every match of the regular expression with
+// the result of the given function.
+func replaceFunc(re *regexp.Regexp, repl func([]byte) []byte) Rewriter {
+	if re == nil {
+		panic("nil regular expression object in trw.Compat method")
+	}
+
+	return rewrite(Re(re), func(dest, src []byte, m []int) []byte {
+		return append(dest, repl(src[m[0]:m[1]])...)
+	})
+}
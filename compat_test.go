@@ -0,0 +1,92 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestCompat(t *testing.T) {
+	cases := []struct {
+		re        *regexp.Regexp
+		src, repl string
+	}{
+		{regexp.MustCompile(`a(x*)b`), "-ab-axxb-", "${1}W"},
+		{regexp.MustCompile(`a(x*)b`), "-ab-axxb-", "$1W"},
+		{regexp.MustCompile(`a(x*)b`), "-ab-axxb-", ""},
+		{regexp.MustCompile(`x*`), "abc", "-"},
+		{regexp.MustCompile(`(\w+)@(\w+)`), "me@host, you@there", "$2:$1"},
+		{regexp.MustCompile(`[0-9]+`), "no digits", "#"},
+		{regexp.MustCompile(`(?m)^`), "a\nb\nc", "> "},
+	}
+
+	upper := func(s []byte) []byte { return bytes.ToUpper(s) }
+
+	for i, c := range cases {
+		src := []byte(c.src)
+
+		if res, exp := Compat.ReplaceAll(c.re, src, []byte(c.repl)), c.re.ReplaceAll(src, []byte(c.repl)); !bytes.Equal(res, exp) {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), string(exp))
+			return
+		}
+
+		if res, exp := Compat.ReplaceAllString(c.re, c.src, c.repl), c.re.ReplaceAllString(c.src, c.repl); res != exp {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, res, exp)
+			return
+		}
+
+		if res, exp := Compat.ReplaceAllLiteral(c.re, src, []byte(c.repl)), c.re.ReplaceAllLiteral(src, []byte(c.repl)); !bytes.Equal(res, exp) {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), string(exp))
+			return
+		}
+
+		if res, exp := Compat.ReplaceAllLiteralString(c.re, c.src, c.repl), c.re.ReplaceAllLiteralString(c.src, c.repl); res != exp {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, res, exp)
+			return
+		}
+
+		if res, exp := Compat.ReplaceAllFunc(c.re, src, upper), c.re.ReplaceAllFunc(src, upper); !bytes.Equal(res, exp) {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), string(exp))
+			return
+		}
+
+		if res, exp := Compat.ReplaceAllStringFunc(c.re, c.src, strings.ToUpper), c.re.ReplaceAllStringFunc(c.src, strings.ToUpper); res != exp {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, res, exp)
+			return
+		}
+
+		if string(src) != c.src {
+			t.Errorf("[%d] Source modified: %q", i, string(src))
+			return
+		}
+	}
+}
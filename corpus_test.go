@@ -0,0 +1,129 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw_test
+
+import (
+	"path"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+	"unicode"
+
+	"github.com/maxim2266/trw"
+	"github.com/maxim2266/trw/trwbench"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/unicode/norm"
+)
+
+// corpusRewriters is the list of the constructors exercised by BenchmarkCorpus.
+var corpusRewriters = []struct {
+	name string
+	rw   trw.Rewriter
+}{
+	{"Delete/Lit", trw.Delete(trw.Lit("the"))},
+	{"Delete/Patt", trw.Delete(trw.Patt(`\s+`))},
+	{"Delete/Bytes", trw.Delete(trw.Bytes(" \t\n"))},
+	{"Replace/Lit", trw.Replace(trw.Lit("e"), "EE")},
+	{"Replace/Patt", trw.Replace(trw.Patt(`[0-9]+`), "#")},
+	{"Replace/Windowed", trw.Replace(trw.Windowed(trw.Patt(`[0-9]+`), 4096, 64), "#")},
+	{"ReplaceWindowed", trw.ReplaceWindowed(trw.Patt(`[0-9]+`), "#", 4096, 64)},
+	{"ReplaceRe", trw.ReplaceRe(regexp.MustCompile(`[A-Z][a-z]+`), []byte("<$0>"))},
+	{"Expand", trw.Expand(`(\w+)@(\w+)`, "${2} at ${1}")},
+	{"ExpandWith", trw.ExpandWith(`\b(the|and|of)\b`, map[string]string{"the": "THE", "and": "AND"})},
+	{"ReplaceNumbered", trw.ReplaceNumbered(trw.Patt(`\d+`), "N${n}")},
+	{"ReplacePairs", trw.ReplacePairs("<", "&lt;", ">", "&gt;", "&", "&amp;")},
+	{"ReplaceMap", trw.ReplaceMap(map[string]string{"the": "a", "and": "&", "http": "HTTP"})},
+	{"ReplaceLazy", trw.ReplaceLazy(trw.FindLit("a"), "AAA")},
+	{"Squeeze", trw.Squeeze(" \n")},
+	{"Translate", trw.Translate("a-z", "A-Z")},
+	{"Normalize", trw.Normalize(norm.NFD)},
+	{"StripDiacritics", trw.StripDiacritics()},
+	{"RunesIn", trw.Delete(trw.RunesIn(unicode.Han, unicode.Hiragana))},
+	{"SmartPunctuation", trw.SmartPunctuation()},
+	{"ASCIIPunctuation", trw.ASCIIPunctuation()},
+	{"Encode", trw.Seq(trw.Encode(charmap.Windows1252), trw.Decode(charmap.Windows1252))},
+	{"PseudonymizeHosts", trw.PseudonymizeHosts([]byte("seed"))},
+	{"PseudonymizeUUIDs", trw.PseudonymizeUUIDs(trw.UUIDPseudonyms())},
+	{"CanonicalUUIDs", trw.CanonicalUUIDs()},
+	{"MaskMACs", trw.MaskMACs('x', true)},
+	{"TokenizeCards", trw.TokenizeCards([]byte("seed"))},
+	{"FuzzCoordinates", trw.FuzzCoordinates(4, 2)},
+	{"RoundNumbers", trw.RoundNumbers(trw.Floats(), 1)},
+	{"NormalizeFloats", trw.NormalizeFloats('g', -1)},
+	{"BucketTimestamps", trw.BucketTimestamps(trw.Patt(`\d\d/\w{3}/\d{4}:\d\d:\d\d:\d\d \+0000`), "02/Jan/2006:15:04:05 -0700", time.Hour)},
+	{"RedactParams", trw.RedactParams("***", "q", "page")},
+	{"CollapseRepeats", trw.CollapseRepeats(0, "... ${n} more")},
+	{"SetField", trw.SetField("env", "prod")},
+	{"CamelToSnake", trw.CamelToSnake(trw.Patt(`[a-z]+[A-Z]\w*`))},
+	{"StripBlockComments", trw.StripBlockComments("<!--", "-->", "")},
+}
+
+// BenchmarkCorpus runs every rewriter from the list above on every file from testdata/corpus.
+// Use "make bench-compare" to compare the results against another revision.
+func BenchmarkCorpus(b *testing.B) {
+	c, err := trwbench.LoadDir("testdata/corpus")
+
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, r := range corpusRewriters {
+		r := r
+
+		b.Run(r.name, func(b *testing.B) {
+			for _, f := range c.Files {
+				f := f
+				b.Run(strings.TrimSuffix(f.Name, path.Ext(f.Name)), func(b *testing.B) {
+					trwbench.Run(b, r.rw, &trwbench.Corpus{Name: f.Name, Files: []trwbench.File{f}})
+				})
+			}
+		})
+	}
+}
+
+// TestCorpus checks that the corpus rewriters do not fail on any corpus file.
+func TestCorpus(t *testing.T) {
+	c, err := trwbench.LoadDir("testdata/corpus")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(c.Files) != 4 {
+		t.Errorf("Unexpected number of corpus files: %d", len(c.Files))
+		return
+	}
+
+	for _, r := range corpusRewriters {
+		for _, f := range c.Files {
+			r.rw.Do(append([]byte(nil), f.Data...))
+		}
+	}
+}
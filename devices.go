@@ -0,0 +1,251 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import "bytes"
+
+// MACs creates a Matcher for MAC addresses in any of the common notations:
+// "01:23:45:67:89:ab", "01-23-45-67-89-ab", or "0123.4567.89ab".
+func MACs() Matcher {
+	return func(s []byte) (ms [][]int) {
+		for i := 0; i < len(s); i++ {
+			if !isHexDigit(s[i]) || (i > 0 && (isIdent(s[i-1]) || s[i-1] == ':' || s[i-1] == '.')) {
+				continue
+			}
+
+			if j := macAddr(s, i); j > 0 {
+				ms = append(ms, []int{i, j})
+				i = j - 1
+			}
+		}
+
+		return
+	}
+}
+
+// MaskMACs creates a Rewriter that replaces all hex digits of every MAC address with
+// the given mask character. If keepOUI is true, the first three octets identifying
+// the vendor are left intact.
+func MaskMACs(mask byte, keepOUI bool) Rewriter {
+	if !isMaskChar(mask) {
+		panic("invalid mask character in trw.MaskMACs() function")
+	}
+
+	return mapMatches(MACs(), func(s []byte) {
+		i := 0
+
+		if keepOUI {
+			i = 8 // "01:23:45" or "0123.45"
+
+			if s[4] == '.' {
+				i = 7
+			}
+		}
+
+		maskDigits(s[i:], mask, 0)
+	})
+}
+
+// Serials creates a Matcher for hardware serial numbers. Two kinds of serial numbers are
+// recognised: the values following labels like "S/N", "SN", "Serial", or "Serial number",
+// as in "S/N: 5CG1234XYZ" or "serial=ABC-12345", and bare IMEI numbers (15 digits with a valid
+// check digit). A labelled value must contain at least 4 letters, digits, or dashes,
+// including at least one digit. Only the values are matched, the labels are not.
+func Serials() Matcher {
+	return func(s []byte) (ms [][]int) {
+		for i := 0; i < len(s); i++ {
+			if !isAlnum(s[i]) || (i > 0 && isIdent(s[i-1])) {
+				continue
+			}
+
+			if m := serialValue(s, i); m != nil {
+				ms = append(ms, m)
+				i = m[1] - 1
+			} else if j := skipDigits(s, i); j-i == 15 && (j == len(s) || !isIdent(s[j])) && luhn(s[i:j]) {
+				ms = append(ms, []int{i, j})
+				i = j - 1
+			}
+		}
+
+		return
+	}
+}
+
+// MaskSerials creates a Rewriter that replaces all letters and digits of every serial
+// number (as recognised by Serials()), except the last keep ones, with the given
+// mask character.
+func MaskSerials(mask byte, keep int) Rewriter {
+	if !isMaskChar(mask) || keep < 0 {
+		panic("invalid argument in trw.MaskSerials() function")
+	}
+
+	return mapMatches(Serials(), func(s []byte) {
+		maskDigits(s, mask, keep)
+	})
+}
+
+// macAddr returns the end of the MAC address starting at s[i], or -1 if there is no MAC address.
+func macAddr(s []byte, i int) int {
+	var end, step, n int // n is the number of hex digits per group
+	var sep byte
+
+	switch {
+	case i+17 <= len(s) && (s[i+2] == ':' || s[i+2] == '-'):
+		end, step, n, sep = i+17, 3, 2, s[i+2]
+	case i+14 <= len(s) && s[i+4] == '.':
+		end, step, n, sep = i+14, 5, 4, '.'
+	default:
+		return -1
+	}
+
+	for j := i; j < end; j += step {
+		for k := j; k < j+n; k++ {
+			if !isHexDigit(s[k]) {
+				return -1
+			}
+		}
+
+		if j+n < end && s[j+n] != sep {
+			return -1
+		}
+	}
+
+	if end < len(s) && (isIdent(s[end]) || (s[end] == sep && end+1 < len(s) && isHexDigit(s[end+1]))) {
+		return -1
+	}
+
+	return end
+}
+
+// serial number labels, longer ones first
+var serialLabels = [...]string{
+	"serial number", "serial_number", "serial-number", "serialnumber",
+	"serial no", "serialno", "serial", "s/n", "sn",
+}
+
+// serialValue returns the location of the serial number following the label at s[i],
+// or nil if there is no label, or no valid value.
+func serialValue(s []byte, i int) []int {
+	j := -1
+
+	for _, label := range serialLabels {
+		if k := i + len(label); k <= len(s) && bytes.EqualFold(s[i:k], []byte(label)) && (k == len(s) || !isIdent(s[k])) {
+			j = k
+			break
+		}
+	}
+
+	if j < 0 {
+		return nil
+	}
+
+	// separator: optional dot or quote, then spaces and an optional ':', '=', or '#', then spaces
+	// and an optional quote
+	if j < len(s) && (s[j] == '.' || s[j] == '"' || s[j] == '\'') {
+		j++
+	}
+
+	j = skipSpaces(s, j)
+
+	if j < len(s) && (s[j] == ':' || s[j] == '=' || s[j] == '#') {
+		j = skipSpaces(s, j+1)
+	}
+
+	if j < len(s) && (s[j] == '"' || s[j] == '\'') {
+		j++
+	}
+
+	// value
+	k, digits := j, false
+
+	for k < len(s) && (isAlnum(s[k]) || s[k] == '-') {
+		digits = digits || isDigit(s[k])
+		k++
+	}
+
+	if k < len(s) && isIdent(s[k]) {
+		return nil
+	}
+
+	for k > j && s[k-1] == '-' {
+		k--
+	}
+
+	if k-j < 4 || !digits || s[j] == '-' {
+		return nil
+	}
+
+	return []int{j, k}
+}
+
+func skipSpaces(s []byte, i int) int {
+	for i < len(s) && (s[i] == ' ' || s[i] == '\t') {
+		i++
+	}
+
+	return i
+}
+
+// luhn checks the Luhn check digit of the given decimal digits.
+func luhn(digits []byte) bool {
+	sum := 0
+
+	for i := range digits {
+		d := int(digits[len(digits)-1-i] - '0')
+
+		if i%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+
+		sum += d
+	}
+
+	return sum%10 == 0
+}
+
+// maskDigits replaces all ASCII letters and digits in the given slice, except the last keep
+// ones, with the mask character.
+func maskDigits(s []byte, mask byte, keep int) {
+	for i := len(s) - 1; i >= 0; i-- {
+		if isAlnum(s[i]) {
+			if keep > 0 {
+				keep--
+			} else {
+				s[i] = mask
+			}
+		}
+	}
+}
+
+// isMaskChar checks if the given byte can be used as a mask character without breaking UTF-8 text.
+func isMaskChar(c byte) bool {
+	return c >= ' ' && c < 0x7F
+}
@@ -0,0 +1,84 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDevices(t *testing.T) {
+	cases := []struct {
+		rw       Rewriter
+		src, exp string
+	}{
+		{
+			Replace(MACs(), "<>"),
+			"eth0 01:23:45:67:89:AB, wlan0 01-23-45-67-89-ab, cisco 0123.4567.89ab.",
+			"eth0 <>, wlan0 <>, cisco <>.",
+		},
+		{
+			Replace(MACs(), "<>"),
+			"01:23:45:67:89 01:23:45:67:89:ab:cd x01:23:45:67:89:ab 01:23-45:67:89:ab fe80:0:0:0:0:0:0:1",
+			"01:23:45:67:89 01:23:45:67:89:ab:cd x01:23:45:67:89:ab 01:23-45:67:89:ab fe80:0:0:0:0:0:0:1",
+		},
+		{
+			MaskMACs('x', false),
+			"hw=01:23:45:67:89:ab",
+			"hw=xx:xx:xx:xx:xx:xx",
+		},
+		{
+			MaskMACs('x', true),
+			"01-23-45-67-89-ab 0123.4567.89ab",
+			"01-23-45-xx-xx-xx 0123.45xx.xxxx",
+		},
+		{
+			Replace(Serials(), "<>"),
+			`S/N: 5CG1234XYZ, serial=ABC-12345, "serialNumber": "C02XK0ABJG5H", Serial No. 12-34-`,
+			`S/N: <>, serial=<>, "serialNumber": "<>", Serial No. <>-`,
+		},
+		{
+			Replace(Serials(), "<>"),
+			"sn is 1234, serials: 12345, snapshot: 12345, SN: ABCDE, sn: 123, imei 490154203237518 490154203237519",
+			"sn is 1234, serials: 12345, snapshot: 12345, SN: ABCDE, sn: 123, imei <> 490154203237519",
+		},
+		{
+			MaskSerials('*', 4),
+			"SN#AB-1234-CD56 imei:490154203237518",
+			"SN#**-****-CD56 imei:***********7518",
+		},
+	}
+
+	for i, c := range cases {
+		if res := c.rw.Do([]byte(c.src)); !bytes.Equal(res, []byte(c.exp)) {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+	}
+}
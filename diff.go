@@ -0,0 +1,223 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// DiffFileHeaders creates a Matcher for the file header lines ("--- old" and "+++ new")
+// in unified diff text. Matches do not include line terminators.
+func DiffFileHeaders() Matcher {
+	return diffLines(diffFileHeader)
+}
+
+// DiffHunkHeaders creates a Matcher for the hunk header lines ("@@ -1,2 +1,3 @@")
+// in unified diff text. Matches do not include line terminators.
+func DiffHunkHeaders() Matcher {
+	return diffLines(diffHunkHeader)
+}
+
+// DiffAdded creates a Matcher for the added lines in the hunks of unified diff text.
+// Matches do not include line terminators.
+func DiffAdded() Matcher {
+	return diffLines(diffAdded)
+}
+
+// DiffRemoved creates a Matcher for the removed lines in the hunks of unified diff text.
+// Matches do not include line terminators.
+func DiffRemoved() Matcher {
+	return diffLines(diffRemoved)
+}
+
+// DiffContext creates a Matcher for the context (unchanged) lines in the hunks of unified
+// diff text. Matches do not include line terminators.
+func DiffContext() Matcher {
+	return diffLines(diffContext)
+}
+
+// DiffTimestamps creates a Matcher for the timestamps in the file header lines of unified
+// diff text, i.e., everything from the tab character after the file name up to the end
+// of the line. Deleting the matches makes the diff text independent of the file times.
+func DiffTimestamps() Matcher {
+	return func(s []byte) (ms [][]int) {
+		scanDiff(s, func(kind, i, end int) {
+			if kind == diffFileHeader {
+				if k := bytes.IndexByte(s[i:end], '\t'); k >= 0 {
+					ms = append(ms, []int{i + k, trimLineEnd(s, i, end)})
+				}
+			}
+		})
+
+		return
+	}
+}
+
+// diff line kinds
+const (
+	diffOther = iota
+	diffFileHeader
+	diffHunkHeader
+	diffAdded
+	diffRemoved
+	diffContext
+)
+
+func diffLines(kind int) Matcher {
+	return func(s []byte) (ms [][]int) {
+		scanDiff(s, func(k, i, end int) {
+			if k == kind {
+				ms = append(ms, []int{i, trimCR(s, i, end)})
+			}
+		})
+
+		return
+	}
+}
+
+// scanDiff invokes the given function for each line of the unified diff text, passing it
+// the kind of the line, and the line location, excluding the newline.
+func scanDiff(s []byte, fn func(kind, i, end int)) {
+	var nold, nnew int // lines left in the current hunk
+
+	for i := 0; i < len(s); {
+		end, next := nextLine(s, i)
+		line := s[i:end]
+
+		if nold > 0 || nnew > 0 {
+			kind := diffOther
+
+			switch {
+			case len(line) == 0 || line[0] == ' ' || line[0] == '\r':
+				kind = diffContext
+				nold--
+				nnew--
+			case line[0] == '-':
+				kind = diffRemoved
+				nold--
+			case line[0] == '+':
+				kind = diffAdded
+				nnew--
+			case line[0] == '\\': // "\ No newline at end of file"
+			default: // malformed hunk
+				nold, nnew = 0, 0
+				continue
+			}
+
+			fn(kind, i, end)
+			i = next
+			continue
+		}
+
+		switch {
+		case bytes.HasPrefix(line, []byte("--- ")) && bytes.HasPrefix(s[next:], []byte("+++ ")):
+			fn(diffFileHeader, i, end)
+			i = next
+			end, next = nextLine(s, i)
+			fn(diffFileHeader, i, end)
+
+		case bytes.HasPrefix(line, []byte("@@ -")):
+			var ok bool
+
+			if nold, nnew, ok = parseHunkHeader(line); ok {
+				fn(diffHunkHeader, i, end)
+			} else {
+				fn(diffOther, i, end)
+			}
+
+		default:
+			fn(diffOther, i, end)
+		}
+
+		i = next
+	}
+}
+
+// parseHunkHeader parses the hunk header "@@ -l[,s] +l[,s] @@", returning the numbers of the old
+// and new lines in the hunk.
+func parseHunkHeader(line []byte) (nold, nnew int, ok bool) {
+	i := 3
+
+	if nold, i, ok = parseHunkRange(line, i); !ok || i >= len(line) || line[i] != ' ' {
+		return 0, 0, false
+	}
+
+	if i++; i >= len(line) || line[i] != '+' {
+		return 0, 0, false
+	}
+
+	if nnew, i, ok = parseHunkRange(line, i); !ok || !bytes.HasPrefix(line[i:], []byte(" @@")) {
+		return 0, 0, false
+	}
+
+	return
+}
+
+// parseHunkRange parses the range "-l[,s]" or "+l[,s]" at line[i].
+func parseHunkRange(line []byte, i int) (n, next int, ok bool) {
+	j := skipDigits(line, i+1)
+
+	if j == i+1 {
+		return
+	}
+
+	n = 1
+
+	if j < len(line) && line[j] == ',' {
+		k := skipDigits(line, j+1)
+
+		if k == j+1 {
+			return
+		}
+
+		if n, ok = atoi(line[j+1 : k]); !ok {
+			return
+		}
+
+		j = k
+	}
+
+	return n, j, true
+}
+
+// atoi converts the given decimal digits to a non-negative int.
+func atoi(s []byte) (int, bool) {
+	n, err := strconv.Atoi(string(s))
+	return n, err == nil && n >= 0
+}
+
+// trimCR returns the end index of the line s[i:end] with the trailing carriage return removed.
+func trimCR(s []byte, i, end int) int {
+	if end > i && s[end-1] == '\r' {
+		end--
+	}
+
+	return end
+}
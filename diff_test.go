@@ -0,0 +1,93 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const diffSample = `diff -u a.txt b.txt
+--- a.txt	2020-01-01 10:00:00.000000000 +0000
++++ b.txt	2020-01-02 11:00:00.000000000 +0000
+@@ -1,4 +1,4 @@
+ one
+--- two
++++ two
+ three
+-four
++four!
+\ No newline at end of file
+`
+
+func TestDiffMatchers(t *testing.T) {
+	cases := []struct {
+		match Matcher
+		exp   []string
+	}{
+		{DiffFileHeaders(), []string{
+			"--- a.txt\t2020-01-01 10:00:00.000000000 +0000",
+			"+++ b.txt\t2020-01-02 11:00:00.000000000 +0000",
+		}},
+		{DiffHunkHeaders(), []string{"@@ -1,4 +1,4 @@"}},
+		{DiffAdded(), []string{"+++ two", "+four!"}},
+		{DiffRemoved(), []string{"--- two", "-four"}},
+		{DiffContext(), []string{" one", " three"}},
+		{DiffTimestamps(), []string{
+			"\t2020-01-01 10:00:00.000000000 +0000",
+			"\t2020-01-02 11:00:00.000000000 +0000",
+		}},
+	}
+
+	src := []byte(diffSample)
+
+	for i, c := range cases {
+		var res []string
+
+		for _, m := range c.match(src) {
+			res = append(res, string(src[m[0]:m[1]]))
+		}
+
+		if strings.Join(res, "\n") != strings.Join(c.exp, "\n") {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, res, c.exp)
+			return
+		}
+	}
+}
+
+func TestDiffStripTimestamps(t *testing.T) {
+	src := "--- a\t2020-01-01\r\n+++ b\t2020-01-02\r\n@@ -1 +1 @@\r\n-x\r\n+y\r\n"
+	exp := "--- a\r\n+++ b\r\n@@ -1 +1 @@\r\n-x\r\n+y\r\n"
+
+	if res := Delete(DiffTimestamps()).Do([]byte(src)); !bytes.Equal(res, []byte(exp)) {
+		t.Errorf("Unexpected result: %q instead of %q", string(res), exp)
+		return
+	}
+}
@@ -0,0 +1,95 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/transform"
+)
+
+// Decode creates a Rewriter that converts its input from the given character encoding
+// (like charmap.Windows1251 or japanese.ShiftJIS) to UTF-8. Invalid byte sequences
+// are converted to U+FFFD.
+func Decode(enc encoding.Encoding) Rewriter {
+	if enc == nil {
+		panic("nil encoding in trw.Decode() function")
+	}
+
+	return func(dest, src []byte) ([]byte, []byte) {
+		return transformAll(enc.NewDecoder(), dest, src), src
+	}
+}
+
+// Encode creates a Rewriter that converts its UTF-8 input to the given character encoding.
+// Characters that are not representable in the encoding are replaced with the encoding's
+// replacement character, as in encoding.ReplaceUnsupported().
+func Encode(enc encoding.Encoding) Rewriter {
+	if enc == nil {
+		panic("nil encoding in trw.Encode() function")
+	}
+
+	return func(dest, src []byte) ([]byte, []byte) {
+		return transformAll(encoding.ReplaceUnsupported(enc.NewEncoder()), dest, src), src
+	}
+}
+
+// transformAll applies the given transformer to the whole source slice, storing the result
+// in the destination slice, reallocated as needed.
+func transformAll(t transform.Transformer, dest, src []byte) []byte {
+	// (speculatively) reallocate destination slice
+	if len(src) > cap(dest) {
+		dest = make([]byte, 0, len(src)+len(src)/5) // +20%
+	}
+
+	dest = dest[:cap(dest)]
+
+	var n, nsrc int
+
+	for {
+		nd, ns, err := t.Transform(dest[n:], src[nsrc:], true)
+
+		n += nd
+		nsrc += ns
+
+		switch err {
+		case nil:
+			return dest[:n]
+		case transform.ErrShortDst:
+			buf := make([]byte, 2*len(dest)+minTransformSpace)
+
+			copy(buf, dest[:n])
+			dest = buf
+		default: // should not happen
+			return append(dest[:n], src[nsrc:]...)
+		}
+	}
+}
+
+// minTransformSpace is the minimum extra space for a transformer to make progress.
+const minTransformSpace = 16
@@ -0,0 +1,69 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"bytes"
+	"testing"
+
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+func TestEncoding(t *testing.T) {
+	cases := []struct {
+		rw       Rewriter
+		src, exp string
+	}{
+		{Decode(charmap.Windows1251), "\xcf\xf0\xe8\xe2\xe5\xf2, world", "Привет, world"},
+		{Encode(charmap.Windows1251), "Привет, world", "\xcf\xf0\xe8\xe2\xe5\xf2, world"},
+		{Decode(japanese.ShiftJIS), "\x93\xfa\x96\x7b\x8c\xea", "日本語"},
+		{Encode(japanese.ShiftJIS), "日本語", "\x93\xfa\x96\x7b\x8c\xea"},
+		{Encode(charmap.ISO8859_1), "café ☕", "caf\xe9 \x1a"},
+		{Decode(unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)), "a\x00b\x00", "ab"},
+		{Decode(charmap.Windows1251), "", ""},
+	}
+
+	for i, c := range cases {
+		if res := c.rw.Do([]byte(c.src)); !bytes.Equal(res, []byte(c.exp)) {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+	}
+
+	// growing the destination slice, in a pipeline
+	src := bytes.Repeat([]byte("\x93\xfa"), 1000)
+	rw := Seq(Decode(japanese.ShiftJIS), Replace(Lit("日"), "day"), Encode(charmap.Windows1252))
+
+	if res := rw.Do(src); !bytes.Equal(res, bytes.Repeat([]byte("day"), 1000)) {
+		t.Errorf("Unexpected result: %q", string(res))
+		return
+	}
+}
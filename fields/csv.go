@@ -0,0 +1,86 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package fields
+
+import (
+	"encoding/csv"
+	"io"
+
+	"github.com/maxim2266/trw"
+)
+
+// RewriteCSV reads CSV records from the given io.Reader, applies the Rewriter to the field with
+// the specified zero-based column index in every record, and writes the records to the given
+// io.Writer. The input is parsed and the output is encoded by the encoding/csv package, so quoted
+// fields, including those with embedded line breaks, are handled properly, and the results
+// of the rewriting are quoted as necessary. Records may have different numbers of fields;
+// those with fewer fields are written out unchanged. Note that the output is in the canonical
+// encoding/csv form, which may differ from the input in quoting and line terminators even
+// for the records that have not been changed.
+func RewriteCSV(r io.Reader, w io.Writer, col int, rw trw.Rewriter) error {
+	if rw == nil {
+		panic("nil rewriter in fields.RewriteCSV() function")
+	}
+
+	if col < 0 {
+		panic("negative column index in fields.RewriteCSV() function")
+	}
+
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+
+	cw := csv.NewWriter(w)
+
+	var work, spare []byte // rewriter buffers
+
+	for {
+		rec, err := cr.Read()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if col < len(rec) {
+			work, spare = rw(spare[:0], append(work[:0], rec[col]...))
+			rec[col] = string(work)
+		}
+
+		if err = cw.Write(rec); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,86 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package fields
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/maxim2266/trw"
+)
+
+func TestRewriteCSV(t *testing.T) {
+	mask := trw.Replace(trw.Patt(`\d`), "X")
+
+	cases := []struct {
+		src, exp string
+		col      int
+	}{
+		{"", "", 0},
+		{"a,1,2\nb,3,4\n", "a,X,2\nb,X,4\n", 1},
+		{"a,\"1,2\",3\n", "a,\"X,X\",3\n", 1},
+		{"a,\"1\n2\",3\nb,4\n", "a,\"X\nX\",3\nb,X\n", 1},
+		{"a,1\nb\n", "a,X\nb\n", 1},
+		{"\"a\",1\r\n", "a,X\n", 1},
+	}
+
+	for i, c := range cases {
+		var buf bytes.Buffer
+
+		if err := RewriteCSV(strings.NewReader(c.src), &buf, c.col, mask); err != nil {
+			t.Errorf("[%d] Unexpected error: %s", i, err)
+			return
+		}
+
+		if res := buf.String(); res != c.exp {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, res, c.exp)
+			return
+		}
+	}
+
+	// re-encoding of the rewritten values
+	var buf bytes.Buffer
+
+	if err := RewriteCSV(strings.NewReader("a,x\n"), &buf, 1, trw.Replace(trw.Lit("x"), "\"1\",2")); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if res, exp := buf.String(), "a,\"\"\"1\"\",2\"\n"; res != exp {
+		t.Errorf("Unexpected result: %q instead of %q", res, exp)
+		return
+	}
+
+	// invalid input
+	if err := RewriteCSV(strings.NewReader("a,\"b\n"), &buf, 1, mask); err == nil {
+		t.Error("Missing error")
+		return
+	}
+}
@@ -0,0 +1,209 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+// Package fields provides trw.Rewriters that operate on the individual fields of delimiter-separated
+// text, like TSV or CSV.
+package fields
+
+import (
+	"bytes"
+
+	"github.com/maxim2266/trw"
+)
+
+// Field creates a Rewriter that applies the given Rewriter to the field with the specified
+// zero-based index in every line of the delimiter-separated text, like TSV. Lines with fewer
+// fields are left intact. There is no quoting, so fields never contain the delimiter, and the inner
+// Rewriter must not introduce delimiters or line breaks. A carriage return before the newline
+// is not considered part of the last field. For CSV-style quoting see QuotedField().
+func Field(delim byte, index int, rw trw.Rewriter) trw.Rewriter {
+	return fieldRewriter(delim, index, rw, false, "Field")
+}
+
+// QuotedField creates a Rewriter like Field(), but the fields may be enclosed in double quotes,
+// with a double quote inside the field written as two double quotes, as in RFC 4180. Quoted fields
+// may contain delimiters and line breaks. The inner Rewriter is applied to the unquoted content
+// of the field, and the result is quoted if the original field was quoted, or if the result
+// contains the delimiter, a double quote, or a line break.
+func QuotedField(delim byte, index int, rw trw.Rewriter) trw.Rewriter {
+	return fieldRewriter(delim, index, rw, true, "QuotedField")
+}
+
+func fieldRewriter(delim byte, index int, rw trw.Rewriter, quoted bool, fn string) trw.Rewriter {
+	if rw == nil {
+		panic("nil rewriter in fields." + fn + "() function")
+	}
+
+	if index < 0 {
+		panic("negative field index in fields." + fn + "() function")
+	}
+
+	if delim == '\n' || delim == '\r' || (quoted && delim == '"') {
+		panic("invalid delimiter in fields." + fn + "() function")
+	}
+
+	return func(dest, src []byte) ([]byte, []byte) {
+		if len(src) > cap(dest) {
+			dest = make([]byte, 0, len(src)+len(src)/5) // +20%
+		}
+
+		dest = dest[:0]
+
+		var work, spare []byte // inner rewriter buffers
+
+		done := 0 // src[:done] has been processed
+
+		for i := 0; i < len(src); {
+			start, end, next := findField(src, i, delim, index, quoted)
+
+			if start >= 0 {
+				field := src[start:end]
+				q := quoted && isQuoted(field)
+
+				if q {
+					work = unquote(work[:0], field)
+				} else {
+					work = append(work[:0], field...)
+				}
+
+				work, spare = rw(spare[:0], work)
+
+				dest = append(dest, src[done:start]...)
+				dest = appendField(dest, work, quoted && (q || needsQuotes(work, delim)))
+				done = end
+			}
+
+			i = next
+		}
+
+		return append(dest, src[done:]...), src
+	}
+}
+
+// findField scans the line starting at s[i], returning the bounds of the field with the given index
+// (or -1, -1 if there is no such field), and the start of the next line.
+func findField(s []byte, i int, delim byte, index int, quoted bool) (start, end, next int) {
+	start, end = -1, -1
+
+	for k := 0; ; k++ {
+		j := i
+
+		if quoted && j < len(s) && s[j] == '"' {
+			// skip the quoted part
+			for j++; j < len(s); j++ {
+				if s[j] == '"' {
+					if j+1 < len(s) && s[j+1] == '"' {
+						j++
+						continue
+					}
+
+					j++
+					break
+				}
+			}
+		}
+
+		// the rest of the field
+		for j < len(s) && s[j] != delim && s[j] != '\n' {
+			j++
+		}
+
+		last := j == len(s) || s[j] == '\n'
+
+		if k == index {
+			start, end = i, j
+
+			if last && end > start && s[end-1] == '\r' {
+				end--
+			}
+		}
+
+		if last {
+			if j < len(s) {
+				j++
+			}
+
+			return start, end, j
+		}
+
+		i = j + 1
+	}
+}
+
+func isQuoted(field []byte) bool {
+	return len(field) >= 2 && field[0] == '"' && field[len(field)-1] == '"'
+}
+
+// unquote appends to dest the content of the quoted field.
+func unquote(dest, field []byte) []byte {
+	field = field[1 : len(field)-1]
+
+	for {
+		k := bytes.Index(field, []byte(`""`))
+
+		if k < 0 {
+			return append(dest, field...)
+		}
+
+		dest = append(dest, field[:k+1]...)
+		field = field[k+2:]
+	}
+}
+
+func needsQuotes(field []byte, delim byte) bool {
+	for _, c := range field {
+		if c == delim || c == '"' || c == '\n' || c == '\r' {
+			return true
+		}
+	}
+
+	return false
+}
+
+// appendField appends the field to dest, quoting it as necessary.
+func appendField(dest, field []byte, quote bool) []byte {
+	if !quote {
+		return append(dest, field...)
+	}
+
+	dest = append(dest, '"')
+
+	for {
+		k := bytes.IndexByte(field, '"')
+
+		if k < 0 {
+			break
+		}
+
+		dest = append(dest, field[:k+1]...)
+		dest = append(dest, '"')
+		field = field[k+1:]
+	}
+
+	return append(append(dest, field...), '"')
+}
@@ -0,0 +1,82 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package fields
+
+import (
+	"testing"
+
+	"github.com/maxim2266/trw"
+)
+
+func TestField(t *testing.T) {
+	mask := trw.Replace(trw.Patt(`\d`), "X")
+
+	cases := []struct {
+		src, exp string
+		index    int
+	}{
+		{"", "", 0},
+		{"a1\tb2\tc3\n", "a1\tb2\tcX\n", 2},
+		{"a1\tb2\tc3\nd4\te5\n", "a1\tbX\tc3\nd4\teX\n", 1},
+		{"a1\tb2\nd4\n", "a1\tbX\nd4\n", 1},
+		{"a1\tb2\r\nd4\te5", "a1\tbX\r\nd4\teX", 1},
+		{"12\t34", "XX\t34", 0},
+		{"\t\t\n", "\t\t\n", 1},
+		{"\"1\t2\"\t3", "\"1\tX\"\t3", 1},
+	}
+
+	for i, c := range cases {
+		if res := Field('\t', c.index, mask).Do([]byte(c.src)); string(res) != c.exp {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+	}
+}
+
+func TestQuotedField(t *testing.T) {
+	cases := []struct {
+		rw       trw.Rewriter
+		src, exp string
+	}{
+		{trw.Replace(trw.Patt(`\d`), "X"), "a,1,2\nb,3,4\n", "a,X,2\nb,X,4\n"},
+		{trw.Replace(trw.Patt(`\d`), "X"), "a,\"1,2\",3\n", "a,\"X,X\",3\n"},
+		{trw.Replace(trw.Patt(`\d`), "X"), "a,\"1\n2\",3\nb,4,5", "a,\"X\nX\",3\nb,X,5"},
+		{trw.Replace(trw.Lit("x"), "\"y\""), "a,\"x\"\"z\",b", "a,\"\"\"y\"\"\"\"z\",b"},
+		{trw.Replace(trw.Lit("x"), ","), "a,x,b", "a,\",\",b"},
+		{trw.Delete(trw.Lit("\"")), "a,\"q\"\"\",b\r\n", "a,\"q\",b\r\n"},
+		{trw.Delete(trw.Lit("a")), "x,\"aa\"\r\n", "x,\"\"\r\n"},
+	}
+
+	for i, c := range cases {
+		if res := QuotedField(',', 1, c.rw).Do([]byte(c.src)); string(res) != c.exp {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+	}
+}
@@ -0,0 +1,241 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// RewriteFile applies the Rewriter to the content of the specified file, and replaces the file
+// with the result if the content has changed. The replacement is atomic: the result is first
+// written to a temporary file in the same directory, which is then renamed over the original,
+// preserving its permission bits. A symbolic link is followed, and it is the target file that
+// gets replaced (and backed up), so the link stays intact. The function returns true if the file
+// has been changed. With WithBackup() and WithJournal() options the original content is also saved
+// before the file is replaced. With Verify() option the file is left intact if the verification fails.
+func RewriteFile(path string, rw Rewriter, opts ...Option) (changed bool, err error) {
+	o := makeOptions(opts)
+
+	if path, err = filepath.EvalSymlinks(path); err != nil {
+		return
+	}
+
+	info, err := os.Stat(path)
+
+	if err != nil {
+		return
+	}
+
+	src, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return
+	}
+
+	// the source may be modified in-place, so keep the original for comparison
+	res, err := rw.DoChecked(append([]byte(nil), src...), opts...)
+
+	if err != nil || bytes.Equal(res, src) {
+		return
+	}
+
+	perm := info.Mode().Perm()
+
+	if o.backup {
+		if err = writeFileAtomic(path+".bak", src, perm); err != nil {
+			return
+		}
+	}
+
+	if len(o.journal) > 0 {
+		if err = journalFile(o.journal, path, src, perm); err != nil {
+			return
+		}
+	}
+
+	if err = writeFileAtomic(path, res, perm); err != nil {
+		return
+	}
+
+	return true, nil
+}
+
+// writeFileAtomic replaces the content of the specified file via a temporary file and rename.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) (err error) {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+
+	if err != nil {
+		return
+	}
+
+	// cleanup on error
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err = tmp.Write(data); err != nil {
+		return
+	}
+
+	if err = tmp.Chmod(perm); err != nil {
+		return
+	}
+
+	if err = tmp.Sync(); err != nil {
+		return
+	}
+
+	if err = tmp.Close(); err != nil {
+		return
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// Rollback reverts all the file changes recorded to the journal in the given directory
+// (see WithJournal() option), in the reverse order. The journal itself is left intact.
+func Rollback(journal string) error {
+	file, err := os.Open(filepath.Join(journal, journalIndex))
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	var recs []journalRecord
+
+	for dec := json.NewDecoder(file); ; {
+		var rec journalRecord
+
+		if err = dec.Decode(&rec); err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		recs = append(recs, rec)
+	}
+
+	for i := len(recs) - 1; i >= 0; i-- {
+		rec := &recs[i]
+		data, err := ioutil.ReadFile(filepath.Join(journal, rec.Backup))
+
+		if err != nil {
+			return err
+		}
+
+		if err = writeFileAtomic(rec.Path, data, rec.Mode); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// journal index file name
+const journalIndex = "index.jsonl"
+
+// journalRecord is an entry in the journal index.
+type journalRecord struct {
+	Path   string      `json:"path"`   // absolute path to the file
+	Backup string      `json:"backup"` // name of the copy of the original file in the journal
+	Mode   os.FileMode `json:"mode"`   // permission bits
+}
+
+// journalFile records the original content of the given file to the journal.
+func journalFile(journal, path string, data []byte, perm os.FileMode) (err error) {
+	rec := journalRecord{Mode: perm}
+
+	if rec.Path, err = filepath.Abs(path); err != nil {
+		return
+	}
+
+	// copy of the original
+	tmp, err := ioutil.TempFile(journal, filepath.Base(path)+".*.orig")
+
+	if err != nil {
+		return
+	}
+
+	// cleanup on error
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	rec.Backup = filepath.Base(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		return
+	}
+
+	if err = tmp.Sync(); err != nil {
+		return
+	}
+
+	if err = tmp.Close(); err != nil {
+		return
+	}
+
+	// index record, written with a single append
+	line, err := json.Marshal(&rec)
+
+	if err != nil {
+		return
+	}
+
+	index, err := os.OpenFile(filepath.Join(journal, journalIndex), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+
+	if err != nil {
+		return
+	}
+
+	if _, err = index.Write(append(line, '\n')); err == nil {
+		err = index.Sync()
+	}
+
+	if e := index.Close(); err == nil {
+		err = e
+	}
+
+	return
+}
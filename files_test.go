@@ -0,0 +1,296 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRewriteFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trw")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "file.txt")
+
+	if err = ioutil.WriteFile(path, []byte("aaa bbb aaa"), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	rw := Delete(Lit("a"))
+
+	cases := []struct {
+		exp     string
+		changed bool
+	}{
+		{" bbb ", true},
+		{" bbb ", false},
+	}
+
+	for i, c := range cases {
+		changed, err := RewriteFile(path, rw)
+
+		if err != nil {
+			t.Errorf("[%d] Unexpected error: %s", i, err)
+			return
+		}
+
+		if changed != c.changed {
+			t.Errorf("[%d] Unexpected change flag: %v", i, changed)
+			return
+		}
+
+		checkFile(t, path, c.exp, 0640)
+	}
+
+	// no temporary files left behind
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("Unexpected number of files: %d", len(files))
+		return
+	}
+
+	if _, err = RewriteFile(filepath.Join(dir, "none"), rw); !os.IsNotExist(err) {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+}
+
+func TestRewriteFileBackup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trw")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "file.txt")
+
+	if err = ioutil.WriteFile(path, []byte("aaa bbb"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = RewriteFile(path, Delete(Lit("a")), WithBackup()); err != nil {
+		t.Error(err)
+		return
+	}
+
+	checkFile(t, path, " bbb", 0600)
+	checkFile(t, path+".bak", "aaa bbb", 0600)
+}
+
+func TestRewriteFileSymlink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trw")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path, link := filepath.Join(dir, "file.txt"), filepath.Join(dir, "link.txt")
+
+	if err = ioutil.WriteFile(path, []byte("aaa bbb"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = os.Symlink("file.txt", link); err != nil {
+		t.Skip(err)
+	}
+
+	if _, err = RewriteFile(link, Delete(Lit("a")), WithBackup()); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("Symbolic link replaced: %v", err)
+		return
+	}
+
+	checkFile(t, path, " bbb", 0600)
+	checkFile(t, path+".bak", "aaa bbb", 0600)
+}
+
+func TestRewriteFileVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trw")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "file.txt")
+
+	if err = ioutil.WriteFile(path, []byte("aaa bbb"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	changed, err := RewriteFile(path, Delete(Lit("a")), Verify([]Matcher{Lit("b")}))
+
+	if _, ok := err.(*ResidualError); !ok || changed {
+		t.Errorf("Unexpected result: %v, error %v", changed, err)
+		return
+	}
+
+	checkFile(t, path, "aaa bbb", 0600)
+}
+
+func TestRollback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trw")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	journal := filepath.Join(dir, "journal")
+
+	if err = os.Mkdir(journal, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	files := []struct {
+		name, data string
+		perm       os.FileMode
+	}{
+		{"a.txt", "aaa bbb", 0644},
+		{"b.txt", "bbb ccc", 0600},
+		{"c.txt", "ccc aaa", 0640},
+	}
+
+	for _, f := range files {
+		if err = ioutil.WriteFile(filepath.Join(dir, f.name), []byte(f.data), f.perm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	steps := []struct {
+		name string
+		rw   Rewriter
+	}{
+		{"a.txt", Delete(Lit("a"))},
+		{"b.txt", Delete(Lit("a"))}, // no change
+		{"c.txt", Replace(Lit("c"), "x")},
+		{"a.txt", Replace(Lit("b"), "y")},
+	}
+
+	for i, step := range steps {
+		if _, err = RewriteFile(filepath.Join(dir, step.name), step.rw, WithJournal(journal)); err != nil {
+			t.Errorf("[%d] Unexpected error: %s", i, err)
+			return
+		}
+	}
+
+	checkFile(t, filepath.Join(dir, "a.txt"), " yyy", 0644)
+	checkFile(t, filepath.Join(dir, "c.txt"), "xxx aaa", 0640)
+
+	if err = Rollback(journal); err != nil {
+		t.Error(err)
+		return
+	}
+
+	for _, f := range files {
+		checkFile(t, filepath.Join(dir, f.name), f.data, f.perm)
+	}
+
+	if err = Rollback(filepath.Join(dir, "none")); !os.IsNotExist(err) {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+}
+
+func TestRewriteFileJournalError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trw")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	journal := filepath.Join(dir, "journal")
+
+	// a directory in place of the index makes writing the journal fail
+	if err = os.MkdirAll(filepath.Join(journal, journalIndex), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "file.txt")
+
+	if err = ioutil.WriteFile(path, []byte("aaa bbb"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if changed, err := RewriteFile(path, Delete(Lit("a")), WithJournal(journal)); err == nil || changed {
+		t.Errorf("Unexpected result: %v, error %v", changed, err)
+		return
+	}
+
+	checkFile(t, path, "aaa bbb", 0600)
+
+	// no backup copy left behind
+	if files, _ := ioutil.ReadDir(journal); len(files) != 1 {
+		t.Errorf("Unexpected number of files: %d", len(files))
+		return
+	}
+}
+
+func checkFile(t *testing.T, path, exp string, perm os.FileMode) {
+	t.Helper()
+
+	data, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != exp {
+		t.Fatalf("Unexpected content of %q: %q instead of %q", path, string(data), exp)
+	}
+
+	info, err := os.Stat(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Mode().Perm() != perm {
+		t.Fatalf("Unexpected permissions of %q: %v instead of %v", path, info.Mode().Perm(), perm)
+	}
+}
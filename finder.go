@@ -0,0 +1,298 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"bytes"
+	"regexp"
+	"regexp/syntax"
+)
+
+// Finder is a type of a function that, given a byte slice and an offset, returns the index pair
+// of the first match at or after the offset, or nil if there is no match. Unlike Matcher,
+// a Finder allows for the matches to be consumed one at a time, so the memory required
+// for processing does not depend on the number of matches. A Finder must not depend on the
+// content of the slice before the offset, as that may be modified between the invocations.
+type Finder = func(s []byte, from int) []int
+
+// FindLit creates a Finder for the given string literal.
+func FindLit(patt string) Finder {
+	if len(patt) == 0 {
+		panic("empty pattern in trw.FindLit() function")
+	}
+
+	return func(s []byte, from int) []int {
+		if i := bytes.Index(s[from:], []byte(patt)); i >= 0 {
+			i += from
+			return []int{i, i + len(patt)}
+		}
+
+		return nil
+	}
+}
+
+// FindPatt creates a Finder for the given regular expression pattern.
+func FindPatt(patt string) Finder {
+	if len(patt) == 0 {
+		panic("empty pattern in trw.FindPatt() function")
+	}
+
+	return FindRe(regexp.MustCompile(patt))
+}
+
+// FindRe creates a Finder for the given regular expression object. The regular expression
+// is applied to the part of the input starting at the offset, hence anchors and word
+// boundaries treat the offset as the beginning of the text.
+func FindRe(re *regexp.Regexp) Finder {
+	if re == nil {
+		panic("nil regular expression object in trw.FindRe() function")
+	}
+
+	return func(s []byte, from int) []int {
+		if m := re.FindIndex(s[from:]); m != nil {
+			m[0] += from
+			m[1] += from
+			return m
+		}
+
+		return nil
+	}
+}
+
+// DeleteLazy creates a Rewriter that removes all the matches produced by the given Finder,
+// consuming the matches one at a time.
+func DeleteLazy(find Finder) Rewriter {
+	if find == nil {
+		panic("nil finder in trw.DeleteLazy() function")
+	}
+
+	return func(unused, src []byte) ([]byte, []byte) {
+		return deleteAll(src, &matches{find: find, src: src}), unused
+	}
+}
+
+// ReplaceLazy creates a Rewriter that substitutes all the matches produced by the given Finder
+// with the specified string, consuming the matches one at a time.
+func ReplaceLazy(find Finder, subst string) Rewriter {
+	if find == nil {
+		panic("nil finder in trw.ReplaceLazy() function")
+	}
+
+	if len(subst) == 0 {
+		return DeleteLazy(find)
+	}
+
+	return func(dest, src []byte) ([]byte, []byte) {
+		return replaceAll(dest, src, subst, &matches{find: find, src: src}, len(src))
+	}
+}
+
+// lazyMatches returns a function that creates an iterator over the matches of the given literal or
+// regular expression (exactly one of which must be set), finding them one at a time, or nil if that
+// is not possible. Since FindRe() treats the offset as the beginning of the text, patterns with
+// anchors or word boundaries are not converted.
+func lazyMatches(lit string, re *regexp.Regexp) func([]byte) *matches {
+	if len(lit) > 0 {
+		p := []byte(lit)
+
+		return func(src []byte) *matches { return &matches{lit: p, src: src} }
+	}
+
+	for _, inst := range compileProg(re.String()).Inst {
+		if inst.Op == syntax.InstEmptyWidth {
+			return nil
+		}
+	}
+
+	find := FindRe(re)
+
+	return func(src []byte) *matches { return &matches{find: find, src: src} }
+}
+
+// matches is an iterator over either the matches produced by a Finder, or a slice of matches
+// produced by a Matcher, possibly refilled from successive windows of the source.
+type matches struct {
+	find  Finder
+	lit   []byte // literal to find instead of calling the Finder, or nil
+	buf   [2]int // the last match of the literal, overwritten by every next() call
+	src   []byte
+	from  int
+	empty bool // last match was empty
+	ms    [][]int
+	win   *window // windowed Matcher refilling the list of matches, or nil
+	count int     // number of matches produced so far
+}
+
+// next returns the next match, or nil if there are no more matches.
+func (it *matches) next() []int {
+	m := it.advance()
+
+	if m != nil {
+		it.count++
+	}
+
+	return m
+}
+
+func (it *matches) advance() (m []int) {
+	if it.lit != nil {
+		i := bytes.Index(it.src[it.from:], it.lit)
+
+		if i < 0 {
+			return nil
+		}
+
+		it.buf[0] = it.from + i
+		it.buf[1] = it.buf[0] + len(it.lit)
+		it.from = it.buf[1]
+
+		return it.buf[:]
+	}
+
+	if it.find == nil {
+		if len(it.ms) == 0 && it.win != nil {
+			it.win.fill(it)
+		}
+
+		if len(it.ms) > 0 {
+			m, it.ms = it.ms[0], it.ms[1:]
+		}
+
+		return
+	}
+
+	if it.from > len(it.src) {
+		return nil
+	}
+
+	m = it.find(it.src, it.from)
+
+	// ignore empty match abutting the preceding match, as in regexp
+	if m != nil && m[0] == m[1] && m[0] == it.from && it.from > 0 && !it.empty {
+		if it.from == len(it.src) {
+			return nil
+		}
+
+		it.from += runeLen(it.src[it.from:])
+
+		m = it.find(it.src, it.from)
+	}
+
+	if m != nil {
+		it.from, it.empty = m[1], m[0] == m[1]
+
+		if it.empty { // resume at the next rune
+			if it.from == len(it.src) {
+				it.from++
+			} else {
+				it.from += runeLen(it.src[it.from:])
+			}
+		}
+	}
+
+	return
+}
+
+// resultSize returns the size of the result of substituting the given string for all the matches
+// in the source of the given size. For the matches found one at a time the size is not known
+// in advance, and the source size is returned.
+func (it *matches) resultSize(n int, subst string) int {
+	if it.find == nil && it.lit == nil && it.win == nil {
+		for _, m := range it.ms {
+			n += len(subst) - (m[1] - m[0])
+		}
+	}
+
+	return n
+}
+
+// deleteAll removes all the matches from the source slice, in-place.
+func deleteAll(src []byte, it *matches) []byte {
+	m := it.next()
+
+	if m == nil {
+		return src
+	}
+
+	i, j := m[0], m[1]
+
+	for m = it.next(); m != nil; m = it.next() {
+		i += copy(src[i:], src[j:m[0]])
+		j = m[1]
+	}
+
+	if j < len(src) {
+		i += copy(src[i:], src[j:])
+	}
+
+	return src[:i]
+}
+
+// replaceAll substitutes all the matches in the source slice with the given string. The replacement
+// is done in-place while the matches are not shorter than the string, and then continues
+// in the destination slice, reallocated if it cannot hold the expected result size.
+func replaceAll(dest, src []byte, subst string, it *matches, size int) ([]byte, []byte) {
+	m := it.next()
+
+	if m == nil {
+		return src, dest
+	}
+
+	// in-place copy with replacement
+	i, j := m[0], m[0]
+
+	for ; m != nil && m[1]-m[0] >= len(subst); m = it.next() {
+		i += copy(src[i:], src[j:m[0]])
+		i += copy(src[i:], subst)
+		j = m[1]
+	}
+
+	if m == nil {
+		if j < len(src) {
+			i += copy(src[i:], src[j:])
+		}
+
+		return src[:i], dest
+	}
+
+	// reallocate destination slice if necessary
+	if size > cap(dest) {
+		dest = make([]byte, 0, size+size/5) // +20%
+	}
+
+	// copy with replacement
+	dest = append(dest[:0], src[:i]...)
+
+	for ; m != nil; m = it.next() {
+		dest = append(append(dest, src[j:m[0]]...), subst...)
+		j = m[1]
+	}
+
+	return append(dest, src[j:]...), src
+}
@@ -0,0 +1,118 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+)
+
+func TestDeleteLazy(t *testing.T) {
+	cases := []struct {
+		src, patt, exp string
+	}{
+		{"abc", "a", "bc"},
+		{"abc", "c", "ab"},
+		{"abc", "z", "abc"},
+		{"aa bb cc aa bb cc", "bb ", "aa cc aa cc"},
+		{"abcabc", "abc", ""},
+	}
+
+	for i, c := range cases {
+		for k, rw := range [...]Rewriter{DeleteLazy(FindLit(c.patt)), DeleteLazy(FindPatt(c.patt))} {
+			if res := rw.Do([]byte(c.src)); !bytes.Equal(res, []byte(c.exp)) {
+				t.Errorf("[%d, %d] Unexpected result: %q instead of %q", i, k, string(res), c.exp)
+				return
+			}
+		}
+	}
+}
+
+func TestReplaceLazy(t *testing.T) {
+	cases := []struct {
+		src, patt, repl, exp string
+	}{
+		{"abc", "a", "Z", "Zbc"},
+		{"abc", "z", "Z", "abc"},
+		{"aa bb cc aa bb cc", "bb", "Z", "aa Z cc aa Z cc"},
+		{"aa bb cc aa bb cc", "bb", "ZZZ", "aa ZZZ cc aa ZZZ cc"},
+		{"aaa b aa b a", "a+", "XX", "XX b XX b XX"},
+		{"aaa b aa b a", "a*", "-", "- -b- - -b- -"},
+	}
+
+	for i, c := range cases {
+		if res := ReplaceLazy(FindPatt(c.patt), c.repl).Do([]byte(c.src)); !bytes.Equal(res, []byte(c.exp)) {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+	}
+
+	rw := Seq(
+		ReplaceLazy(FindLit("a"), "XX"),
+		ReplaceLazy(FindLit("XX"), "Y"),
+		Replace(Lit("Y"), "ZZZ"),
+	)
+
+	if res := rw.Do([]byte("a b a")); string(res) != "ZZZ b ZZZ" {
+		t.Errorf("Unexpected result: %q", string(res))
+		return
+	}
+}
+
+func TestLazyMatches(t *testing.T) {
+	cases := []struct {
+		lit, patt string
+		lazy      bool
+	}{
+		{"a", "", true},
+		{"", `a+`, true},
+		{"", `\bx`, false},
+		{"", `(?m)^x`, false},
+	}
+
+	for i, c := range cases {
+		var re *regexp.Regexp
+
+		if len(c.patt) > 0 {
+			re = regexp.MustCompile(c.patt)
+		}
+
+		if lazy := lazyMatches(c.lit, re) != nil; lazy != c.lazy {
+			t.Errorf("[%d] Unexpected result: %v", i, lazy)
+			return
+		}
+	}
+
+	// patterns with word boundaries keep their meaning in pipeline stages
+	if res := (Pipeline{{Op: OpDelete, Patt: `\bx`}}).Rewriter().Do([]byte("xx x")); string(res) != "x " {
+		t.Errorf("Unexpected result: %q", string(res))
+		return
+	}
+}
@@ -0,0 +1,177 @@
+//go:build go1.18
+
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+)
+
+// guarded returns a copy of the given slice followed by a guard area in its spare capacity,
+// to detect writes beyond the slice length.
+func guarded(s []byte) []byte {
+	g := make([]byte, len(s), len(s)+len(fuzzGuard))
+
+	copy(g, s)
+	copy(g[len(s):cap(g)], fuzzGuard)
+
+	return g
+}
+
+func checkGuard(t *testing.T, s []byte, n int) {
+	t.Helper()
+
+	if g := s[n:cap(s)]; !bytes.Equal(g, []byte(fuzzGuard)) {
+		t.Fatalf("Guard area overwritten: %q", g)
+	}
+}
+
+const fuzzGuard = "\x00GUARD\xff"
+
+func FuzzDeleteLit(f *testing.F) {
+	f.Add([]byte("aabbaabb"), "ab")
+	f.Add([]byte("xxx"), "xx")
+
+	f.Fuzz(func(t *testing.T, src []byte, lit string) {
+		if len(lit) == 0 {
+			return
+		}
+
+		checkRewrite(t, Delete(Lit(lit)), src, bytes.Replace(src, []byte(lit), nil, -1))
+	})
+}
+
+func FuzzReplaceLit(f *testing.F) {
+	f.Add([]byte("aabbaabb"), "ab", "XYZ")
+	f.Add([]byte("xxx"), "x", "")
+	f.Add([]byte("xxx"), "xx", "y")
+
+	f.Fuzz(func(t *testing.T, src []byte, lit, subst string) {
+		if len(lit) == 0 {
+			return
+		}
+
+		checkRewrite(t, Replace(Lit(lit), subst), src, bytes.Replace(src, []byte(lit), []byte(subst), -1))
+	})
+}
+
+// regular expressions for fuzzing, none of them matching the empty string
+var fuzzRegexps = []*regexp.Regexp{
+	regexp.MustCompile(`[0-9]+`),
+	regexp.MustCompile(`a|ab`),
+	regexp.MustCompile(`(\w+)@(\w+)`),
+	regexp.MustCompile(`\s+`),
+	regexp.MustCompile(`x.y`),
+	regexp.MustCompile(`(?m)^#.*$`),
+}
+
+func FuzzReplaceRe(f *testing.F) {
+	f.Add([]byte("abc 123 x@y"), uint8(0), "<$0>")
+	f.Add([]byte("ab a aab"), uint8(1), "")
+	f.Add([]byte("me@host you@there"), uint8(2), "${2}:${1}")
+
+	f.Fuzz(func(t *testing.T, src []byte, k uint8, repl string) {
+		re := fuzzRegexps[int(k)%len(fuzzRegexps)]
+
+		checkRewrite(t, ReplaceRe(re, []byte(repl)), src, re.ReplaceAllLiteral(src, []byte(repl)))
+		checkRewrite(t, DeleteRe(re), src, re.ReplaceAllLiteral(src, nil))
+	})
+}
+
+func FuzzExpand(f *testing.F) {
+	f.Add([]byte("me@host you@there"), uint8(2), "${2}:${1}")
+	f.Add([]byte("abc 123"), uint8(0), "[$0]")
+
+	f.Fuzz(func(t *testing.T, src []byte, k uint8, subst string) {
+		re := fuzzRegexps[int(k)%len(fuzzRegexps)]
+
+		checkRewrite(t, ExpandRe(re, subst), src, re.ReplaceAll(src, []byte(subst)))
+	})
+}
+
+// regular expressions for fuzzing, all of them matching the empty string; the ones without anchors
+// and word boundaries are found lazily, while the rest go through the list of matches
+var fuzzEmptyRegexps = []*regexp.Regexp{
+	regexp.MustCompile(`a*`),
+	regexp.MustCompile(`x|`),
+	regexp.MustCompile(`b?c?`),
+	regexp.MustCompile(`^`),
+	regexp.MustCompile(`\b`),
+	regexp.MustCompile(`(?m)^|$`),
+	regexp.MustCompile(`\B`),
+}
+
+func FuzzEmptyMatch(f *testing.F) {
+	f.Add([]byte("baaac"), uint8(0), "<$0>")
+	f.Add([]byte("xyxx"), uint8(1), "-")
+	f.Add([]byte("abcbc\xffc"), uint8(2), "")
+	f.Add([]byte("one\ntwo"), uint8(3), "#")
+	f.Add([]byte("ab, cd.e"), uint8(4), "|")
+	f.Add([]byte("a\n\nb\n"), uint8(5), "[$0]")
+	f.Add([]byte("ab, cd"), uint8(6), "_")
+
+	f.Fuzz(func(t *testing.T, src []byte, k uint8, subst string) {
+		re := fuzzEmptyRegexps[int(k)%len(fuzzEmptyRegexps)]
+		patt := re.String()
+
+		checkRewrite(t, Pipeline{{Op: OpDelete, Patt: patt}}.Rewriter(), src, re.ReplaceAllLiteral(src, nil))
+		checkRewrite(t, Pipeline{{Op: OpReplace, Patt: patt, Subst: subst}}.Rewriter(), src,
+			re.ReplaceAllLiteral(src, []byte(subst)))
+		checkRewrite(t, Pipeline{{Op: OpExpand, Patt: patt, Subst: subst}}.Rewriter(), src,
+			re.ReplaceAll(src, []byte(subst)))
+
+		// FindRe() treats the offset as the beginning of the text, so only the patterns
+		// without anchors and word boundaries match as in regexp
+		if lazyMatches("", re) != nil {
+			checkRewrite(t, DeleteLazy(FindRe(re)), src, re.ReplaceAllLiteral(src, nil))
+			checkRewrite(t, ReplaceLazy(FindRe(re), subst), src, re.ReplaceAllLiteral(src, []byte(subst)))
+		}
+	})
+}
+
+// checkRewrite compares the result of the Rewriter against the expected value, both with
+// and without a destination buffer, and checks that nothing is written beyond the source slice
+// (the destination buffer may be used up to its capacity).
+func checkRewrite(t *testing.T, rw Rewriter, src, exp []byte) {
+	t.Helper()
+
+	for _, size := range []int{0, len(src) / 2, 2*len(src) + 10} {
+		s := guarded(src)
+		res, _ := rw(make([]byte, 0, size), s)
+
+		if !bytes.Equal(res, exp) {
+			t.Fatalf("Unexpected result: %q instead of %q", string(res), string(exp))
+		}
+
+		checkGuard(t, s, len(src))
+	}
+}
@@ -0,0 +1,159 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import "strconv"
+
+// Coordinates creates a Matcher for latitude/longitude pairs of signed decimal degrees,
+// like "51.5007, -0.1246" or "40.6892 -74.0445". Both numbers must have at least the given
+// number of decimal places, and be within the valid ranges (±90 for latitude, and ±180 for
+// longitude); the numbers may be separated by a comma, a semicolon, or white space. In each
+// match, the index pair is followed by the locations of the latitude and the longitude.
+// The minimum number of decimals is what tells coordinates from other pairs of numbers,
+// like versions or measurements ("4.5 1.25"); GPS devices typically report 4 to 6 decimals.
+func Coordinates(minDecimals int) Matcher {
+	if minDecimals < 1 {
+		panic("invalid minimum number of decimals in trw.Coordinates() function")
+	}
+
+	return func(s []byte) (ms [][]int) {
+		for i := 0; i < len(s); {
+			if m := coordPair(s, i, minDecimals); m != nil {
+				ms = append(ms, m)
+				i = m[1]
+			} else {
+				i++
+			}
+		}
+
+		return
+	}
+}
+
+// FuzzCoordinates creates a Rewriter that truncates all latitude/longitude pairs (as
+// matched by Coordinates(minDecimals)) to the given number of decimal places. For reference,
+// two decimal places correspond to about 1 km, and one to about 11 km at the equator.
+func FuzzCoordinates(minDecimals, precision int) Rewriter {
+	if minDecimals < 1 {
+		panic("invalid minimum number of decimals in trw.FuzzCoordinates() function")
+	}
+
+	if precision < 0 {
+		panic("negative precision in trw.FuzzCoordinates() function")
+	}
+
+	return rewrite(Coordinates(minDecimals), func(dest, src []byte, m []int) []byte {
+		dest = appendTruncated(dest, src[m[2]:m[3]], precision)
+		dest = append(dest, src[m[3]:m[4]]...)
+		return appendTruncated(dest, src[m[4]:m[5]], precision)
+	})
+}
+
+// coordPair returns the location of the latitude/longitude pair starting at s[i], or nil.
+func coordPair(s []byte, i, minDec int) []int {
+	if i > 0 && (isIdent(s[i-1]) || s[i-1] == '.' || s[i-1] == '-' || s[i-1] == '+') {
+		return nil
+	}
+
+	lat := degrees(s, i, 90, minDec)
+
+	if lat < 0 {
+		return nil
+	}
+
+	// separator
+	j := skipSpaces(s, lat)
+
+	if j < len(s) && (s[j] == ',' || s[j] == ';') {
+		j = skipSpaces(s, j+1)
+	}
+
+	if j == lat {
+		return nil
+	}
+
+	lon := degrees(s, j, 180, minDec)
+
+	if lon < 0 || (lon < len(s) && (isIdent(s[lon]) || s[lon] == '.')) {
+		return nil
+	}
+
+	return []int{i, lon, i, lat, j, lon}
+}
+
+// degrees returns the end of the signed decimal number starting at s[i], if the number
+// has at least minDec decimals and does not exceed the given limit by absolute value,
+// or -1 otherwise.
+func degrees(s []byte, i int, limit float64, minDec int) int {
+	j := i
+
+	if j < len(s) && (s[j] == '-' || s[j] == '+') {
+		j++
+	}
+
+	k := skipDigits(s, j)
+
+	if k == j || k-j > 3 || k == len(s) || s[k] != '.' {
+		return -1
+	}
+
+	end := skipDigits(s, k+1)
+
+	if end-k-1 < minDec {
+		return -1
+	}
+
+	if v, err := strconv.ParseFloat(string(s[i:end]), 64); err != nil || v > limit || v < -limit {
+		return -1
+	}
+
+	return end
+}
+
+// appendTruncated appends to the destination slice the given decimal number with the fractional
+// part truncated to the specified number of digits.
+func appendTruncated(dest, num []byte, prec int) []byte {
+	k := 0
+
+	for num[k] != '.' {
+		k++
+	}
+
+	if prec == 0 {
+		num = num[:k]
+	} else if k+1+prec < len(num) {
+		num = num[:k+1+prec]
+	}
+
+	if num[0] == '-' && isZero(num[1:]) {
+		num = num[1:]
+	}
+
+	return append(dest, num...)
+}
@@ -0,0 +1,57 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFuzzCoordinates(t *testing.T) {
+	cases := []struct {
+		src, exp  string
+		dec, prec int
+	}{
+		{"at 51.500729, -0.124625 now", "at 51.50, -0.12 now", 4, 2},
+		{"(40.689247 -74.044502); (48.8584;2.2945)", "(40.6 -74.0); (48.8;2.2)", 4, 1},
+		{"-0.5,-0.5 +12.1 +13.9", "0,0 +12 +13", 1, 0},
+		{"1.5, 2.5", "1.5, 2.5", 1, 3},
+		{"91.0, 0.5 and 45.0, 181.0 and 10, 20.5 and 10.5,20", "91.0, 0.5 and 45.0, 181.0 and 10, 20.5 and 10.5,20", 1, 0},
+		{"v1.2.3 4.5 1.25 2.75.1 x1.5 2.5", "v1.2.3 4 1 2.75.1 x1.5 2.5", 1, 0},
+		{"v1.2.3 4.5 1.25 2.75.1 x1.5 2.5", "v1.2.3 4.5 1.25 2.75.1 x1.5 2.5", 4, 0},
+		{"size 12.5 x 30.25, at 51.5007 -0.1246 and 51.50 -0.1246", "size 12.5 x 30.25, at 51.5 -0.1 and 51.50 -0.1246", 4, 1},
+	}
+
+	for i, c := range cases {
+		if res := FuzzCoordinates(c.dec, c.prec).Do([]byte(c.src)); !bytes.Equal(res, []byte(c.exp)) {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+	}
+}
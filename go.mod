@@ -1,3 +1,8 @@
 module github.com/maxim2266/trw
 
 go 1.13
+
+require (
+	golang.org/x/net v0.0.0-20210405180319-a5a99cb37ef4
+	golang.org/x/text v0.3.6
+)
@@ -0,0 +1,277 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+)
+
+// IPs creates a Matcher for IPv4 and IPv6 addresses. A port number following an IPv4
+// address (as in "10.0.0.1:80") is not included in the match.
+func IPs() Matcher {
+	return hostMatcher(hostIP, nil)
+}
+
+// Hostnames creates a Matcher for fully qualified domain names, i.e., sequences of at least two
+// dot-separated labels ending in one of the given domain suffixes (like "com" or "example.org"),
+// compared case-insensitively. Without suffixes, a built-in list of common top-level domains is
+// used (see DefaultTLDs). The suffix list is what tells hostnames from dotted file names like
+// "main.go" or "config.yaml". A port number following the name (as in "example.com:443")
+// is not included in the match.
+func Hostnames(suffixes ...string) Matcher {
+	return hostMatcher(hostName, hostSuffixes(suffixes, "Hostnames"))
+}
+
+// DefaultTLDs is the list of top-level domains recognised by Hostnames() and PseudonymizeHosts()
+// when no domain suffixes are given. It contains common generic and country-code domains
+// that rarely clash with file name extensions.
+var DefaultTLDs = []string{
+	"com", "net", "org", "edu", "gov", "mil", "int", "arpa", "info", "biz", "name", "io",
+	"dev", "app", "cloud", "online", "site", "local", "localdomain", "internal", "lan",
+	"corp", "home", "test", "example", "invalid",
+	"au", "br", "ca", "ch", "cn", "de", "eu", "fr", "in", "jp", "nl", "nz", "ru", "se", "uk", "us",
+}
+
+// PseudonymizeHosts creates a Rewriter that substitutes all hostnames and IP addresses with
+// deterministic pseudonyms derived from the given secret seed, so that the same seed always
+// produces the same values. IP addresses are pseudonymized in a prefix-preserving manner,
+// i.e., any two addresses sharing a k-bit prefix are mapped to addresses that also share
+// a k-bit prefix, keeping subnet relationships intact. In hostnames, each label is replaced with
+// a hash of the label and all its parent domains, preserving the top-level domain; for example,
+// "a.example.com" and "b.example.com" still share a common parent domain after the rewrite.
+// Hostnames are recognised by the given domain suffixes, as in Hostnames().
+func PseudonymizeHosts(seed []byte, suffixes ...string) Rewriter {
+	if len(seed) == 0 {
+		panic("empty seed in trw.PseudonymizeHosts() function")
+	}
+
+	key := append([]byte(nil), seed...)
+	sfx := hostSuffixes(suffixes, "PseudonymizeHosts")
+
+	return rewrite(hostMatcher(hostIP|hostName, sfx), func(dest, src []byte, m []int) []byte {
+		if m[2] == hostIP {
+			ip := net.ParseIP(string(src[m[0]:m[1]]))
+
+			if bytes.IndexByte(src[m[0]:m[1]], ':') < 0 {
+				ip = ip.To4()
+			}
+
+			return append(dest, pseudoIP(key, ip).String()...)
+		}
+
+		return appendPseudoHost(dest, key, bytes.ToLower(src[m[0]:m[1]]))
+	})
+}
+
+// host token kinds
+const (
+	hostIP = 1 << iota
+	hostName
+)
+
+// hostSuffixes returns the normalised list of domain suffixes, or DefaultTLDs if the list is empty.
+func hostSuffixes(suffixes []string, fn string) (res [][]byte) {
+	if len(suffixes) == 0 {
+		suffixes = DefaultTLDs
+	}
+
+	res = make([][]byte, len(suffixes))
+
+	for i, s := range suffixes {
+		if res[i] = bytes.ToLower(bytes.Trim([]byte(s), ".")); len(res[i]) == 0 {
+			panic("empty domain suffix in trw." + fn + "() function")
+		}
+	}
+
+	return
+}
+
+// hostMatcher creates a Matcher for IP addresses and/or hostnames, as specified by the kind mask,
+// with hostnames ending in one of the given suffixes. In addition to the index pair, every match
+// holds the kind of the token.
+func hostMatcher(kinds int, suffixes [][]byte) Matcher {
+	return func(s []byte) (ms [][]int) {
+		for i := 0; i < len(s); {
+			if !isHostChar(s[i]) || (i > 0 && (isIdent(s[i-1]) || isHostChar(s[i-1]))) {
+				i++
+				continue
+			}
+
+			// token
+			j := i
+
+			for j < len(s) && isHostChar(s[j]) {
+				j++
+			}
+
+			if j == len(s) || !isIdent(s[j]) {
+				if e, kind := hostToken(s[i:j], suffixes); kind&kinds != 0 {
+					ms = append(ms, []int{i, i + e, kind})
+				}
+			}
+
+			i = j
+		}
+
+		return
+	}
+}
+
+// hostToken classifies the given token, returning the length of the IP address or hostname
+// at the start of the token, and the token kind.
+func hostToken(s []byte, suffixes [][]byte) (int, int) {
+	s = bytes.TrimRight(s, ".:-")
+
+	if len(s) == 0 {
+		return 0, 0
+	}
+
+	if bytes.IndexAny(s, ".:") >= 0 && net.ParseIP(string(s)) != nil {
+		return len(s), hostIP
+	}
+
+	// strip port number, if any
+	if i := bytes.IndexByte(s, ':'); i > 0 {
+		s = s[:i]
+
+		if net.ParseIP(string(s)) != nil {
+			return len(s), hostIP
+		}
+	}
+
+	if isHostname(s) && hasSuffix(s, suffixes) {
+		return len(s), hostName
+	}
+
+	return 0, 0
+}
+
+func isHostname(s []byte) bool {
+	labels := bytes.Split(s, []byte("."))
+
+	if len(labels) < 2 {
+		return false
+	}
+
+	for _, label := range labels {
+		if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+
+		for _, c := range label {
+			if !isAlnum(c) && c != '-' {
+				return false
+			}
+		}
+	}
+
+	// top-level domain
+	for _, c := range labels[len(labels)-1] {
+		if isDigit(c) || c == '-' {
+			return false
+		}
+	}
+
+	return len(labels[len(labels)-1]) > 1
+}
+
+// hasSuffix checks if the given hostname ends in one of the domain suffixes.
+func hasSuffix(s []byte, suffixes [][]byte) bool {
+	for _, sfx := range suffixes {
+		if n := len(s) - len(sfx); n > 0 && s[n-1] == '.' && bytes.EqualFold(s[n:], sfx) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isHostChar(c byte) bool {
+	return isAlnum(c) || c == '.' || c == ':' || c == '-'
+}
+
+func isAlnum(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// pseudoIP maps the given IP address to its pseudonym, bit by bit, where each bit of the result
+// is the original bit XOR-ed with a pseudo-random function of all the preceding bits.
+func pseudoIP(key []byte, ip net.IP) net.IP {
+	mac := hmac.New(sha256.New, key)
+	prefix := make([]byte, len(ip)+2)
+	res := make(net.IP, len(ip))
+	sum := make([]byte, 0, sha256.Size)
+
+	prefix[0] = byte(len(ip))
+
+	for i := 0; i < len(ip)*8; i++ {
+		prefix[1] = byte(i)
+
+		mac.Reset()
+		mac.Write(prefix[:2+(i+7)/8])
+
+		mask := byte(0x80) >> uint(i%8)
+		bit := ip[i/8] & mask
+
+		if mac.Sum(sum[:0])[0]&1 != 0 {
+			res[i/8] |= mask ^ bit
+		} else {
+			res[i/8] |= bit
+		}
+
+		prefix[2+i/8] |= bit
+	}
+
+	return res
+}
+
+// appendPseudoHost appends to the destination slice the pseudonym of the given lowercase hostname.
+func appendPseudoHost(dest, key, host []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	tld := bytes.LastIndexByte(host, '.')
+	sum := make([]byte, 0, sha256.Size)
+
+	for i := 0; i < tld; {
+		j := i + bytes.IndexByte(host[i:], '.')
+
+		mac.Reset()
+		mac.Write(host[i:])
+
+		sum = mac.Sum(sum[:0])
+		dest = append(append(dest, 'h'), hex.EncodeToString(sum[:4])...)
+		dest = append(dest, '.')
+		i = j + 1
+	}
+
+	return append(dest, host[tld+1:]...)
+}
@@ -0,0 +1,150 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"bytes"
+	"net"
+	"regexp"
+	"testing"
+)
+
+func TestHostMatchers(t *testing.T) {
+	cases := []struct {
+		match    Matcher
+		src, exp string
+	}{
+		{
+			IPs(),
+			"from 10.0.0.1:8080 to [2001:db8::1]:443, via fe80::1. Not 12:30:45, 1.2.3, or 999.1.1.1",
+			"from <>:8080 to [<>]:443, via <>. Not 12:30:45, 1.2.3, or 999.1.1.1",
+		},
+		{
+			IPs(),
+			"x10.0.0.1 10.0.0.1_x ::ffff:192.0.2.1",
+			"x10.0.0.1 10.0.0.1_x <>",
+		},
+		{
+			Hostnames(),
+			"GET https://api.example.com:443/v1 from Mail.Example.ORG.",
+			"GET https://<>:443/v1 from <>.",
+		},
+		{
+			Hostnames(),
+			"localhost, -bad.com, a..b.com, 1.2.3.4, example.c0m, x_y.com, ok.example.net",
+			"localhost, -bad.com, a..b.com, 1.2.3.4, example.c0m, x_y.com, <>",
+		},
+		{
+			Hostnames(),
+			"see main.go, config.yaml, README.md and notes.txt at docs.example.com",
+			"see main.go, config.yaml, README.md and notes.txt at <>",
+		},
+		{
+			Hostnames(".corp.acme", "IO"),
+			"db1.corp.acme, corp.acme, x.acme, go.dev, pkg.Go.io",
+			"<>, corp.acme, x.acme, go.dev, <>",
+		},
+	}
+
+	for i, c := range cases {
+		if res := Replace(c.match, "<>").Do([]byte(c.src)); !bytes.Equal(res, []byte(c.exp)) {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+	}
+}
+
+func TestPseudonymizeHosts(t *testing.T) {
+	const src = "10.1.2.3 10.1.2.4 10.1.9.9 192.168.0.1 2001:db8::1 2001:db8::2 api.example.com www.Example.com"
+
+	rw := PseudonymizeHosts([]byte("secret"))
+	res := rw.Do([]byte(src))
+
+	if !bytes.Equal(res, rw.Do([]byte(src))) {
+		t.Error("Non-deterministic result")
+		return
+	}
+
+	if bytes.Equal(res, PseudonymizeHosts([]byte("other")).Do([]byte(src))) {
+		t.Error("The result does not depend on the seed")
+		return
+	}
+
+	fields := bytes.Fields(res)
+
+	if len(fields) != 8 {
+		t.Errorf("Unexpected result: %q", string(res))
+		return
+	}
+
+	ips := make([]net.IP, 6)
+
+	for i := range ips {
+		if ips[i] = net.ParseIP(string(fields[i])); ips[i] == nil {
+			t.Errorf("Invalid IP address: %q", string(fields[i]))
+			return
+		}
+	}
+
+	// common prefix lengths, in bits
+	prefixes := []struct{ a, b, n int }{
+		{0, 1, 29}, // 10.1.2.3 and 10.1.2.4
+		{0, 2, 20}, // 10.1.2.3 and 10.1.9.9
+		{0, 3, 0},  // 10.1.2.3 and 192.168.0.1
+		{4, 5, 126},
+	}
+
+	for i, p := range prefixes {
+		if n := commonPrefix(ips[p.a], ips[p.b]); n != p.n {
+			t.Errorf("[%d] Unexpected common prefix length: %d instead of %d", i, n, p.n)
+			return
+		}
+	}
+
+	// hostnames
+	re := regexp.MustCompile(`^h[0-9a-f]{8}\.(h[0-9a-f]{8}\.com)$`)
+	a, b := re.FindSubmatch(fields[6]), re.FindSubmatch(fields[7])
+
+	if a == nil || b == nil || !bytes.Equal(a[1], b[1]) || bytes.Equal(a[0], b[0]) {
+		t.Errorf("Unexpected hostnames: %q, %q", string(fields[6]), string(fields[7]))
+		return
+	}
+}
+
+func commonPrefix(a, b net.IP) (n int) {
+	if a4, b4 := a.To4(), b.To4(); a4 != nil && b4 != nil {
+		a, b = a4, b4
+	}
+
+	for n < len(a)*8 && (a[n/8]^b[n/8])&(0x80>>uint(n%8)) == 0 {
+		n++
+	}
+
+	return
+}
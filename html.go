@@ -0,0 +1,245 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"bytes"
+	"html"
+	"io"
+	"strings"
+
+	xhtml "golang.org/x/net/html"
+)
+
+// RewriteHTMLText creates a Rewriter that applies the given Rewriter to the text nodes of HTML
+// markup only, never to the tags, comments, or the content of raw text elements like <script> and <style>,
+// so that, for example, replacing a word everywhere cannot break the markup. The Rewriter sees
+// the text with the character references decoded, and the result is escaped back; text nodes
+// that are not changed by the Rewriter are kept as they are.
+func RewriteHTMLText(rw Rewriter) Rewriter {
+	if rw == nil {
+		panic("nil rewriter in trw.RewriteHTMLText() function")
+	}
+
+	return rewriteHTML(rw, true, nil)
+}
+
+// RewriteHTMLAttrs creates a Rewriter that applies the given Rewriter to the values of the HTML
+// attributes with the given (case-insensitive) names, or of all attributes if no name is given.
+// The Rewriter sees the values with the character references decoded, and the results are escaped
+// and quoted as needed; attribute values that are not changed by the Rewriter are kept as they are.
+func RewriteHTMLAttrs(rw Rewriter, names ...string) Rewriter {
+	if rw == nil {
+		panic("nil rewriter in trw.RewriteHTMLAttrs() function")
+	}
+
+	set := make(map[string]bool, len(names))
+
+	for _, name := range names {
+		if len(name) == 0 {
+			panic("empty attribute name in trw.RewriteHTMLAttrs() function")
+		}
+
+		set[strings.ToLower(name)] = true
+	}
+
+	return rewriteHTML(rw, false, set)
+}
+
+// rewriteHTML creates a Rewriter for either the text nodes, or the attribute values
+// (for all attributes if the set is empty).
+func rewriteHTML(rw Rewriter, text bool, attrs map[string]bool) Rewriter {
+	return func(dest, src []byte) ([]byte, []byte) {
+		if len(src) > cap(dest) {
+			dest = make([]byte, 0, len(src)+len(src)/5) // +20%
+		}
+
+		dest = dest[:0]
+		z := xhtml.NewTokenizer(bytes.NewReader(src))
+		raw := false // inside a raw text element
+
+		for {
+			tt := z.Next()
+
+			if tt == xhtml.ErrorToken {
+				if z.Err() != io.EOF {
+					return src, dest // cannot happen with a byte reader
+				}
+
+				// unterminated markup at the end of the input
+				return append(dest, z.Raw()...), src
+			}
+
+			tok := z.Raw()
+
+			switch tt {
+			case xhtml.TextToken:
+				if text && !raw {
+					dest = rewriteHTMLText(dest, tok, rw)
+					continue
+				}
+
+			case xhtml.StartTagToken, xhtml.SelfClosingTagToken:
+				// (not using z.TagName(), which lowercases the raw bytes in-place)
+				if tt == xhtml.StartTagToken {
+					raw = htmlRawText[strings.ToLower(htmlTagName(tok))]
+				}
+
+				if !text {
+					dest = rewriteHTMLAttrs(dest, tok, rw, attrs)
+					continue
+				}
+
+			case xhtml.EndTagToken:
+				raw = false
+			}
+
+			dest = append(dest, tok...)
+		}
+	}
+}
+
+// elements whose content the tokenizer treats as raw text
+var htmlRawText = map[string]bool{
+	"iframe":    true,
+	"noembed":   true,
+	"noframes":  true,
+	"noscript":  true,
+	"plaintext": true,
+	"script":    true,
+	"style":     true,
+	"xmp":       true,
+}
+
+// rewriteHTMLText appends to dest the raw text rewritten by the given Rewriter.
+func rewriteHTMLText(dest, raw []byte, rw Rewriter) []byte {
+	s := html.UnescapeString(string(raw))
+
+	if res := rw.Do([]byte(s)); string(res) != s {
+		return append(dest, html.EscapeString(string(res))...)
+	}
+
+	return append(dest, raw...)
+}
+
+// rewriteHTMLAttrs appends to dest the raw tag with the selected attribute values rewritten
+// by the given Rewriter.
+func rewriteHTMLAttrs(dest, tag []byte, rw Rewriter, attrs map[string]bool) []byte {
+	i := 1 + len(htmlTagName(tag))
+
+	done := 0 // tag[:done] has been copied
+
+	for i < len(tag) {
+		for i < len(tag) && (isHTMLSpace(tag[i]) || tag[i] == '/') {
+			i++
+		}
+
+		// name
+		n0 := i
+
+		for i < len(tag) && !isHTMLSpace(tag[i]) && tag[i] != '=' && tag[i] != '>' && (tag[i] != '/' || i == n0) {
+			i++
+		}
+
+		if i == n0 { // '>'
+			break
+		}
+
+		name := strings.ToLower(string(tag[n0:i]))
+
+		for i < len(tag) && isHTMLSpace(tag[i]) {
+			i++
+		}
+
+		if i == len(tag) || tag[i] != '=' {
+			continue // no value
+		}
+
+		for i++; i < len(tag) && isHTMLSpace(tag[i]); i++ {
+		}
+
+		// value
+		v0, v1, quoted := i, i, false
+
+		if i < len(tag) && (tag[i] == '"' || tag[i] == '\'') {
+			k := bytes.IndexByte(tag[i+1:], tag[i])
+
+			if k < 0 {
+				break // malformed
+			}
+
+			v0, v1, quoted = i+1, i+1+k, true
+			i = v1 + 1
+		} else {
+			for i < len(tag) && !isHTMLSpace(tag[i]) && tag[i] != '>' {
+				i++
+			}
+
+			v1 = i
+		}
+
+		if len(attrs) > 0 && !attrs[name] {
+			continue
+		}
+
+		s := html.UnescapeString(string(tag[v0:v1]))
+		res := rw.Do([]byte(s))
+
+		if string(res) == s {
+			continue
+		}
+
+		dest = append(dest, tag[done:v0]...)
+
+		if quoted {
+			dest = append(dest, html.EscapeString(string(res))...)
+		} else {
+			dest = append(append(append(dest, '"'), html.EscapeString(string(res))...), '"')
+		}
+
+		done = v1
+	}
+
+	return append(dest, tag[done:]...)
+}
+
+// htmlTagName returns the name of the given raw start tag.
+func htmlTagName(tag []byte) string {
+	i := 1
+
+	for i < len(tag) && !isHTMLSpace(tag[i]) && tag[i] != '>' && tag[i] != '/' {
+		i++
+	}
+
+	return string(tag[1:i])
+}
+
+func isHTMLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
@@ -0,0 +1,82 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import "testing"
+
+func TestRewriteHTMLText(t *testing.T) {
+	rw := RewriteHTMLText(Replace(Lit("Widget"), "Gadget & Co"))
+
+	cases := []struct {
+		src, exp string
+	}{
+		{``, ``},
+		{`Widget`, `Gadget &amp; Co`},
+		{`<Widget class="Widget">Widget</Widget>`, `<Widget class="Widget">Gadget &amp; Co</Widget>`},
+		{`<p>A &lt;Widget&gt;!</p>`, `<p>A &lt;Gadget &amp; Co&gt;!</p>`},
+		{`<p>no &nbsp; change</p>`, `<p>no &nbsp; change</p>`},
+		{`<!-- Widget --><script>var Widget = 1</script><style>.Widget{}</style>`, `<!-- Widget --><script>var Widget = 1</script><style>.Widget{}</style>`},
+		{`<br/>Widget<img src="Widget.png">`, `<br/>Gadget &amp; Co<img src="Widget.png">`},
+		{`<!DOCTYPE html><title>Widget</title>`, `<!DOCTYPE html><title>Gadget &amp; Co</title>`},
+		{`<noscript>Widget &amp;</noscript><xmp>Widget</xmp><IFRAME>Widget</IFRAME>`, `<noscript>Widget &amp;</noscript><xmp>Widget</xmp><IFRAME>Widget</IFRAME>`},
+		{`<plaintext>Widget</p>Widget`, `<plaintext>Widget</p>Widget`},
+		{`<p>Widget</p><a href`, `<p>Gadget &amp; Co</p><a href`},
+		{"<p>Widget</p>\n<b", "<p>Gadget &amp; Co</p>\n<b"},
+	}
+
+	for i, c := range cases {
+		if res := rw.Do([]byte(c.src)); string(res) != c.exp {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+	}
+}
+
+func TestRewriteHTMLAttrs(t *testing.T) {
+	cases := []struct {
+		rw       Rewriter
+		src, exp string
+	}{
+		{RewriteHTMLAttrs(Replace(Lit("old"), "new")), `<a href="/old" title='old'>old</a>`, `<a href="/new" title='new'>old</a>`},
+		{RewriteHTMLAttrs(Replace(Lit("old"), "new"), "HREF"), `<a href="/old" title='old'>old</a>`, `<a href="/new" title='old'>old</a>`},
+		{RewriteHTMLAttrs(Replace(Lit("old"), "a b")), `<a href=old disabled>`, `<a href="a b" disabled>`},
+		{RewriteHTMLAttrs(Replace(Lit("&"), "\"")), `<a title="a&amp;b" x = "&">`, `<a title="a&#34;b" x = "&#34;">`},
+		{RewriteHTMLAttrs(Replace(Lit("old"), "new")), `<img src="old.png"/><p class=old>`, `<img src="new.png"/><p class="new">`},
+		{RewriteHTMLAttrs(Replace(Lit("old"), "new")), `<!-- <a href="old"> -->`, `<!-- <a href="old"> -->`},
+		{RewriteHTMLAttrs(Replace(Lit("old"), "new"), "href"), `<a href="old"`, `<a href="old"`},
+		{RewriteHTMLAttrs(Replace(Lit("old"), "new")), `<p class=old>x</p><a href="old`, `<p class="new">x</p><a href="old`},
+	}
+
+	for i, c := range cases {
+		if res := c.rw.Do([]byte(c.src)); string(res) != c.exp {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+	}
+}
@@ -0,0 +1,190 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"fmt"
+	"strings"
+)
+
+// UUIDs creates a Matcher for UUIDs in the canonical 8-4-4-4-12 hexadecimal format,
+// in either letter case.
+func UUIDs() Matcher {
+	return tokenMatcher(36, isUUID)
+}
+
+// ULIDs creates a Matcher for ULIDs, i.e., 26-character Crockford's base32 identifiers,
+// in either letter case.
+func ULIDs() Matcher {
+	return tokenMatcher(26, isULID)
+}
+
+// CanonicalUUIDs creates a Rewriter that converts all UUIDs to lower case.
+func CanonicalUUIDs() Rewriter {
+	return mapMatches(UUIDs(), toLower)
+}
+
+// CanonicalULIDs creates a Rewriter that converts all ULIDs to upper case.
+func CanonicalULIDs() Rewriter {
+	return mapMatches(ULIDs(), toUpper)
+}
+
+// UUIDPseudonyms creates a new table of pseudonyms for UUIDs, where the n-th pseudonym
+// is the UUID 00000000-0000-4000-8000-<n as 12 hex digits>.
+func UUIDPseudonyms() *Pseudonyms {
+	return NewPseudonyms(func(n int) string {
+		return fmt.Sprintf("00000000-0000-4000-8000-%012x", n)
+	})
+}
+
+// ULIDPseudonyms creates a new table of pseudonyms for ULIDs, where the n-th pseudonym
+// is the ULID encoding n.
+func ULIDPseudonyms() *Pseudonyms {
+	return NewPseudonyms(func(n int) string {
+		var s [26]byte
+
+		for i := len(s) - 1; i >= 0; i-- {
+			s[i] = crockford[n&31]
+			n >>= 5
+		}
+
+		return string(s[:])
+	})
+}
+
+// PseudonymizeUUIDs creates a Rewriter that converts all UUIDs to lower case, and then substitutes
+// them with their pseudonyms from the given table.
+func PseudonymizeUUIDs(p *Pseudonyms) Rewriter {
+	return Seq(CanonicalUUIDs(), Pseudonymize(UUIDs(), p))
+}
+
+// PseudonymizeULIDs creates a Rewriter that converts all ULIDs to upper case, and then substitutes
+// them with their pseudonyms from the given table.
+func PseudonymizeULIDs(p *Pseudonyms) Rewriter {
+	return Seq(CanonicalULIDs(), Pseudonymize(ULIDs(), p))
+}
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+func isUUID(s []byte) bool {
+	for i, c := range s {
+		if i == 8 || i == 13 || i == 18 || i == 23 {
+			if c != '-' {
+				return false
+			}
+		} else if !isHexDigit(c) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isULID(s []byte) bool {
+	if s[0] > '7' { // the maximum ULID is 7ZZZZZZZZZZZZZZZZZZZZZZZZZ
+		return false
+	}
+
+	for _, c := range s {
+		if strings.IndexByte(crockford, toUpperByte(c)) < 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// tokenMatcher creates a Matcher for tokens of the given length satisfying the given predicate,
+// and not adjacent to other identifier characters or hyphens.
+func tokenMatcher(size int, pred func([]byte) bool) Matcher {
+	return func(s []byte) (ms [][]int) {
+		for i := 0; i+size <= len(s); {
+			if !isIdent(s[i]) {
+				i++
+				continue
+			}
+
+			// find the end of the token
+			j := i
+
+			for j < len(s) && (isIdent(s[j]) || s[j] == '-') {
+				j++
+			}
+
+			if j-i == size && (i == 0 || s[i-1] != '-') && pred(s[i:j]) {
+				ms = append(ms, []int{i, j})
+			}
+
+			i = j
+		}
+
+		return
+	}
+}
+
+// mapMatches creates a Rewriter that applies the given in-place transformation to every match.
+func mapMatches(match Matcher, fn func([]byte)) Rewriter {
+	return func(dest, src []byte) ([]byte, []byte) {
+		for _, m := range match(src) {
+			fn(src[m[0]:m[1]])
+		}
+
+		return src, dest
+	}
+}
+
+func toLower(s []byte) {
+	for i, c := range s {
+		if c >= 'A' && c <= 'Z' {
+			s[i] = c + ('a' - 'A')
+		}
+	}
+}
+
+func toUpper(s []byte) {
+	for i, c := range s {
+		s[i] = toUpperByte(c)
+	}
+}
+
+func toLowerByte(c byte) byte {
+	if c >= 'A' && c <= 'Z' {
+		return c + ('a' - 'A')
+	}
+
+	return c
+}
+
+func toUpperByte(c byte) byte {
+	if c >= 'a' && c <= 'z' {
+		return c - ('a' - 'A')
+	}
+
+	return c
+}
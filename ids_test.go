@@ -0,0 +1,96 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCanonicalIDs(t *testing.T) {
+	cases := []struct {
+		rw       Rewriter
+		src, exp string
+	}{
+		{
+			CanonicalUUIDs(),
+			"id=F81D4FAE-7DEC-11D0-A765-00A0C91E6BF6, x=00A0C91E6BF6",
+			"id=f81d4fae-7dec-11d0-a765-00a0c91e6bf6, x=00A0C91E6BF6",
+		},
+		{
+			CanonicalUUIDs(),
+			"X-F81D4FAE-7DEC-11D0-A765-00A0C91E6BF6 F81D4FAE-7DEC-11D0-A765-00A0C91E6BF6-X",
+			"X-F81D4FAE-7DEC-11D0-A765-00A0C91E6BF6 F81D4FAE-7DEC-11D0-A765-00A0C91E6BF6-X",
+		},
+		{
+			CanonicalULIDs(),
+			"id=01arz3ndektsv4rrffq69g5fav, x=81arz3ndektsv4rrffq69g5fav",
+			"id=01ARZ3NDEKTSV4RRFFQ69G5FAV, x=81arz3ndektsv4rrffq69g5fav",
+		},
+	}
+
+	for i, c := range cases {
+		if res := c.rw.Do([]byte(c.src)); !bytes.Equal(res, []byte(c.exp)) {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+	}
+}
+
+func TestPseudonymizeIDs(t *testing.T) {
+	p := UUIDPseudonyms()
+	rw := PseudonymizeUUIDs(p)
+
+	const src = "a=f81d4fae-7dec-11d0-a765-00a0c91e6bf6 b=123e4567-e89b-12d3-a456-426614174000 c=F81D4FAE-7DEC-11D0-A765-00A0C91E6BF6"
+	const exp = "a=00000000-0000-4000-8000-000000000001 b=00000000-0000-4000-8000-000000000002 c=00000000-0000-4000-8000-000000000001"
+
+	for k := 0; k < 2; k++ { // the table is kept between the runs
+		if res := rw.Do([]byte(src)); !bytes.Equal(res, []byte(exp)) {
+			t.Errorf("Unexpected result: %q instead of %q", string(res), exp)
+			return
+		}
+	}
+
+	if p.Len() != 2 {
+		t.Errorf("Unexpected table size: %d", p.Len())
+		return
+	}
+
+	u := ULIDPseudonyms()
+
+	if res := PseudonymizeULIDs(u).Do([]byte("01arz3ndektsv4rrffq69g5fav")); string(res) != "00000000000000000000000001" {
+		t.Errorf("Unexpected result: %q", string(res))
+		return
+	}
+
+	if s := u.Get("X"); s != "00000000000000000000000002" {
+		t.Errorf("Unexpected pseudonym: %q", s)
+		return
+	}
+}
@@ -0,0 +1,345 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net"
+)
+
+// Tee creates a Rewriter that writes the current text to the given io.Writer, passing the text
+// through unchanged. Being inserted between the stages of a Seq it allows for observing
+// intermediate results. Any error from the writer is ignored; wrap the writer to capture it.
+func Tee(w io.Writer) Rewriter {
+	if w == nil {
+		panic("nil writer in trw.Tee() function")
+	}
+
+	return func(dest, src []byte) ([]byte, []byte) {
+		w.Write(src)
+		return src, dest
+	}
+}
+
+// ScanSplit creates a bufio.SplitFunc that passes every token produced by the given split function
+// through the Rewriter before returning it to the bufio.Scanner. The rewriter works on a private
+// copy of each token, and the scanner's buffer is never modified. As with any other
+// bufio.SplitFunc, the returned token is only valid until the next call to Scan().
+func ScanSplit(split bufio.SplitFunc, rw Rewriter) bufio.SplitFunc {
+	if split == nil {
+		panic("nil split function in trw.ScanSplit() function")
+	}
+
+	if rw == nil {
+		panic("nil rewriter in trw.ScanSplit() function")
+	}
+
+	var buf, spare []byte
+
+	return func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		if advance, token, err = split(data, atEOF); token != nil {
+			if buf, spare = rw(spare[:0], append(buf[:0], token...)); buf == nil {
+				buf = []byte{} // nil token means "no token" to the scanner
+			}
+
+			token = buf
+		}
+
+		return
+	}
+}
+
+// DoVec applies the Rewriter to the concatenation of the given buffers, as handed over, for example,
+// by a network stack, without concatenating them first. As with NewWriter(), the Rewriter must
+// never match across line boundaries: the complete lines within each buffer are rewritten there,
+// in-place where the Rewriter allows, and only the lines spanning buffer boundaries are carried
+// over to a separate buffer. The results are appended to the returned slice. The buffers may be
+// modified, and they must not overlap; the net.Buffers value itself is not consumed.
+func (rw Rewriter) DoVec(bufs net.Buffers) (res []byte) {
+	var line, spare []byte // the line spanning buffer boundaries, and the spare rewriter buffer
+
+	for _, b := range bufs {
+		i := bytes.IndexByte(b, '\n') + 1
+
+		if i == 0 {
+			line = append(line, b...)
+			continue
+		}
+
+		if len(line) > 0 {
+			res = append(res, rw.Do(append(line, b[:i]...))...)
+			line, b = line[:0], b[i:]
+		}
+
+		if j := bytes.LastIndexByte(b, '\n') + 1; j > 0 {
+			var out []byte
+
+			out, spare = rw(spare[:0], b[:j:j])
+			res = append(res, out...)
+			b = b[j:]
+		}
+
+		line = append(line, b...)
+	}
+
+	if len(line) > 0 {
+		res = append(res, rw.Do(line)...)
+	}
+
+	return
+}
+
+// RewriteStream reads all the data from the given io.Reader, applies the Rewriter to it, and writes
+// the result to the given io.Writer. By default, the whole input is read into memory and rewritten
+// at once. With WithMemoryLimit() and WithLineSafe() options, an input larger than the limit
+// is instead rewritten line by line, as by NewWriter(), keeping the memory consumption bounded.
+// With WithFinalCapacity() option, the buffer capacity is only reported for the in-memory processing.
+// With WithGzip() option, gzip-compressed input is decompressed, and the result is compressed.
+// With Verify() option, the result is verified before it is written out; in line-by-line mode
+// every chunk of lines is verified separately, and the output stops at the first failed chunk.
+func RewriteStream(w io.Writer, r io.Reader, rw Rewriter, opts ...Option) (err error) {
+	o := makeOptions(opts)
+
+	if !o.gzip {
+		return rewriteStream(w, r, rw, &o, opts)
+	}
+
+	br := bufio.NewReader(r)
+
+	if magic, _ := br.Peek(2); !bytes.Equal(magic, gzipMagic) {
+		return rewriteStream(w, br, rw, &o, opts)
+	}
+
+	zr, err := gzip.NewReader(br)
+
+	if err != nil {
+		return
+	}
+
+	defer zr.Close()
+
+	zw := gzip.NewWriter(w)
+	zw.Name, zw.Comment, zw.ModTime = zr.Name, zr.Comment, zr.ModTime
+
+	if err = rewriteStream(zw, zr, rw, &o, opts); err == nil {
+		err = zw.Close()
+	}
+
+	return
+}
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+func rewriteStream(w io.Writer, r io.Reader, rw Rewriter, o *options, opts []Option) error {
+	if o.limit > 0 && o.lineSafe {
+		head, err := ioutil.ReadAll(io.LimitReader(r, int64(o.limit)+1))
+
+		if err != nil {
+			return err
+		}
+
+		if len(head) > o.limit {
+			return streamLines(w, io.MultiReader(bytes.NewReader(head), r), rw, o)
+		}
+
+		return writeChecked(w, rw.DoWith(head, opts...), o)
+	}
+
+	src, err := ioutil.ReadAll(r)
+
+	if err != nil {
+		return err
+	}
+
+	return writeChecked(w, rw.DoWith(src, opts...), o)
+}
+
+func streamLines(w io.Writer, r io.Reader, rw Rewriter, o *options) (err error) {
+	lw := &lineWriter{w: w, rw: rw, check: o.check}
+
+	if _, err = io.Copy(lw, r); err == nil {
+		err = lw.Close()
+	}
+
+	return
+}
+
+func writeChecked(w io.Writer, data []byte, o *options) error {
+	if err := o.check(data); err != nil {
+		return err
+	}
+
+	return writeAll(w, data)
+}
+
+func writeAll(w io.Writer, data []byte) (err error) {
+	_, err = w.Write(data)
+	return
+}
+
+// NewWriter creates an io.WriteCloser that applies the given Rewriter to the data written to it,
+// and writes the result to the underlying io.Writer. The data are processed line by line: every
+// Write() rewrites and passes on all the complete lines accumulated so far, buffering the
+// trailing partial line, if any. The Rewriter must therefore never match across line boundaries.
+// Close() rewrites and writes out the remaining partial line, without closing the underlying
+// writer. The first error from the underlying writer is returned from all subsequent calls.
+func NewWriter(w io.Writer, rw Rewriter) io.WriteCloser {
+	if w == nil {
+		panic("nil writer in trw.NewWriter() function")
+	}
+
+	if rw == nil {
+		panic("nil rewriter in trw.NewWriter() function")
+	}
+
+	return &lineWriter{w: w, rw: rw}
+}
+
+type lineWriter struct {
+	w           io.Writer
+	rw          Rewriter
+	buf         []byte             // pending partial line
+	work, spare []byte             // rewriter buffers
+	check       func([]byte) error // result verification, or nil
+	err         error
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	w.buf = append(w.buf, p...)
+
+	if i := bytes.LastIndexByte(w.buf, '\n'); i >= 0 {
+		w.flush(i + 1)
+	}
+
+	return len(p), w.err
+}
+
+func (w *lineWriter) Close() error {
+	if w.err == nil && len(w.buf) > 0 {
+		w.flush(len(w.buf))
+	}
+
+	return w.err
+}
+
+// flush rewrites and writes out the first n bytes of the buffer.
+func (w *lineWriter) flush(n int) {
+	w.work, w.spare = w.rw(w.spare[:0], append(w.work[:0], w.buf[:n]...))
+
+	if w.check != nil {
+		if w.err = w.check(w.work); w.err != nil {
+			return
+		}
+	}
+
+	if _, err := w.w.Write(w.work); err != nil {
+		w.err = err
+	}
+
+	w.buf = w.buf[:copy(w.buf, w.buf[n:])]
+}
+
+// NewReader creates an io.Reader that lazily applies the given Rewriter to the data read
+// from the underlying io.Reader. As with NewWriter(), the data are processed line by line,
+// so the Rewriter must never match across line boundaries. The last line is rewritten
+// when the underlying reader returns an error, including io.EOF, and the error is then
+// returned to the caller after all the rewritten data have been read.
+func NewReader(r io.Reader, rw Rewriter) io.Reader {
+	if r == nil {
+		panic("nil reader in trw.NewReader() function")
+	}
+
+	if rw == nil {
+		panic("nil rewriter in trw.NewReader() function")
+	}
+
+	return &lineReader{r: r, rw: rw}
+}
+
+type lineReader struct {
+	r           io.Reader
+	rw          Rewriter
+	buf         []byte // pending partial line
+	work, spare []byte // rewriter buffers
+	out         []byte // unread part of the rewritten data
+	err         error
+}
+
+// read buffer growth step
+const readChunk = 4096
+
+func (r *lineReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	for len(r.out) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+
+		r.fill()
+	}
+
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+
+	return n, nil
+}
+
+// fill reads more data from the underlying reader, and rewrites all the complete lines.
+func (r *lineReader) fill() {
+	if cap(r.buf)-len(r.buf) < readChunk/8 {
+		r.buf = append(r.buf, make([]byte, readChunk)...)[:len(r.buf)]
+	}
+
+	n, err := r.r.Read(r.buf[len(r.buf):cap(r.buf)])
+
+	r.buf, r.err = r.buf[:len(r.buf)+n], err
+
+	end := len(r.buf)
+
+	if err == nil {
+		end = bytes.LastIndexByte(r.buf, '\n') + 1
+	}
+
+	if end > 0 {
+		r.work, r.spare = r.rw(r.spare[:0], append(r.work[:0], r.buf[:end]...))
+		r.out = r.work
+		r.buf = r.buf[:copy(r.buf, r.buf[end:])]
+	}
+}
@@ -0,0 +1,377 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestTee(t *testing.T) {
+	var stage1, stage2 bytes.Buffer
+
+	rw := Seq(
+		Tee(&stage1),
+		Replace(Lit("a"), "XX"),
+		Tee(&stage2),
+		Delete(Lit("b")),
+	)
+
+	if res := rw.Do([]byte("aabbcc")); string(res) != "XXXXcc" {
+		t.Errorf("Unexpected result: %q", string(res))
+		return
+	}
+
+	if s := stage1.String(); s != "aabbcc" {
+		t.Errorf("Unexpected stage 1 output: %q", s)
+		return
+	}
+
+	if s := stage2.String(); s != "XXXXbbcc" {
+		t.Errorf("Unexpected stage 2 output: %q", s)
+		return
+	}
+}
+
+func TestScanSplit(t *testing.T) {
+	src := "aa bbb\n\nbbbb\ncb a\nb"
+	exp := []string{"XX ", "", "", "c X", ""}
+
+	s := bufio.NewScanner(bytes.NewReader([]byte(src)))
+
+	s.Split(ScanSplit(bufio.ScanLines, Seq(Delete(Lit("b")), Replace(Lit("a"), "X"))))
+
+	var res []string
+
+	for s.Scan() {
+		res = append(res, s.Text())
+	}
+
+	if err := s.Err(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(res) != len(exp) {
+		t.Errorf("Unexpected number of tokens: %d instead of %d", len(res), len(exp))
+		return
+	}
+
+	for i, r := range res {
+		if r != exp[i] {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, r, exp[i])
+			return
+		}
+	}
+}
+
+func TestScanSplitDest(t *testing.T) {
+	s := bufio.NewScanner(bytes.NewReader([]byte("a1\nb2\nc3\n")))
+
+	s.Split(ScanSplit(bufio.ScanLines, Expand(`(\d)`, "<$1>")))
+
+	var res []string
+
+	for s.Scan() {
+		res = append(res, s.Text())
+	}
+
+	if err := s.Err(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	exp := []string{"a<1>", "b<2>", "c<3>"}
+
+	if len(res) != len(exp) {
+		t.Errorf("Unexpected number of tokens: %d instead of %d", len(res), len(exp))
+		return
+	}
+
+	for i, r := range res {
+		if r != exp[i] {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, r, exp[i])
+			return
+		}
+	}
+}
+
+func TestNewWriter(t *testing.T) {
+	var out bytes.Buffer
+
+	w := NewWriter(&out, Replace(Lit("secret"), "***"))
+
+	steps := []struct {
+		src, exp string
+	}{
+		{"a secret", ""},
+		{" b\nc sec", "a *** b\n"},
+		{"ret\n", "a *** b\nc ***\n"},
+		{"secret\nsec", "a *** b\nc ***\n***\n"},
+		{"ret", "a *** b\nc ***\n***\n"},
+	}
+
+	for i, step := range steps {
+		if n, err := w.Write([]byte(step.src)); err != nil || n != len(step.src) {
+			t.Errorf("[%d] Unexpected write result: %d, %v", i, n, err)
+			return
+		}
+
+		if s := out.String(); s != step.exp {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, s, step.exp)
+			return
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if s, exp := out.String(), "a *** b\nc ***\n***\n***"; s != exp {
+		t.Errorf("Unexpected result: %q instead of %q", s, exp)
+		return
+	}
+
+	// error
+	w = NewWriter(failingWriter{}, Delete(Lit("a")))
+
+	if _, err := w.Write([]byte("abc\n")); err == nil {
+		t.Error("Missing error")
+		return
+	}
+
+	if _, err := w.Write([]byte("abc\n")); err == nil {
+		t.Error("Missing error")
+		return
+	}
+
+	if err := w.Close(); err == nil {
+		t.Error("Missing error")
+		return
+	}
+}
+
+func TestNewReader(t *testing.T) {
+	src := strings.Repeat("a secret b\nsecret\n\nc sec ret secret", 500)
+	rw := Replace(Lit("secret"), "***")
+	exp := string(rw.Do([]byte(src)))
+
+	wrappers := []func(io.Reader) io.Reader{
+		func(r io.Reader) io.Reader { return r },
+		iotest.OneByteReader,
+		iotest.HalfReader,
+		iotest.DataErrReader,
+	}
+
+	for i, wrap := range wrappers {
+		res, err := ioutil.ReadAll(NewReader(wrap(strings.NewReader(src)), rw))
+
+		if err != nil {
+			t.Errorf("[%d] Unexpected error: %s", i, err)
+			return
+		}
+
+		if string(res) != exp {
+			t.Errorf("[%d] Unexpected result of length %d instead of %d", i, len(res), len(exp))
+			return
+		}
+	}
+
+	// error
+	r := NewReader(iotest.TimeoutReader(strings.NewReader("x secret\nsecret")), rw)
+
+	if res, err := ioutil.ReadAll(r); err != iotest.ErrTimeout || string(res) != "x ***\n***" {
+		t.Errorf("Unexpected result: %q, %v", string(res), err)
+		return
+	}
+}
+
+func TestRewriteStream(t *testing.T) {
+	src := strings.Repeat("a secret b\nsecret\n\nc sec ret secret", 500)
+	exp := strings.Replace(src, "secret", "***", -1)
+
+	var calls int
+
+	rw := Seq(
+		func(dest, src []byte) ([]byte, []byte) { calls++; return src, dest },
+		Replace(Lit("secret"), "***"),
+	)
+
+	cases := []struct {
+		opts  []Option
+		calls int
+	}{
+		{nil, 1},
+		{[]Option{WithMemoryLimit(100)}, 1},
+		{[]Option{WithLineSafe()}, 1},
+		{[]Option{WithMemoryLimit(len(src)), WithLineSafe()}, 1},
+		{[]Option{WithMemoryLimit(len(src) - 1), WithLineSafe()}, -1},
+	}
+
+	for i, c := range cases {
+		var out bytes.Buffer
+
+		calls = 0
+
+		if err := RewriteStream(&out, iotest.HalfReader(strings.NewReader(src)), rw, c.opts...); err != nil {
+			t.Errorf("[%d] Unexpected error: %s", i, err)
+			return
+		}
+
+		if out.String() != exp {
+			t.Errorf("[%d] Unexpected result of length %d instead of %d", i, out.Len(), len(exp))
+			return
+		}
+
+		if (c.calls > 0 && calls != c.calls) || (c.calls < 0 && calls < 2) {
+			t.Errorf("[%d] Unexpected number of calls: %d", i, calls)
+			return
+		}
+	}
+
+	// error
+	if err := RewriteStream(ioutil.Discard, iotest.TimeoutReader(strings.NewReader(src)), rw); err != iotest.ErrTimeout {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+}
+
+func TestRewriteStreamGzip(t *testing.T) {
+	src := strings.Repeat("a secret b\nsecret\n\nc sec ret secret", 500)
+	exp := strings.Replace(src, "secret", "***", -1)
+	rw := Replace(Lit("secret"), "***")
+
+	var in bytes.Buffer
+
+	zw := gzip.NewWriter(&in)
+	zw.Name = "test.log"
+
+	if _, err := zw.Write([]byte(src)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	optsList := [][]Option{
+		{WithGzip()},
+		{WithGzip(), WithLineSafe(), WithMemoryLimit(100)},
+	}
+
+	for i, opts := range optsList {
+		var out bytes.Buffer
+
+		if err := RewriteStream(&out, bytes.NewReader(in.Bytes()), rw, opts...); err != nil {
+			t.Errorf("[%d] Unexpected error: %s", i, err)
+			return
+		}
+
+		zr, err := gzip.NewReader(&out)
+
+		if err != nil {
+			t.Errorf("[%d] Unexpected error: %s", i, err)
+			return
+		}
+
+		res, err := ioutil.ReadAll(zr)
+
+		if err != nil {
+			t.Errorf("[%d] Unexpected error: %s", i, err)
+			return
+		}
+
+		if string(res) != exp || zr.Name != "test.log" {
+			t.Errorf("[%d] Unexpected result of length %d, name %q", i, len(res), zr.Name)
+			return
+		}
+	}
+
+	// uncompressed input
+	var out bytes.Buffer
+
+	if err := RewriteStream(&out, strings.NewReader(src), rw, WithGzip()); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if out.String() != exp {
+		t.Errorf("Unexpected result of length %d instead of %d", out.Len(), len(exp))
+		return
+	}
+}
+
+func TestDoVec(t *testing.T) {
+	rw := Seq(Replace(Lit("secret"), "***"), Replace(Lit("x"), "xxx"))
+
+	cases := []struct {
+		bufs []string
+		exp  string
+	}{
+		{nil, ""},
+		{[]string{"a secret"}, "a ***"},
+		{[]string{"a sec", "ret b se", "", "cr", "et"}, "a *** b ***"},
+		{[]string{"a secret\nb sec", "ret\nc x\nd se", "cret x\n", "x"}, "a ***\nb ***\nc xxx\nd *** xxx\nxxx"},
+		{[]string{"x\n", "\n", "secret\n"}, "xxx\n\n***\n"},
+	}
+
+	for i, c := range cases {
+		var bufs net.Buffers
+
+		for _, b := range c.bufs {
+			bufs = append(bufs, []byte(b))
+		}
+
+		if res := rw.DoVec(bufs); string(res) != c.exp {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+
+		if len(bufs) != len(c.bufs) {
+			t.Errorf("[%d] Buffers consumed", i)
+			return
+		}
+	}
+
+	// the buffers are not copied as a whole
+	bufs := net.Buffers{[]byte("a secret\nb secret\n"), []byte("c secret\n")}
+
+	if res := Delete(Lit("secret")).DoVec(bufs); string(res) != "a \nb \nc \n" || string(bufs[0][:6]) != "a \nb \n" {
+		t.Errorf("Unexpected result: %q, buffer %q", string(res), string(bufs[0]))
+		return
+	}
+}
@@ -0,0 +1,102 @@
+//go:build go1.23
+
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"bytes"
+	"iter"
+)
+
+// RewriteSeq returns an iterator over the results of applying the given Rewriter to each chunk
+// produced by the given iterator. The chunks are processed independently, so matches spanning
+// chunk boundaries are not found; use RewriteSeqDelim() where this matters. Each yielded slice
+// is only valid until the next iteration. The input chunks are not modified.
+func RewriteSeq(rw Rewriter, chunks iter.Seq[[]byte]) iter.Seq[[]byte] {
+	if rw == nil {
+		panic("nil Rewriter in trw.RewriteSeq() function")
+	}
+
+	if chunks == nil {
+		panic("nil iterator in trw.RewriteSeq() function")
+	}
+
+	return func(yield func([]byte) bool) {
+		var buf, spare []byte
+
+		for chunk := range chunks {
+			if buf, spare = rw(spare[:0], append(buf[:0], chunk...)); !yield(buf) {
+				return
+			}
+		}
+	}
+}
+
+// RewriteSeqDelim is like RewriteSeq(), but with the hint that no match spans the given delimiter
+// byte (for example, a newline), which makes it possible to handle matches spanning chunk
+// boundaries: the chunks are accumulated until the last delimiter, and the Rewriter is applied
+// to the text up to and including the last delimiter, with the rest of the text carried over
+// to the next chunk. After the last chunk, the Rewriter is applied to the remaining text, if any.
+// Empty results are not yielded.
+func RewriteSeqDelim(rw Rewriter, chunks iter.Seq[[]byte], delim byte) iter.Seq[[]byte] {
+	if rw == nil {
+		panic("nil Rewriter in trw.RewriteSeqDelim() function")
+	}
+
+	if chunks == nil {
+		panic("nil iterator in trw.RewriteSeqDelim() function")
+	}
+
+	return func(yield func([]byte) bool) {
+		var pending, buf, spare []byte
+
+		for chunk := range chunks {
+			k := bytes.LastIndexByte(chunk, delim)
+
+			if k < 0 {
+				pending = append(pending, chunk...)
+				continue
+			}
+
+			buf = append(append(buf[:0], pending...), chunk[:k+1]...)
+			pending = append(pending[:0], chunk[k+1:]...)
+
+			if buf, spare = rw(spare[:0], buf); len(buf) > 0 && !yield(buf) {
+				return
+			}
+		}
+
+		if len(pending) > 0 {
+			if buf, _ = rw(spare[:0], pending); len(buf) > 0 {
+				yield(buf)
+			}
+		}
+	}
+}
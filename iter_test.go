@@ -0,0 +1,164 @@
+//go:build go1.23
+
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRewriteSeq(t *testing.T) {
+	chunks := []string{"aa bb\ncc", " bb aa", "\nbb", ""}
+	rw := Replace(Lit("bb"), "X")
+
+	var res []string
+
+	for s := range RewriteSeq(rw, seqOf(chunks)) {
+		res = append(res, string(s))
+	}
+
+	if exp := []string{"aa X\ncc", " X aa", "\nX", ""}; !slices.Equal(res, exp) {
+		t.Errorf("Unexpected result: %q instead of %q", res, exp)
+		return
+	}
+
+	// chunks are not modified
+	if chunks[0] != "aa bb\ncc" {
+		t.Errorf("Modified chunk: %q", chunks[0])
+		return
+	}
+
+	// early exit
+	for range RewriteSeq(rw, seqOf(chunks)) {
+		break
+	}
+
+	// rewriter writing to the destination slice
+	res = res[:0]
+
+	for s := range RewriteSeq(Expand(`(\d)`, "<$1>"), seqOf([]string{"a1", "b2", "c3"})) {
+		res = append(res, string(s))
+	}
+
+	if exp := []string{"a<1>", "b<2>", "c<3>"}; !slices.Equal(res, exp) {
+		t.Errorf("Unexpected result: %q instead of %q", res, exp)
+		return
+	}
+}
+
+func TestRewriteSeqDelim(t *testing.T) {
+	rw := Replace(Lit("secret"), "***")
+
+	cases := []struct {
+		chunks, exp []string
+	}{
+		{[]string{"a sec", "ret b\nc se", "cret d\n"}, []string{"a *** b\n", "c *** d\n"}},
+		{[]string{"sec", "ret", "\n", "secret"}, []string{"***\n", "***"}},
+		{[]string{"x\ny\n"}, []string{"x\ny\n"}},
+		{nil, nil},
+	}
+
+	for i, c := range cases {
+		var res []string
+
+		for s := range RewriteSeqDelim(rw, seqOf(c.chunks), '\n') {
+			res = append(res, string(s))
+		}
+
+		if !slices.Equal(res, c.exp) {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, res, c.exp)
+			return
+		}
+	}
+
+	// rewriter writing to the destination slice
+	expand := ExpandFunc(`\d`, func(groups [][]byte) []byte {
+		return []byte("<" + string(groups[0]) + ">")
+	})
+
+	cases = []struct {
+		chunks, exp []string
+	}{
+		{[]string{"a1\nb", "2\n", "c3"}, []string{"a<1>\n", "b<2>\n", "c<3>"}},
+	}
+
+	for i, c := range cases {
+		var res []string
+
+		for s := range RewriteSeqDelim(expand, seqOf(c.chunks), '\n') {
+			res = append(res, string(s))
+		}
+
+		if !slices.Equal(res, c.exp) {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, res, c.exp)
+			return
+		}
+	}
+
+	// the result matches processing the whole text
+	src := strings.Repeat("one secret\ntwo secrets\n", 10)
+
+	var b strings.Builder
+
+	for s := range RewriteSeqDelim(rw, chunksOf(src, 7), '\n') {
+		b.Write(s)
+	}
+
+	if exp := string(rw.Do([]byte(src))); b.String() != exp {
+		t.Errorf("Unexpected result: %q instead of %q", b.String(), exp)
+		return
+	}
+}
+
+func seqOf(chunks []string) func(func([]byte) bool) {
+	return func(yield func([]byte) bool) {
+		for _, s := range chunks {
+			if !yield([]byte(s)) {
+				return
+			}
+		}
+	}
+}
+
+func chunksOf(s string, size int) func(func([]byte) bool) {
+	return func(yield func([]byte) bool) {
+		for len(s) > size {
+			if !yield([]byte(s[:size])) {
+				return
+			}
+
+			s = s[size:]
+		}
+
+		yield([]byte(s))
+	}
+}
@@ -0,0 +1,229 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"unicode/utf8"
+)
+
+// RewriteJSONStrings creates a Rewriter that applies the given Rewriter to the content of every
+// string value in JSON text, leaving the structure, the object keys, and all the other values
+// intact. The input may be a sequence of JSON values, like JSON lines. The Rewriter sees the decoded
+// content of each string, and the result is encoded back with the minimal escaping; strings that
+// are not changed by the Rewriter keep their original escaping. Strings with invalid escape
+// sequences are left intact.
+func RewriteJSONStrings(rw Rewriter) Rewriter {
+	if rw == nil {
+		panic("nil rewriter in trw.RewriteJSONStrings() function")
+	}
+
+	return rewrite(jsonStrings(nil), jsonRewrite(rw))
+}
+
+// RewriteJSONField creates a Rewriter like RewriteJSONStrings(), but applies the given Rewriter
+// only to the string values at the specified path of object keys separated by dots, like
+// "user.email". Arrays do not add to the path, so the path "users.email" selects the emails
+// of all the elements of the "users" array. Keys containing dots cannot be selected.
+func RewriteJSONField(path string, rw Rewriter) Rewriter {
+	if len(path) == 0 {
+		panic("empty path in trw.RewriteJSONField() function")
+	}
+
+	if rw == nil {
+		panic("nil rewriter in trw.RewriteJSONField() function")
+	}
+
+	return rewrite(jsonStrings(strings.Split(path, ".")), jsonRewrite(rw))
+}
+
+// jsonRewrite creates a rewriting function that applies the given Rewriter to the JSON string
+// literal at the match location.
+func jsonRewrite(rw Rewriter) func(dest, src []byte, m []int) []byte {
+	return func(dest, src []byte, m []int) []byte {
+		lit := src[m[0]:m[1]]
+
+		var s string
+
+		if json.Unmarshal(lit, &s) != nil {
+			return append(dest, lit...)
+		}
+
+		if res := rw.Do([]byte(s)); string(res) != s {
+			return appendJSONString(dest, res)
+		}
+
+		return append(dest, lit...)
+	}
+}
+
+// jsonFrame is a JSON object or array being scanned.
+type jsonFrame struct {
+	object    bool
+	expectKey bool   // the next string is a key
+	key       string // the current key
+}
+
+// jsonStrings creates a Matcher for the string values in JSON text, either all of them, or only
+// those at the given path of object keys.
+func jsonStrings(path []string) Matcher {
+	return func(s []byte) (ms [][]int) {
+		var stack []jsonFrame
+
+		for i := 0; i < len(s); {
+			switch s[i] {
+			case '{':
+				stack = append(stack, jsonFrame{object: true, expectKey: true})
+			case '[':
+				stack = append(stack, jsonFrame{})
+			case '}', ']':
+				if len(stack) > 0 {
+					stack = stack[:len(stack)-1]
+				}
+			case ':':
+				if n := len(stack); n > 0 {
+					stack[n-1].expectKey = false
+				}
+			case ',':
+				if n := len(stack); n > 0 && stack[n-1].object {
+					stack[n-1].expectKey = true
+				}
+			case '"':
+				j := skipJSONString(s, i)
+
+				if n := len(stack); n > 0 && stack[n-1].object && stack[n-1].expectKey {
+					stack[n-1].key = jsonKey(s[i:j])
+				} else if j > i+1 && s[j-1] == '"' && jsonPathIs(stack, path) {
+					ms = append(ms, []int{i, j})
+				}
+
+				i = j
+				continue
+			}
+
+			i++
+		}
+
+		return
+	}
+}
+
+// skipJSONString returns the index of the first byte after the string literal at s[i].
+func skipJSONString(s []byte, i int) int {
+	for i++; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			return i + 1
+		case '\\':
+			i++
+		case '\n': // unterminated string
+			return i
+		}
+	}
+
+	return len(s)
+}
+
+// jsonKey decodes the object key from the given string literal.
+func jsonKey(lit []byte) string {
+	if len(lit) >= 2 && bytes.IndexByte(lit, '\\') < 0 {
+		return string(lit[1 : len(lit)-1])
+	}
+
+	var key string
+
+	json.Unmarshal(lit, &key)
+	return key
+}
+
+// jsonPathIs checks if the keys of the objects on the stack form the given path;
+// a nil path matches anything.
+func jsonPathIs(stack []jsonFrame, path []string) bool {
+	if path == nil {
+		return true
+	}
+
+	k := 0
+
+	for _, f := range stack {
+		if f.object {
+			if k == len(path) || f.key != path[k] {
+				return false
+			}
+
+			k++
+		}
+	}
+
+	return k == len(path)
+}
+
+// appendJSONString appends the given text to dest as a JSON string literal, escaping only
+// the characters that must be escaped. Invalid UTF-8 bytes are replaced with U+FFFD.
+func appendJSONString(dest, s []byte) []byte {
+	const hex = "0123456789abcdef"
+
+	dest = append(dest, '"')
+
+	for i := 0; i < len(s); {
+		c := s[i]
+
+		switch {
+		case c == '"' || c == '\\':
+			dest = append(dest, '\\', c)
+		case c == '\n':
+			dest = append(dest, '\\', 'n')
+		case c == '\r':
+			dest = append(dest, '\\', 'r')
+		case c == '\t':
+			dest = append(dest, '\\', 't')
+		case c < 0x20:
+			dest = append(dest, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xF])
+		case c < utf8.RuneSelf:
+			dest = append(dest, c)
+		default:
+			r, n := utf8.DecodeRune(s[i:])
+
+			if r == utf8.RuneError && n == 1 {
+				dest = append(dest, "�"...)
+			} else {
+				dest = append(dest, s[i:i+n]...)
+			}
+
+			i += n
+			continue
+		}
+
+		i++
+	}
+
+	return append(dest, '"')
+}
@@ -0,0 +1,91 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRewriteJSONStrings(t *testing.T) {
+	rw := RewriteJSONStrings(Replace(Lit("secret"), "***"))
+
+	cases := []struct {
+		src, exp string
+	}{
+		{``, ``},
+		{`"secret"`, `"***"`},
+		{`{"secret": "a secret", "n": 1}`, `{"secret": "a ***", "n": 1}`},
+		{`{"a": ["secret", {"b": "no"}], "c": "secret"}`, `{"a": ["***", {"b": "no"}], "c": "***"}`},
+		{`{"a": "say \"secret\"\n"}`, `{"a": "say \"***\"\n"}`},
+		{`{"a": "é \/ no"}`, `{"a": "é \/ no"}`},
+		{"{\"a\":\"secret\"}\n{\"a\":\"x\"}\n", "{\"a\":\"***\"}\n{\"a\":\"x\"}\n"},
+		{`{"a": "secret`, `{"a": "secret`},
+		{`{"a": "\q secret"}`, `{"a": "\q secret"}`},
+	}
+
+	for i, c := range cases {
+		if res := rw.Do([]byte(c.src)); string(res) != c.exp {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+	}
+
+	// escaping of the substitution
+	res := RewriteJSONStrings(Replace(Lit("x"), "\"\\\n\x01é")).Do([]byte(`["x"]`))
+
+	var v []string
+
+	if err := json.Unmarshal(res, &v); err != nil || len(v) != 1 || v[0] != "\"\\\n\x01é" {
+		t.Errorf("Unexpected result: %s", res)
+		return
+	}
+}
+
+func TestRewriteJSONField(t *testing.T) {
+	rw := RewriteJSONField("user.email", Replace(Patt(`[^@]+@`), "***@"))
+
+	cases := []struct {
+		src, exp string
+	}{
+		{`{"user": {"email": "me@x.org"}, "email": "me@x.org"}`, `{"user": {"email": "***@x.org"}, "email": "me@x.org"}`},
+		{`{"user": {"name": "me@x.org", "email": "you@y.org"}}`, `{"user": {"name": "me@x.org", "email": "***@y.org"}}`},
+		{`{"user": [{"email": "a@b"}, {"email": "c@d"}]}`, `{"user": [{"email": "***@b"}, {"email": "***@d"}]}`},
+		{`{"user": {"email": {"email": "a@b"}}}`, `{"user": {"email": {"email": "a@b"}}}`},
+		{`{"usr": {"email": "a@b"}, "user": {"email": "c@d"}}`, `{"usr": {"email": "a@b"}, "user": {"email": "***@d"}}`},
+		{`{"user": {"email": "a@b"}}`, `{"user": {"email": "***@b"}}`},
+	}
+
+	for i, c := range cases {
+		if res := rw.Do([]byte(c.src)); string(res) != c.exp {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+	}
+}
@@ -0,0 +1,172 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import "strconv"
+
+// LintWarning describes a potential problem in a Policy.
+type LintWarning struct {
+	Detector string // name (or "#index") of the detector, empty for policy-wide warnings
+	Other    string // name (or "#index") of the other detector involved, if any
+	Message  string // human-readable description
+}
+
+// String returns the warning message.
+func (w LintWarning) String() string {
+	return w.Message
+}
+
+// Lint checks the policy for problems, and returns the list of warnings, ordered by detector.
+// In addition to the configuration errors that would make Compile() panic, and duplicate detector
+// names, Lint runs the policy over the given sample texts (if any) to find detectors that never
+// match, detectors that never fire because all their matches are shadowed by the matches from
+// other detectors, and pairs of detectors with overlapping matches but different actions.
+// Since matchers are opaque, the analysis is only as good as the samples.
+func (p *Policy) Lint(samples ...[]byte) (warnings []LintWarning) {
+	if warnings = p.validate(); len(warnings) > 0 {
+		return
+	}
+
+	seen := make(map[string]int, len(p.Detectors))
+
+	for i, d := range p.Detectors {
+		if len(d.Name) == 0 {
+			continue
+		}
+
+		if j, ok := seen[d.Name]; ok {
+			warnings = append(warnings, LintWarning{
+				Detector: p.label(i),
+				Other:    p.label(j),
+				Message:  "duplicate detector name " + strconv.Quote(d.Name),
+			})
+		} else {
+			seen[d.Name] = i
+		}
+	}
+
+	if len(samples) == 0 {
+		return
+	}
+
+	// statistics
+	n := len(p.Detectors)
+	matched := make([]int, n)
+	fired := make([]int, n)
+	shadowed := make([][]int, n) // shadowed[k][j]: matches of detector k discarded in favour of detector j
+	conflicts := make([][]bool, n)
+
+	for k := range shadowed {
+		shadowed[k] = make([]int, n)
+		conflicts[k] = make([]bool, n)
+	}
+
+	c := p.compile("Lint")
+
+	for _, s := range samples {
+		// matches outside of the exempt regions
+		live := c.resolveExempt(c.candidates(s), c.exemptRegions(s))
+		winners := c.resolve(s, append([]policyMatch(nil), live...), nil)
+
+		for i, m := range live {
+			matched[m.det]++
+
+			for _, o := range live[i+1:] {
+				if o.start >= m.end {
+					break
+				}
+
+				if a, b := m.det, o.det; a != b && c.detectors[a].Action != c.detectors[b].Action {
+					if a < b {
+						a, b = b, a
+					}
+
+					conflicts[a][b] = true
+				}
+			}
+		}
+
+		w := 0
+
+		for _, m := range live {
+			for w < len(winners) && winners[w].end <= m.start {
+				w++
+			}
+
+			if w < len(winners) && winners[w].start == m.start && winners[w].det == m.det {
+				fired[m.det]++
+				continue
+			}
+
+			// the winner overlapping the match
+			for _, o := range winners[w:] {
+				if o.start < m.end {
+					shadowed[m.det][o.det]++
+					break
+				}
+			}
+		}
+	}
+
+	for k := 0; k < n; k++ {
+		switch {
+		case matched[k] == 0:
+			warnings = append(warnings, LintWarning{
+				Detector: p.label(k),
+				Message:  "detector " + strconv.Quote(p.label(k)) + " never matches the samples",
+			})
+		case fired[k] == 0:
+			j := 0
+
+			for i, count := range shadowed[k] {
+				if count > shadowed[k][j] {
+					j = i
+				}
+			}
+
+			warnings = append(warnings, LintWarning{
+				Detector: p.label(k),
+				Other:    p.label(j),
+				Message:  "detector " + strconv.Quote(p.label(k)) + " never fires on the samples, shadowed by detector " + strconv.Quote(p.label(j)),
+			})
+		}
+
+		for j := 0; j < k; j++ {
+			if conflicts[k][j] {
+				warnings = append(warnings, LintWarning{
+					Detector: p.label(k),
+					Other:    p.label(j),
+					Message:  "detector " + strconv.Quote(p.label(k)) + " overlaps with detector " + strconv.Quote(p.label(j)) + " that has a different action",
+				})
+			}
+		}
+	}
+
+	return
+}
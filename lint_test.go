@@ -0,0 +1,94 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	p := Policy{
+		Detectors: []Detector{
+			{Name: "email", Match: Patt(`[a-z]+@[a-z]+\.com`)},
+			{Name: "domain", Match: Patt(`[a-z]+\.com`), Action: ActionHash},
+			{Name: "user", Match: Patt(`[a-z]+@`)},
+			{Name: "card", Match: Cards()},
+			{Name: "email", Match: Lit("secret")},
+			{Match: Lit("token")},
+		},
+		Exempt: []Matcher{Lit("`secret`")},
+		Seed:   []byte("secret"),
+	}
+
+	samples := [][]byte{
+		[]byte("contact ann@example.com\n"),
+		[]byte("see example.com, not `secret`\n"),
+	}
+
+	exp := []string{
+		`duplicate detector name "email"`,
+		`detector "domain" overlaps with detector "email" that has a different action`,
+		`detector "user" never fires on the samples, shadowed by detector "email"`,
+		`detector "card" never matches the samples`,
+		`detector "email" never matches the samples`,
+		`detector "#5" never matches the samples`,
+	}
+
+	warnings := p.Lint(samples...)
+
+	if len(warnings) != len(exp) {
+		t.Errorf("Unexpected number of warnings: %d instead of %d: %v", len(warnings), len(exp), warnings)
+		return
+	}
+
+	for i, w := range warnings {
+		if w.String() != exp[i] {
+			t.Errorf("[%d] Unexpected warning: %q instead of %q", i, w.String(), exp[i])
+			return
+		}
+	}
+
+	// no samples
+	if warnings = p.Lint(); len(warnings) != 1 || warnings[0].Detector != "email" || warnings[0].Other != "email" {
+		t.Errorf("Unexpected warnings: %v", warnings)
+		return
+	}
+
+	// configuration errors
+	p.Seed = nil
+	p.Detectors[4].Match = nil
+
+	if warnings = p.Lint(samples...); len(warnings) != 2 ||
+		!strings.HasPrefix(warnings[0].Message, "empty seed") ||
+		!strings.HasPrefix(warnings[1].Message, "nil matcher") {
+		t.Errorf("Unexpected warnings: %v", warnings)
+		return
+	}
+}
@@ -0,0 +1,396 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"sort"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Lits creates a Matcher for any of the given string literals. The input is scanned once,
+// and at each position the literal that comes first in the argument list is matched,
+// as in strings.Replacer. In each match, the index pair is followed by the index
+// of the matched literal in the argument list.
+func Lits(patts ...string) Matcher {
+	if len(patts) == 0 {
+		panic("empty pattern list in trw.Lits() function")
+	}
+
+	for _, patt := range patts {
+		if len(patt) == 0 {
+			panic("empty pattern in trw.Lits() function")
+		}
+	}
+
+	return newTrie(patts).match
+}
+
+// LitsRK creates a Matcher for any of the given string literals, all of the same length, using
+// Rabin-Karp algorithm. The matches are the same as from Lits(). On typical text Lits() is faster,
+// but its worst case time grows with the length of the literals, while LitsRK() always takes time
+// linear in the input size. This makes LitsRK() preferable for long literals (like a fixed set of
+// 64-character tokens to scrub) in the input that may contain long partial matches of them.
+func LitsRK(patts ...string) Matcher {
+	if len(patts) == 0 {
+		panic("empty pattern list in trw.LitsRK() function")
+	}
+
+	n := len(patts[0])
+
+	for _, patt := range patts {
+		if len(patt) == 0 {
+			panic("empty pattern in trw.LitsRK() function")
+		}
+
+		if len(patt) != n {
+			panic("patterns of different lengths in trw.LitsRK() function")
+		}
+	}
+
+	// pattern hashes, with a bit set filter to skip most of the map lookups
+	hashes := make(map[uint32][]int, len(patts))
+
+	var filter [rkFilterSize / 64]uint64
+
+	for i, patt := range patts {
+		h := rkHash([]byte(patt))
+		hashes[h] = append(hashes[h], i)
+		filter[h%rkFilterSize/64] |= 1 << (h % 64)
+	}
+
+	// multiplier for removing the leading byte from the hash
+	pow := uint32(1)
+
+	for i := 1; i < n; i++ {
+		pow *= rkPrime
+	}
+
+	match := func(s []byte, i int, h uint32) int {
+		if filter[h%rkFilterSize/64]&(1<<(h%64)) == 0 {
+			return -1
+		}
+
+		for _, k := range hashes[h] {
+			if string(s[i:i+n]) == patts[k] {
+				return k
+			}
+		}
+
+		return -1
+	}
+
+	return func(s []byte) (ms [][]int) {
+		if len(s) < n {
+			return
+		}
+
+		h := rkHash(s[:n])
+
+		for i := 0; ; {
+			if k := match(s, i, h); k >= 0 {
+				ms = append(ms, []int{i, i + n, k})
+
+				if i += n; i+n > len(s) {
+					break
+				}
+
+				h = rkHash(s[i : i+n])
+				continue
+			}
+
+			if i+n >= len(s) {
+				break
+			}
+
+			h = (h-pow*uint32(s[i]))*rkPrime + uint32(s[i+n])
+			i++
+		}
+
+		return
+	}
+}
+
+// Rabin-Karp hash multiplier (same as in the standard library), and the hash filter size in bits
+const (
+	rkPrime      = 16777619
+	rkFilterSize = 1 << 14
+)
+
+func rkHash(s []byte) (h uint32) {
+	for _, c := range s {
+		h = h*rkPrime + uint32(c)
+	}
+
+	return
+}
+
+// ReplacePairs creates a Rewriter that performs all the given old/new string substitutions
+// in one pass, with the semantics of strings.NewReplacer(), except that empty old strings
+// are not allowed, and cause a panic.
+func ReplacePairs(oldnew ...string) Rewriter {
+	if len(oldnew) == 0 || len(oldnew)%2 == 1 {
+		panic("odd or empty argument count in trw.ReplacePairs() function")
+	}
+
+	olds := make([]string, 0, len(oldnew)/2)
+	news := make([]string, 0, len(oldnew)/2)
+
+	for i := 0; i < len(oldnew); i += 2 {
+		if len(oldnew[i]) == 0 {
+			panic("empty old string in trw.ReplacePairs() function")
+		}
+
+		olds = append(olds, oldnew[i])
+		news = append(news, oldnew[i+1])
+	}
+
+	return rewrite(Lits(olds...), func(dest, _ []byte, m []int) []byte {
+		return append(dest, news[m[2]]...)
+	})
+}
+
+// ReplaceMap creates a Rewriter that substitutes every occurrence of each key of the given map
+// with the corresponding value, in one pass. The result does not depend on the map iteration
+// order: the input is scanned from left to right, and at each position the longest matching
+// key is replaced. Keys are sorted by length (longest first), and then lexicographically,
+// which is also the order of the literals in the underlying Lits() matcher.
+func ReplaceMap(m map[string]string) Rewriter {
+	return replaceMap(m, "ReplaceMap")
+}
+
+func replaceMap(m map[string]string, fn string) Rewriter {
+	if len(m) == 0 {
+		return func(dest, src []byte) ([]byte, []byte) { return src, dest }
+	}
+
+	keys := make([]string, 0, len(m))
+
+	for key := range m {
+		if len(key) == 0 {
+			panic("empty key in trw." + fn + "() function")
+		}
+
+		keys = append(keys, key)
+	}
+
+	sortKeys(keys)
+
+	values := make([]string, len(keys))
+
+	for i, key := range keys {
+		values[i] = m[key]
+	}
+
+	return rewrite(Lits(keys...), func(dest, _ []byte, m []int) []byte {
+		return append(dest, values[m[2]]...)
+	})
+}
+
+// FilterWords creates a Rewriter that substitutes all occurrences of the given words with the result
+// of the given function, invoked on the matched text. Only whole words are matched, i.e., a match
+// must not be preceded or followed by a letter, a digit, or an underscore, and the ASCII letters
+// are matched case-insensitively. Where several words match at the same position, the longest
+// one is substituted. The input is scanned once, regardless of the number of words.
+func FilterWords(words []string, repl func(w []byte) []byte) Rewriter {
+	if len(words) == 0 {
+		panic("empty word list in trw.FilterWords() function")
+	}
+
+	if repl == nil {
+		panic("nil function in trw.FilterWords() function")
+	}
+
+	lower := make([]string, len(words))
+
+	for i, word := range words {
+		if len(word) == 0 {
+			panic("empty word in trw.FilterWords() function")
+		}
+
+		b := []byte(word)
+		toLower(b)
+		lower[i] = string(b)
+	}
+
+	return rewrite(newTrie(lower).words, func(dest, src []byte, m []int) []byte {
+		return append(dest, repl(src[m[0]:m[1]])...)
+	})
+}
+
+// sortKeys sorts the given strings by length, longest first, and then lexicographically.
+func sortKeys(keys []string) {
+	sort.Slice(keys, func(i, j int) bool {
+		if len(keys[i]) != len(keys[j]) {
+			return len(keys[i]) > len(keys[j])
+		}
+
+		return keys[i] < keys[j]
+	})
+}
+
+// trie is a prefix tree of string literals, stored as a state transition table.
+type trie struct {
+	class [256]int // byte to character class mapping, 0 for bytes not in any literal
+	width int      // number of character classes
+	next  []int    // transition table, indexed by state*width + class - 1; 0 is no transition
+	index []int    // literal index + 1 for terminal states, 0 otherwise
+}
+
+func newTrie(patts []string) *trie {
+	t := &trie{index: []int{0}}
+
+	for _, patt := range patts {
+		for i := 0; i < len(patt); i++ {
+			if c := patt[i]; t.class[c] == 0 {
+				t.width++
+				t.class[c] = t.width
+			}
+		}
+	}
+
+	t.next = make([]int, t.width)
+
+	for k, patt := range patts {
+		state := 0
+
+		for i := 0; i < len(patt); i++ {
+			j := state*t.width + t.class[patt[i]] - 1
+
+			if t.next[j] == 0 {
+				t.next[j] = len(t.index)
+				t.next = append(t.next, make([]int, t.width)...)
+				t.index = append(t.index, 0)
+			}
+
+			state = t.next[j]
+		}
+
+		if t.index[state] == 0 { // the first literal wins
+			t.index[state] = k + 1
+		}
+	}
+
+	return t
+}
+
+func (t *trie) match(s []byte) (ms [][]int) {
+	for i := 0; i < len(s); {
+		if t.class[s[i]] == 0 {
+			i++
+			continue
+		}
+
+		// find the literal with the lowest index starting at s[i]
+		best, end := 0, 0
+
+		for j, state := i, 0; j < len(s); j++ {
+			c := t.class[s[j]]
+
+			if c == 0 {
+				break
+			}
+
+			if state = t.next[state*t.width+c-1]; state == 0 {
+				break
+			}
+
+			if k := t.index[state]; k > 0 && (best == 0 || k < best) {
+				best, end = k, j+1
+			}
+		}
+
+		if best == 0 {
+			i++
+			continue
+		}
+
+		ms = append(ms, []int{i, end, best - 1})
+		i = end
+	}
+
+	return
+}
+
+// words is a Matcher for the longest whole words from the trie, with ASCII letters matched
+// case-insensitively.
+func (t *trie) words(s []byte) (ms [][]int) {
+	for i := 0; i < len(s); i++ {
+		if t.class[toLowerByte(s[i])] == 0 || !utf8.RuneStart(s[i]) || isWordRuneBefore(s, i) {
+			continue
+		}
+
+		end := 0
+
+		for j, state := i, 0; j < len(s); j++ {
+			c := t.class[toLowerByte(s[j])]
+
+			if c == 0 {
+				break
+			}
+
+			if state = t.next[state*t.width+c-1]; state == 0 {
+				break
+			}
+
+			if t.index[state] > 0 && !isWordRuneAt(s, j+1) {
+				end = j + 1
+			}
+		}
+
+		if end > 0 {
+			ms = append(ms, []int{i, end})
+			i = end - 1
+		}
+	}
+
+	return
+}
+
+func isWordRuneAt(s []byte, i int) bool {
+	if i >= len(s) {
+		return false
+	}
+
+	r, _ := utf8.DecodeRune(s[i:])
+	return isWordRune(r)
+}
+
+func isWordRuneBefore(s []byte, i int) bool {
+	if i == 0 {
+		return false
+	}
+
+	r, _ := utf8.DecodeLastRune(s[:i])
+	return isWordRune(r)
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,219 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestReplacePairs(t *testing.T) {
+	cases := []struct {
+		src    string
+		oldnew []string
+	}{
+		{"abc", []string{"a", "1", "b", "2"}},
+		{"abc", []string{"x", "1"}},
+		{"aaa bbb", []string{"a", "1", "aa", "2"}},
+		{"aaa bbb", []string{"aa", "2", "a", "1"}},
+		{"aaa bbb", []string{"aaa", "", "b", "BB"}},
+		{"<a href=\"x\">&</a>", []string{"&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;"}},
+		{"abcabcab", []string{"abcd", "X", "bc", "Y", "ab", "Z"}},
+		{"abab", []string{"ab", "ba", "ba", "ab"}},
+		{"xyz", []string{"xyz", "1", "xyz", "2"}},
+	}
+
+	for i, c := range cases {
+		exp := strings.NewReplacer(c.oldnew...).Replace(c.src)
+
+		if res := ReplacePairs(c.oldnew...).Do([]byte(c.src)); !bytes.Equal(res, []byte(exp)) {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), exp)
+			return
+		}
+	}
+
+	// empty old string
+	defer func() {
+		if p := recover(); p != "empty old string in trw.ReplacePairs() function" {
+			t.Errorf("Unexpected panic: %v", p)
+		}
+	}()
+
+	ReplacePairs("a", "1", "", "2")
+}
+
+func BenchmarkReplacePairs(b *testing.B) {
+	src := []byte("aa bb cc dd")
+	exp := []byte("X bb Y dd")
+	s := make([]byte, len(src), max(len(src), len(exp)))
+	fn := ReplacePairs("aa", "X", "cc", "Y").Do
+	ok := true
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for n := 0; n < b.N && ok; n++ {
+		s = s[:len(src)]
+		copy(s, src)
+		ok = bytes.Equal(fn(s), exp)
+	}
+
+	b.StopTimer()
+
+	if !ok {
+		b.Error("Benchmark failed!")
+		return
+	}
+}
+
+func TestLitsRK(t *testing.T) {
+	cases := []struct {
+		src   string
+		patts []string
+	}{
+		{"", []string{"abc"}},
+		{"ab", []string{"abc"}},
+		{"abc", []string{"abc"}},
+		{"ababab", []string{"aba", "bab"}},
+		{"xbabax", []string{"aba", "bab"}},
+		{"aaaa", []string{"aa", "aa"}},
+		{"xyz abc xyz", []string{"xyz", "abc", "zzz"}},
+		{"a\x00b\xffc", []string{"\x00", "\xff"}},
+	}
+
+	for i, c := range cases {
+		res, exp := LitsRK(c.patts...)([]byte(c.src)), Lits(c.patts...)([]byte(c.src))
+
+		if fmt.Sprint(res) != fmt.Sprint(exp) {
+			t.Errorf("[%d] Unexpected result: %v instead of %v", i, res, exp)
+			return
+		}
+	}
+}
+
+func BenchmarkLitsRK(b *testing.B) {
+	benchTokens(b, LitsRK, false)
+}
+
+func BenchmarkLitsTrie(b *testing.B) {
+	benchTokens(b, Lits, false)
+}
+
+func BenchmarkLitsRKNearMiss(b *testing.B) {
+	benchTokens(b, LitsRK, true)
+}
+
+func BenchmarkLitsTrieNearMiss(b *testing.B) {
+	benchTokens(b, Lits, true)
+}
+
+// benchTokens benchmarks scrubbing 64-byte tokens from either ordinary text, or text
+// consisting of partial matches of the tokens.
+func benchTokens(b *testing.B, fn func(...string) Matcher, nearMiss bool) {
+	tokens := make([]string, 8)
+
+	for i := range tokens {
+		tokens[i] = strings.Repeat("f", 63) + strconv.Itoa(i)
+	}
+
+	text := "some text with a key abcdef0123456789 in it\n"
+
+	if nearMiss {
+		text = strings.Repeat("f", 63) + "x\n"
+	}
+
+	src := []byte(strings.Repeat(text, 100000/len(text)) + tokens[3] + tokens[7])
+	match := fn(tokens...)
+	ok := true
+
+	b.SetBytes(int64(len(src)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for n := 0; n < b.N && ok; n++ {
+		ok = len(match(src)) == 2
+	}
+
+	b.StopTimer()
+
+	if !ok {
+		b.Error("Benchmark failed!")
+		return
+	}
+}
+
+func TestReplaceMap(t *testing.T) {
+	m := map[string]string{
+		"a": "1", "ab": "2", "abc": "3", "b": "4", "bc": "5", "c": "6", "x": "", "xyz": "7",
+	}
+
+	const src, exp = "abcabxbcxyzxy", "3257y"
+
+	// repeat to catch any dependency on the map iteration order
+	for i := 0; i < 100; i++ {
+		if res := ReplaceMap(m).Do([]byte(src)); string(res) != exp {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), exp)
+			return
+		}
+	}
+
+	if res := ReplaceMap(nil).Do([]byte(src)); string(res) != src {
+		t.Errorf("Unexpected result: %q", string(res))
+		return
+	}
+}
+
+func TestFilterWords(t *testing.T) {
+	rw := FilterWords([]string{"darn", "heck", "darn it", "хрен"}, func(w []byte) []byte {
+		return bytes.Repeat([]byte{'*'}, utf8.RuneCount(w))
+	})
+
+	cases := []struct {
+		src, exp string
+	}{
+		{"", ""},
+		{"darn", "****"},
+		{"Darn it, HECK!", "*******, ****!"},
+		{"darned heckling undarn darn_it darn2", "darned heckling undarn darn_it darn2"},
+		{"(heck) darn\theck", "(****) ****\t****"},
+		{"хрен хреновый", "**** хреновый"},
+		{"éheck héck", "éheck héck"},
+	}
+
+	for i, c := range cases {
+		if res := rw.Do([]byte(c.src)); !bytes.Equal(res, []byte(c.exp)) {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+	}
+}
@@ -0,0 +1,617 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// FoldStackTraces creates a Rewriter that detects Go, Java, and Python stack traces in the text,
+// and truncates each of them to the given number of frames, replacing the remaining frames with
+// a single summary line. For Python, where the most recent call is printed last, the bottom
+// frames are kept; for all other formats the top frames are kept.
+func FoldStackTraces(maxFrames int) Rewriter {
+	if maxFrames < 0 {
+		panic("negative number of frames in trw.FoldStackTraces() function")
+	}
+
+	return rewrite(stackTraces(maxFrames), func(dest, src []byte, m []int) []byte {
+		// m[2] is the number of frames omitted, m[3] is the stack trace kind
+		dest = append(dest, traceIndents[m[3]]...)
+		dest = strconv.AppendInt(append(dest, "..."...), int64(m[2]), 10)
+
+		if m[2] == 1 {
+			dest = append(dest, " frame omitted"...)
+		} else {
+			dest = append(dest, " frames omitted"...)
+		}
+
+		if m[1] < len(src) || src[m[1]-1] == '\n' {
+			dest = append(dest, '\n')
+		}
+
+		return dest
+	})
+}
+
+// stack trace kinds
+const (
+	traceGo = iota
+	traceJava
+	tracePython
+)
+
+var traceIndents = [...]string{traceGo: "", traceJava: "\t", tracePython: "  "}
+
+// stackTraces creates a Matcher for the stack trace frames to be omitted. In addition to the
+// index pair, each match holds the number of frames omitted, and the kind of the stack trace.
+func stackTraces(maxFrames int) Matcher {
+	return func(s []byte) (ms [][]int) {
+		for i := 0; i < len(s); {
+			end, next := nextLine(s, i)
+			line := bytes.TrimRight(s[i:end], "\r")
+
+			var m []int
+
+			switch {
+			case javaFrame(s, i) > 0:
+				m, next = foldFrames(s, i, maxFrames, traceJava)
+			case bytes.HasPrefix(line, []byte("goroutine ")) && bytes.HasSuffix(line, []byte("]:")):
+				m, next = foldFrames(s, next, maxFrames, traceGo)
+			case bytes.HasSuffix(line, []byte("Traceback (most recent call last):")):
+				m, next = foldFrames(s, next, maxFrames, tracePython)
+			}
+
+			if m != nil {
+				ms = append(ms, m)
+			}
+
+			i = next
+		}
+
+		return
+	}
+}
+
+// foldFrames scans the frames starting at s[i], and returns the match for the frames
+// to be omitted (or nil), and the index of the first line after the stack trace.
+func foldFrames(s []byte, i, maxFrames, kind int) ([]int, int) {
+	frame := [...]func([]byte, int) int{traceGo: goFrame, traceJava: javaFrame, tracePython: pythonFrame}[kind]
+
+	var starts []int
+
+	for j := frame(s, i); j > 0; j = frame(s, i) {
+		starts = append(starts, i)
+		i = j
+	}
+
+	n := len(starts) - maxFrames
+
+	if n <= 0 {
+		return nil, i
+	}
+
+	if kind == tracePython {
+		if n == len(starts) {
+			return []int{starts[0], i, n, kind}, i
+		}
+
+		return []int{starts[0], starts[n], n, kind}, i
+	}
+
+	return []int{starts[maxFrames], i, n, kind}, i
+}
+
+// Each of the frame functions below checks if there is a stack frame starting at s[i], and
+// returns the index of the first line after the frame, or -1 if there is no frame.
+
+// Java: "\tat pkg.Class.method(File.java:10)", where the location may also be "Native Method"
+// or "Unknown Source"
+func javaFrame(s []byte, i int) int {
+	end, next := nextLine(s, i)
+	line := bytes.TrimRight(s[i:end], "\r")
+
+	if len(line) == 0 || (line[0] != '\t' && line[0] != ' ') {
+		return -1
+	}
+
+	if line = bytes.TrimLeft(line, " \t"); !bytes.HasPrefix(line, []byte("at ")) {
+		return -1
+	}
+
+	// method name, like "java.base/pkg.Class$Inner.<init>"
+	line = line[3:]
+	k := 0
+
+	for k < len(line) && (isIdent(line[k]) || bytes.IndexByte([]byte("$.<>/@-"), line[k]) >= 0) {
+		k++
+	}
+
+	if k == 0 || k == len(line) || line[k] != '(' || bytes.IndexByte(line[:k], '.') < 0 {
+		return -1
+	}
+
+	// location
+	if loc := line[k+1:]; len(loc) > 0 && loc[len(loc)-1] == ')' && isJavaLocation(loc[:len(loc)-1]) {
+		return next
+	}
+
+	return -1
+}
+
+// isJavaLocation checks if the given string is a Java frame location, like "File.java:10".
+func isJavaLocation(loc []byte) bool {
+	if string(loc) == "Native Method" || string(loc) == "Unknown Source" {
+		return true
+	}
+
+	// optional line number
+	if k := bytes.LastIndexByte(loc, ':'); k >= 0 {
+		if k+1 == len(loc) {
+			return false
+		}
+
+		for _, c := range loc[k+1:] {
+			if !isDigit(c) {
+				return false
+			}
+		}
+
+		loc = loc[:k]
+	}
+
+	// file name
+	k := bytes.LastIndexByte(loc, '.')
+
+	if k <= 0 || k+1 == len(loc) {
+		return false
+	}
+
+	for _, c := range loc {
+		if !isIdent(c) && c != '.' && c != '$' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Go: "pkg.function(...)\n\t/path/file.go:10 +0x1d"
+func goFrame(s []byte, i int) int {
+	end, next := nextLine(s, i)
+
+	if end == i || s[i] == '\t' || s[i] == ' ' || next == len(s) {
+		return -1
+	}
+
+	// source location
+	i = next
+
+	if end, next = nextLine(s, i); s[i] == '\t' && bytes.Contains(s[i:end], []byte(".go:")) {
+		return next
+	}
+
+	return -1
+}
+
+// Python: "  File \"file.py\", line 10, in function\n    source line"
+func pythonFrame(s []byte, i int) int {
+	end, next := nextLine(s, i)
+
+	if !bytes.HasPrefix(s[i:end], []byte("  File \"")) {
+		return -1
+	}
+
+	// source line(s), indented deeper than the frame header
+	for next < len(s) && bytes.HasPrefix(s[next:], []byte("    ")) {
+		_, next = nextLine(s, next)
+	}
+
+	return next
+}
+
+// nextLine returns the end index of the line starting at s[i] (excluding the newline),
+// and the start index of the next line.
+func nextLine(s []byte, i int) (end, next int) {
+	if k := bytes.IndexByte(s[i:], '\n'); k >= 0 {
+		return i + k, i + k + 1
+	}
+
+	return len(s), len(s)
+}
+
+// DeleteLinesContaining creates a Rewriter that removes every line containing the given literal,
+// including its newline, like "grep -v" does. It is a faster equivalent of deleting the matches
+// of a line-level Matcher, with the literal search and the line scan combined in one pass.
+// The literal must not contain newlines.
+func DeleteLinesContaining(lit string) Rewriter {
+	if len(lit) == 0 {
+		panic("empty literal in trw.DeleteLinesContaining() function")
+	}
+
+	if strings.IndexByte(lit, '\n') >= 0 {
+		panic("newline in the literal in trw.DeleteLinesContaining() function")
+	}
+
+	patt := []byte(lit)
+
+	return func(unused, src []byte) ([]byte, []byte) {
+		// i is the end of the result, j is the start of the unprocessed part (always a line start)
+		i, j := 0, 0
+
+		for j < len(src) {
+			k := bytes.Index(src[j:], patt)
+
+			if k < 0 {
+				break
+			}
+
+			k += j
+			start := j + bytes.LastIndexByte(src[j:k], '\n') + 1
+
+			if i < j {
+				i += copy(src[i:], src[j:start])
+			} else {
+				i = start
+			}
+
+			_, j = nextLine(src, k)
+		}
+
+		if i == j {
+			return src, unused
+		}
+
+		return src[:i+copy(src[i:], src[j:])], unused
+	}
+}
+
+// CollapseRepeats creates a Rewriter that replaces every run of identical non-empty lines
+// with the first line of the run followed by a summary line built from the given format,
+// where every occurrence of "${n}" is replaced with the number of the repeated lines
+// omitted. A positive window limits the number of lines collapsed into one summary line.
+func CollapseRepeats(window int, format string) Rewriter {
+	return collapseRepeats(window, format, nil)
+}
+
+// CollapseRepeatsBy creates a Rewriter like CollapseRepeats, but the lines are compared with
+// all the matches of the given Matcher removed, so that, for example, lines differing only in
+// their timestamps are treated as identical. The first line of each run is kept intact.
+func CollapseRepeatsBy(match Matcher, window int, format string) Rewriter {
+	if match == nil {
+		panic("nil matcher in trw.CollapseRepeatsBy() function")
+	}
+
+	return collapseRepeats(window, format, match)
+}
+
+func collapseRepeats(window int, format string, match Matcher) Rewriter {
+	parts := strings.Split(format, "${n}")
+
+	return rewrite(repeatedLines(window, match), func(dest, _ []byte, m []int) []byte {
+		// m[2] holds the number of repeated lines
+		return appendNumbered(dest, parts, int64(m[2]))
+	})
+}
+
+// repeatedLines creates a Matcher for runs of repeated lines, excluding the first line of each
+// run and the newline at the end of the last line. Every match also holds the number of lines.
+func repeatedLines(window int, match Matcher) Matcher {
+	// line normalisation
+	key := func(_, line []byte) []byte { return line }
+
+	if match != nil {
+		key = func(buff, line []byte) []byte {
+			return appendUnmatched(buff[:0], line, match(line))
+		}
+	}
+
+	return func(s []byte) (ms [][]int) {
+		var prev, curr []byte
+
+		end, i := nextLine(s, 0)
+		prev = key(prev, s[:end])
+
+		for i < len(s) {
+			start, last, n := i, 0, 0
+
+			for i < len(s) && (window <= 0 || n < window) {
+				end, next := nextLine(s, i)
+
+				if curr = key(curr, s[i:end]); len(curr) == 0 || !bytes.Equal(curr, prev) {
+					break
+				}
+
+				last, i, n = end, next, n+1
+			}
+
+			if n > 0 {
+				ms = append(ms, []int{start, last, n})
+				continue
+			}
+
+			// not a repeat
+			prev, curr = curr, prev
+			_, i = nextLine(s, i)
+		}
+
+		return
+	}
+}
+
+// appendUnmatched appends to the destination slice all the parts of the source
+// that are not covered by the given matches.
+func appendUnmatched(dest, src []byte, ms [][]int) []byte {
+	i := 0
+
+	for _, m := range ms {
+		dest = append(dest, src[i:m[0]]...)
+		i = m[1]
+	}
+
+	return append(dest, src[i:]...)
+}
+
+// SetField creates a Rewriter that sets the value of the given key in every non-empty line
+// of logfmt-formatted text (i.e., sequences of key=value pairs), adding the key=value pair
+// to the end of the line if the key is not present there. The value is quoted if necessary.
+func SetField(key, value string) Rewriter {
+	checkFieldKey(key, "SetField")
+
+	value = quoteFieldValue(value)
+	repl := [...]string{"=" + value, " " + key + "=" + value}
+
+	match := func(s []byte) (ms [][]int) {
+		for i := 0; i < len(s); {
+			end, next := nextLine(s, i)
+			found := false
+
+			scanFields(s, i, end, func(f field) {
+				if string(s[f.k0:f.k1]) == key {
+					ms = append(ms, []int{f.k1, f.v1, 0})
+					found = true
+				}
+			})
+
+			if end = trimLineEnd(s, i, end); !found && end > i {
+				ms = append(ms, []int{end, end, 1})
+			}
+
+			i = next
+		}
+
+		return
+	}
+
+	return rewrite(match, func(dest, _ []byte, m []int) []byte {
+		return append(dest, repl[m[2]]...)
+	})
+}
+
+// DropField creates a Rewriter that removes all key=value pairs with the given key
+// from logfmt-formatted text.
+func DropField(key string) Rewriter {
+	checkFieldKey(key, "DropField")
+
+	return Delete(fieldMatcher(key, func(s []byte, f field) []int {
+		if f.first {
+			// remove the pair and the whitespace after it
+			j := f.v1
+
+			for j < len(s) && (s[j] == ' ' || s[j] == '\t') {
+				j++
+			}
+
+			return []int{f.k0, j}
+		}
+
+		// remove the pair and the whitespace before it
+		return []int{f.ws, f.v1}
+	}))
+}
+
+// RenameField creates a Rewriter that renames all the keys matching the given old name
+// in logfmt-formatted text.
+func RenameField(oldKey, newKey string) Rewriter {
+	checkFieldKey(oldKey, "RenameField")
+	checkFieldKey(newKey, "RenameField")
+
+	return Replace(fieldMatcher(oldKey, func(_ []byte, f field) []int {
+		return []int{f.k0, f.k1}
+	}), newKey)
+}
+
+// RewriteLogfmtValue creates a Rewriter that applies the given Rewriter to the values of all
+// key=value pairs with the given key in logfmt-formatted text, as in
+// RewriteLogfmtValue("password", Mask('*', 0)). The Rewriter sees quoted values unquoted, and
+// the result is quoted if necessary; values that are not changed by the Rewriter are kept as
+// they are. Bare keys without a value are ignored.
+func RewriteLogfmtValue(key string, rw Rewriter) Rewriter {
+	checkFieldKey(key, "RewriteLogfmtValue")
+
+	if rw == nil {
+		panic("nil rewriter in trw.RewriteLogfmtValue() function")
+	}
+
+	match := fieldMatcher(key, func(_ []byte, f field) []int {
+		if f.v0 == f.k1 { // bare key
+			return nil
+		}
+
+		return []int{f.v0, f.v1}
+	})
+
+	return rewrite(match, func(dest, src []byte, m []int) []byte {
+		raw := src[m[0]:m[1]]
+		value := string(raw)
+
+		if len(raw) > 1 && raw[0] == '"' && raw[len(raw)-1] == '"' {
+			if v, err := strconv.Unquote(value); err == nil {
+				value = v
+			}
+		}
+
+		if res := rw.Do([]byte(value)); string(res) != value {
+			return append(dest, quoteFieldValue(string(res))...)
+		}
+
+		return append(dest, raw...)
+	})
+}
+
+// field is the location of a key=value pair in logfmt-formatted text.
+type field struct {
+	ws, k0, k1, v0, v1 int  // whitespace, key, and value (same as k1 for bare keys)
+	first              bool // first pair on the line
+}
+
+// fieldMatcher creates a Matcher for all the key=value pairs with the given key,
+// with the match location computed by the given function.
+func fieldMatcher(key string, loc func([]byte, field) []int) Matcher {
+	return func(s []byte) (ms [][]int) {
+		for i := 0; i < len(s); {
+			end, next := nextLine(s, i)
+
+			scanFields(s, i, end, func(f field) {
+				if string(s[f.k0:f.k1]) == key {
+					if m := loc(s, f); m != nil {
+						ms = append(ms, m)
+					}
+				}
+			})
+
+			i = next
+		}
+
+		return
+	}
+}
+
+// scanFields invokes the given function for each key=value pair on the line s[i:end].
+func scanFields(s []byte, i, end int, fn func(field)) {
+	first := true
+
+	for i < end {
+		f := field{ws: i, first: first}
+
+		for i < end && (s[i] == ' ' || s[i] == '\t' || s[i] == '\r') {
+			i++
+		}
+
+		if i == end {
+			break
+		}
+
+		// key
+		for f.k0 = i; i < end && !isFieldDelim(s[i]); i++ {
+		}
+
+		if f.k1 = i; f.k1 == f.k0 {
+			// not a key, skip to the next whitespace
+			i = skipFieldValue(s, i, end)
+			continue
+		}
+
+		f.v0, f.v1 = i, i
+
+		// value
+		if i < end && s[i] == '=' {
+			f.v0 = i + 1
+			i = skipFieldValue(s, f.v0, end)
+			f.v1 = i
+		}
+
+		fn(f)
+		first = false
+	}
+}
+
+// skipFieldValue returns the index of the first byte after the (possibly quoted) value at s[i].
+func skipFieldValue(s []byte, i, end int) int {
+	if i < end && s[i] == '"' {
+		for i++; i < end; i++ {
+			switch s[i] {
+			case '"':
+				return i + 1
+			case '\\':
+				i++
+			}
+		}
+
+		return end
+	}
+
+	for i < end && s[i] != ' ' && s[i] != '\t' && s[i] != '\r' {
+		i++
+	}
+
+	return i
+}
+
+func isFieldDelim(c byte) bool {
+	return c == '=' || c == '"' || c == ' ' || c == '\t' || c == '\r'
+}
+
+// trimLineEnd returns the end index of the line s[i:end] with trailing whitespace removed.
+func trimLineEnd(s []byte, i, end int) int {
+	for end > i && (s[end-1] == ' ' || s[end-1] == '\t' || s[end-1] == '\r') {
+		end--
+	}
+
+	return end
+}
+
+func checkFieldKey(key, fn string) {
+	if len(key) == 0 {
+		panic("empty key in trw." + fn + "() function")
+	}
+
+	for i := 0; i < len(key); i++ {
+		if isFieldDelim(key[i]) || key[i] == '\n' {
+			panic("invalid key " + strconv.Quote(key) + " in trw." + fn + "() function")
+		}
+	}
+}
+
+// quoteFieldValue quotes the given logfmt value, if necessary.
+func quoteFieldValue(value string) string {
+	if len(value) == 0 {
+		return `""`
+	}
+
+	for _, c := range value {
+		if c <= ' ' || c == '=' || c == '"' || c == '\\' || !strconv.IsPrint(c) {
+			return strconv.Quote(value)
+		}
+	}
+
+	return value
+}
@@ -0,0 +1,259 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFoldStackTraces(t *testing.T) {
+	cases := []struct {
+		src, exp string
+	}{
+		{"no traces here\n", "no traces here\n"},
+		// Java
+		{
+			"java.lang.Exception: oops\n\tat a.B.c(B.java:1)\n\tat a.B.d(B.java:2)\n\tat a.B.e(B.java:3)\n\tat a.B.f(B.java:4)\nnext line\n",
+			"java.lang.Exception: oops\n\tat a.B.c(B.java:1)\n\tat a.B.d(B.java:2)\n\t...2 frames omitted\nnext line\n",
+		},
+		{
+			"java.lang.Exception: oops\n\tat a.B.c(B.java:1)\n\tat a.B.d(B.java:2)\n",
+			"java.lang.Exception: oops\n\tat a.B.c(B.java:1)\n\tat a.B.d(B.java:2)\n",
+		},
+		{
+			"E: x\n\tat a.B.c(B.java:1)\n\tat a.B.d(B.java:2)\n\tat a.B.e(B.java:3)\nCaused by: y\n\tat a.C.c(C.java:1)\n\tat a.C.d(C.java:2)\n\tat a.C.e(C.java:3)\n\t... 1 more",
+			"E: x\n\tat a.B.c(B.java:1)\n\tat a.B.d(B.java:2)\n\t...1 frame omitted\nCaused by: y\n\tat a.C.c(C.java:1)\n\tat a.C.d(C.java:2)\n\t...1 frame omitted\n\t... 1 more",
+		},
+		{
+			"Meeting notes:\n    at the store we met\nend\n",
+			"Meeting notes:\n    at the store we met\nend\n",
+		},
+		{
+			"E: x\n\tat java.base/a.B$C.<init>(Native Method)\n\tat a.B.d(Unknown Source)\n\tat a.B.e(B.kt:3)\r\n\tat a.B.f(B.java)\n",
+			"E: x\n\tat java.base/a.B$C.<init>(Native Method)\n\tat a.B.d(Unknown Source)\n\t...2 frames omitted\n",
+		},
+		// Go
+		{
+			"panic: oops\n\ngoroutine 1 [running]:\nmain.c()\n\t/x/main.go:3 +0x1\nmain.b()\n\t/x/main.go:2 +0x2\nmain.a()\n\t/x/main.go:1 +0x3\nexit status 2",
+			"panic: oops\n\ngoroutine 1 [running]:\nmain.c()\n\t/x/main.go:3 +0x1\nmain.b()\n\t/x/main.go:2 +0x2\n...1 frame omitted\nexit status 2",
+		},
+		{
+			"goroutine 1 [running]:\nmain.c()\n\t/x/main.go:3 +0x1\nmain.b()\n\t/x/main.go:2 +0x2\nmain.a()\n\t/x/main.go:1 +0x3",
+			"goroutine 1 [running]:\nmain.c()\n\t/x/main.go:3 +0x1\nmain.b()\n\t/x/main.go:2 +0x2\n...1 frame omitted",
+		},
+		// Python
+		{
+			"Traceback (most recent call last):\n  File \"a.py\", line 1, in <module>\n    a()\n  File \"a.py\", line 2, in a\n    b()\n  File \"a.py\", line 3, in b\n    c()\nValueError: oops\n",
+			"Traceback (most recent call last):\n  ...1 frame omitted\n  File \"a.py\", line 2, in a\n    b()\n  File \"a.py\", line 3, in b\n    c()\nValueError: oops\n",
+		},
+	}
+
+	for i, c := range cases {
+		if res := FoldStackTraces(2).Do([]byte(c.src)); !bytes.Equal(res, []byte(c.exp)) {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+	}
+
+	// all frames omitted
+	const src = "Traceback (most recent call last):\n  File \"a.py\", line 1, in <module>\n    a()\n  File \"a.py\", line 2, in a\n    b()\nValueError: oops\n"
+	const exp = "Traceback (most recent call last):\n  ...2 frames omitted\nValueError: oops\n"
+
+	if res := FoldStackTraces(0).Do([]byte(src)); !bytes.Equal(res, []byte(exp)) {
+		t.Errorf("Unexpected result: %q instead of %q", string(res), exp)
+		return
+	}
+
+	// not a stack trace
+	const prose = "Meeting notes:\n    at the store we met\n\tat a glance (see above)\nend\n"
+
+	if res := FoldStackTraces(0).Do([]byte(prose)); !bytes.Equal(res, []byte(prose)) {
+		t.Errorf("Unexpected result: %q", string(res))
+		return
+	}
+}
+
+func TestDeleteLinesContaining(t *testing.T) {
+	cases := []struct {
+		src, lit, exp string
+	}{
+		{"", "a", ""},
+		{"abc", "b", ""},
+		{"abc", "x", "abc"},
+		{"abc\n", "b", ""},
+		{"abc\nxyz", "y", "abc\n"},
+		{"abc\nxyz\n", "a", "xyz\n"},
+		{"a1\nb\na2\na3\nc\na4", "a", "b\nc\n"},
+		{"x\n\nx\n", "x", "\n"},
+		{"aaa\nbab\nbbb\n", "ab", "aaa\nbbb\n"},
+	}
+
+	for i, c := range cases {
+		if res := DeleteLinesContaining(c.lit).Do([]byte(c.src)); string(res) != c.exp {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+	}
+}
+
+func BenchmarkDeleteLinesContaining(b *testing.B) {
+	benchDeleteLines(b, DeleteLinesContaining("ERROR"))
+}
+
+func BenchmarkDeleteLinesContainingPatt(b *testing.B) {
+	benchDeleteLines(b, Delete(Patt(`(?m)^.*ERROR.*(?:\n|$)`)))
+}
+
+func benchDeleteLines(b *testing.B, rw Rewriter) {
+	line := []byte("2020-01-02T15:04:05Z INFO request served in 42ms from 10.0.0.1\n")
+	src := bytes.Repeat(line, 1000)
+
+	for i := 0; i < len(src); i += 10 * len(line) {
+		copy(src[i+21:], "ERROR")
+	}
+
+	exp := bytes.Repeat(line, 900)
+	s := make([]byte, len(src))
+	ok := true
+
+	b.SetBytes(int64(len(src)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for n := 0; n < b.N && ok; n++ {
+		copy(s, src)
+		ok = bytes.Equal(rw.Do(s), exp)
+	}
+
+	b.StopTimer()
+
+	if !ok {
+		b.Error("Benchmark failed!")
+		return
+	}
+}
+
+func TestCollapseRepeats(t *testing.T) {
+	cases := []struct {
+		src, exp string
+		window   int
+	}{
+		{"a\nb\nc\n", "a\nb\nc\n", 0},
+		{"a\na\na\nb\n", "a\n(repeated 2 times)\nb\n", 0},
+		{"a\na\na\nb\nb", "a\n(repeated 2 times)\nb\n(repeated 1 times)", 0},
+		{"\n\n\na\n", "\n\n\na\n", 0},
+		{"a\na\na\na\na\n", "a\n(repeated 2 times)\n(repeated 2 times)\n", 2},
+		{"a\nb\na\n", "a\nb\na\n", 0},
+	}
+
+	for i, c := range cases {
+		if res := CollapseRepeats(c.window, "(repeated ${n} times)").Do([]byte(c.src)); !bytes.Equal(res, []byte(c.exp)) {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+	}
+}
+
+func TestCollapseRepeatsBy(t *testing.T) {
+	const src = "10:01 error: disk full\n10:02 error: disk full\n10:03 error: disk full\n10:04 ok\n"
+	const exp = "10:01 error: disk full\nlast message repeated 2 times\n10:04 ok\n"
+
+	rw := CollapseRepeatsBy(Patt(`^\d\d:\d\d`), 0, "last message repeated ${n} times")
+
+	if res := rw.Do([]byte(src)); !bytes.Equal(res, []byte(exp)) {
+		t.Errorf("Unexpected result: %q instead of %q", string(res), exp)
+		return
+	}
+}
+
+func TestLogFields(t *testing.T) {
+	const src = `ts=1 level=info msg="user \"bob\" logged in" user=bob` + "\n" +
+		`level=error user=alice` + "\n\n" +
+		`user=eve level=debug flag` + "\r\n"
+
+	cases := []struct {
+		rw  Rewriter
+		exp string
+	}{
+		{
+			SetField("user", "x"),
+			`ts=1 level=info msg="user \"bob\" logged in" user=x` + "\n" +
+				`level=error user=x` + "\n\n" +
+				`user=x level=debug flag` + "\r\n",
+		},
+		{
+			SetField("flag", "on off"),
+			`ts=1 level=info msg="user \"bob\" logged in" user=bob flag="on off"` + "\n" +
+				`level=error user=alice flag="on off"` + "\n\n" +
+				`user=eve level=debug flag="on off"` + "\r\n",
+		},
+		{
+			DropField("user"),
+			`ts=1 level=info msg="user \"bob\" logged in"` + "\n" +
+				`level=error` + "\n\n" +
+				`level=debug flag` + "\r\n",
+		},
+		{
+			DropField("msg"),
+			`ts=1 level=info user=bob` + "\n" +
+				`level=error user=alice` + "\n\n" +
+				`user=eve level=debug flag` + "\r\n",
+		},
+		{
+			RewriteLogfmtValue("user", Mask('*', 1)),
+			`ts=1 level=info msg="user \"bob\" logged in" user=**b` + "\n" +
+				`level=error user=****e` + "\n\n" +
+				`user=**e level=debug flag` + "\r\n",
+		},
+		{
+			RewriteLogfmtValue("msg", ReplacePairs("bob", "x")),
+			`ts=1 level=info msg="user \"x\" logged in" user=bob` + "\n" +
+				`level=error user=alice` + "\n\n" +
+				`user=eve level=debug flag` + "\r\n",
+		},
+		{
+			RewriteLogfmtValue("flag", Mask('*', 0)),
+			src,
+		},
+		{
+			RenameField("level", "lvl"),
+			`ts=1 lvl=info msg="user \"bob\" logged in" user=bob` + "\n" +
+				`lvl=error user=alice` + "\n\n" +
+				`user=eve lvl=debug flag` + "\r\n",
+		},
+	}
+
+	for i, c := range cases {
+		if res := c.rw.Do([]byte(src)); !bytes.Equal(res, []byte(c.exp)) {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+	}
+}
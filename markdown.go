@@ -0,0 +1,295 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import "bytes"
+
+// MarkdownCode creates a Matcher for the fenced code blocks (delimited by lines of three or more
+// backticks or tildes) and the inline code spans (delimited by equal runs of backticks)
+// in Markdown text. A fenced block is matched from the start of its opening line to the end
+// of its closing line, excluding the newline, or to the end of the text if the block is not
+// closed. Code spans do not extend past a blank line. Indented code blocks are not recognised.
+func MarkdownCode() Matcher {
+	return func(s []byte) (ms [][]int) {
+		lineStart := true
+
+		for i := 0; i < len(s); {
+			if lineStart {
+				lineStart = false
+
+				if end := markdownFence(s, i); end > 0 {
+					ms = append(ms, []int{i, end})
+					i = end
+					continue
+				}
+			}
+
+			switch c := s[i]; {
+			case c == '\n':
+				lineStart = true
+				i++
+
+			case c == '`' && (i == 0 || s[i-1] != '\\'):
+				n := 1
+
+				for i+n < len(s) && s[i+n] == '`' {
+					n++
+				}
+
+				if end := closeCodeSpan(s, i+n, n); end > 0 {
+					ms = append(ms, []int{i, end})
+					i = end
+				} else {
+					i += n
+				}
+
+			default:
+				i++
+			}
+		}
+
+		return
+	}
+}
+
+// ProtectMarkdownCode creates a Rewriter that applies the given Rewriter to Markdown text outside
+// of the code blocks and code spans, as recognised by MarkdownCode(), so that prose-level rewrites
+// (like smart quotes or typo fixes) do not touch code samples. The Rewriter is applied to each
+// piece of text between the code regions separately, so it never sees the code, and cannot match
+// across it.
+func ProtectMarkdownCode(rw Rewriter) Rewriter {
+	if rw == nil {
+		panic("nil rewriter in trw.ProtectMarkdownCode() function")
+	}
+
+	return outside(MarkdownCode(), rw)
+}
+
+// outside creates a Rewriter that applies the given Rewriter separately to each piece of text
+// between the matches.
+func outside(match Matcher, rw Rewriter) Rewriter {
+	return func(dest, src []byte) ([]byte, []byte) {
+		ms := match(src)
+
+		if len(ms) == 0 {
+			return rw(dest, src)
+		}
+
+		if len(src) > cap(dest) {
+			dest = make([]byte, 0, len(src)+len(src)/5) // +20%
+		}
+
+		dest = dest[:0]
+
+		var work, spare []byte // rewriter buffers
+
+		i := 0
+
+		for _, m := range ms {
+			if m[0] > i {
+				work, spare = rw(spare[:0], append(work[:0], src[i:m[0]]...))
+				dest = append(dest, work...)
+			}
+
+			dest = append(dest, src[m[0]:m[1]]...)
+			i = m[1]
+		}
+
+		if i < len(src) {
+			work, _ = rw(spare[:0], append(work[:0], src[i:]...))
+			dest = append(dest, work...)
+		}
+
+		return dest, src
+	}
+}
+
+// markdownFence returns the end of the fenced code block starting at the line s[i:], or -1 if the line
+// is not an opening code fence.
+func markdownFence(s []byte, i int) int {
+	c, n := codeFence(s, i)
+
+	if n == 0 {
+		return -1
+	}
+
+	end, next := nextLine(s, i)
+
+	// an info string of a backtick fence may not contain backticks
+	if c == '`' && bytes.IndexByte(bytes.TrimLeft(s[i:end], " ")[n:], '`') >= 0 {
+		return -1
+	}
+
+	for i = next; i < len(s); i = next {
+		end, next = nextLine(s, i)
+
+		if cc, k := codeFence(s, i); cc == c && k >= n && len(bytes.Trim(bytes.TrimLeft(s[i:end], " ")[k:], " \t\r")) == 0 {
+			return end
+		}
+	}
+
+	return len(s)
+}
+
+// codeFence checks if the line starting at s[i] begins with a code fence, returning the fence
+// character and the length of the fence, or 0 if there is no fence.
+func codeFence(s []byte, i int) (byte, int) {
+	for k := 0; k < 3 && i < len(s) && s[i] == ' '; k++ {
+		i++
+	}
+
+	if i == len(s) || (s[i] != '`' && s[i] != '~') {
+		return 0, 0
+	}
+
+	c, n := s[i], 0
+
+	for i+n < len(s) && s[i+n] == c {
+		n++
+	}
+
+	if n < 3 {
+		return 0, 0
+	}
+
+	return c, n
+}
+
+// closeCodeSpan returns the end of the code span opened by a run of n backticks just before s[i],
+// or -1 if the span is not closed before a blank line or the end of the text.
+func closeCodeSpan(s []byte, i, n int) int {
+	for i < len(s) {
+		switch s[i] {
+		case '`':
+			k := 1
+
+			for i+k < len(s) && s[i+k] == '`' {
+				k++
+			}
+
+			if k == n {
+				return i + k
+			}
+
+			i += k
+
+		case '\n':
+			if j := i + 1; j < len(s) && (s[j] == '\n' || (s[j] == '\r' && j+1 < len(s) && s[j+1] == '\n')) {
+				return -1
+			}
+
+			i++
+
+		default:
+			i++
+		}
+	}
+
+	return -1
+}
+
+// SplitFrontMatter splits the given document into the front matter and the body. The front matter
+// is either YAML, delimited by "---" lines (the closing line may also be "..."), or TOML, delimited
+// by "+++" lines, and must start at the very beginning of the document. The returned meta slice is
+// the content of the front matter without the delimiter lines, and the body is everything after
+// the closing delimiter line. If there is no front matter, the meta slice is nil, and the body is
+// the whole document. Both slices share memory with the document.
+func SplitFrontMatter(doc []byte) (meta, body []byte) {
+	m0, m1, b0 := frontMatter(doc)
+
+	if b0 < 0 {
+		return nil, doc
+	}
+
+	return doc[m0:m1], doc[b0:]
+}
+
+// WithFrontMatter creates a Rewriter that applies the first given Rewriter to the front matter
+// of the document, and the second one to the body, as split by SplitFrontMatter(). The delimiter
+// lines are kept intact. A nil Rewriter leaves the corresponding part unchanged. For a document
+// without front matter, only the body Rewriter is applied.
+func WithFrontMatter(metaRW, bodyRW Rewriter) Rewriter {
+	if metaRW == nil && bodyRW == nil {
+		panic("no rewriters in trw.WithFrontMatter() function")
+	}
+
+	apply := func(rw Rewriter, s []byte) []byte {
+		if rw == nil {
+			return s
+		}
+
+		return rw.DoCopy(s)
+	}
+
+	return func(dest, src []byte) ([]byte, []byte) {
+		m0, m1, b0 := frontMatter(src)
+
+		if b0 < 0 {
+			if bodyRW == nil {
+				return src, dest
+			}
+
+			return bodyRW(dest, src)
+		}
+
+		meta, body := apply(metaRW, src[m0:m1]), apply(bodyRW, src[b0:])
+
+		if n := m0 + len(meta) + (b0 - m1) + len(body); n > cap(dest) {
+			dest = make([]byte, 0, n+n/5) // +20%
+		}
+
+		dest = append(append(dest[:0], src[:m0]...), meta...)
+		dest = append(append(dest, src[m1:b0]...), body...)
+
+		return dest, src
+	}
+}
+
+// frontMatter locates the front matter of the document, returning the bounds of its content,
+// and the start of the body, or -1 values if there is no front matter.
+func frontMatter(s []byte) (m0, m1, b0 int) {
+	end, next := nextLine(s, 0)
+	open := string(bytes.TrimRight(s[:end], " \t\r"))
+
+	if (open != "---" && open != "+++") || next == end {
+		return -1, -1, -1
+	}
+
+	for i := next; i < len(s); {
+		end, n := nextLine(s, i)
+
+		if line := string(bytes.TrimRight(s[i:end], " \t\r")); line == open || (open == "---" && line == "...") {
+			return next, i, n
+		}
+
+		i = n
+	}
+
+	return -1, -1, -1
+}
@@ -0,0 +1,120 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMarkdownCode(t *testing.T) {
+	cases := []struct {
+		src string
+		exp [][]int
+	}{
+		{"", nil},
+		{"no code", nil},
+		{"a `b` c", [][]int{{2, 5}}},
+		{"a ``b ` c`` d", [][]int{{2, 11}}},
+		{"a `b", nil},
+		{"a \\`b` c", nil},
+		{"a `b\nc` d", [][]int{{2, 7}}},
+		{"a `b\n\nc` d", nil},
+		{"```go\nx := `a`\n```\ntext `b`", [][]int{{0, 18}, {24, 27}}},
+		{"  ~~~\ncode\n  ~~~~ \nafter", [][]int{{0, 18}}},
+		{"```\nnot closed\n``", [][]int{{0, 17}}},
+		{"~~~\n```\n~~~\n", [][]int{{0, 11}}},
+		{"``` a`b\ntext", nil},
+		{"    ```\ncode", nil},
+	}
+
+	for i, c := range cases {
+		if res := MarkdownCode()([]byte(c.src)); !reflect.DeepEqual(res, c.exp) {
+			t.Errorf("[%d] Unexpected result: %v instead of %v", i, res, c.exp)
+			return
+		}
+	}
+}
+
+func TestProtectMarkdownCode(t *testing.T) {
+	rw := ProtectMarkdownCode(Seq(Replace(Lit("teh"), "the"), Replace(Lit("\""), "”")))
+
+	cases := []struct {
+		src, exp string
+	}{
+		{"", ""},
+		{"teh \"cat\"", "the ”cat”"},
+		{"teh `teh \"x\"` teh", "the `teh \"x\"` the"},
+		{"teh\n```\nteh \"x\"\n```\nteh", "the\n```\nteh \"x\"\n```\nthe"},
+		{"`teh`", "`teh`"},
+	}
+
+	for i, c := range cases {
+		if res := rw.Do([]byte(c.src)); string(res) != c.exp {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+	}
+}
+
+func TestFrontMatter(t *testing.T) {
+	rw := WithFrontMatter(Replace(Lit("draft: true"), "draft: false"), Replace(Lit("true"), "TRUE"))
+
+	cases := []struct {
+		src, exp, meta string
+	}{
+		{"", "", ""},
+		{"true", "TRUE", ""},
+		{"---\ndraft: true\n---\nis true\n", "---\ndraft: false\n---\nis TRUE\n", "draft: true\n"},
+		{"+++\ndraft: true\n+++\r\ntrue", "+++\ndraft: false\n+++\r\nTRUE", "draft: true\n"},
+		{"---\ndraft: true\n...\ntrue", "---\ndraft: false\n...\nTRUE", "draft: true\n"},
+		{"---\n---\ntrue", "---\n---\nTRUE", ""},
+		{"---\ndraft: true\n", "---\ndraft: TRUE\n", ""},
+		{"---", "---", ""},
+		{" ---\ndraft: true\n---\n", " ---\ndraft: TRUE\n---\n", ""},
+	}
+
+	for i, c := range cases {
+		if meta, _ := SplitFrontMatter([]byte(c.src)); string(meta) != c.meta {
+			t.Errorf("[%d] Unexpected front matter: %q instead of %q", i, string(meta), c.meta)
+			return
+		}
+
+		if res := rw.Do([]byte(c.src)); string(res) != c.exp {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+	}
+
+	// body only
+	if res := WithFrontMatter(nil, Delete(Lit("x"))).Do([]byte("+++\nx\n+++\nx")); string(res) != "+++\nx\n+++\n" {
+		t.Errorf("Unexpected result: %q", string(res))
+		return
+	}
+}
@@ -0,0 +1,148 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"sort"
+	"strconv"
+)
+
+// NewMatcher creates a Matcher from the given function, validating and normalising every list
+// of matches it returns, so that a custom Matcher behaves consistently with those from this package
+// in Delete(), Replace(), Expand(), and the other Rewriters.
+//
+// The function is invoked with the input text, and returns the index pairs of the matches,
+// each optionally followed by any number of extra ints (like the kind of the match), which are
+// passed through to the Rewriters. The function must not modify or retain the input, nor retain
+// the returned list, which may be modified by the Matcher. The matches
+// may be returned in any order, and may overlap; the list is then sorted by the start index (longer
+// matches first), and every match overlapping the preceding one is discarded, or, with MergeOverlapping()
+// option, merged into it. An empty match at the end of the preceding match is discarded, as in
+// the regexp package. A match with the indices out of the input bounds, or with the end index
+// before the start index, is a bug in the function, and causes a panic.
+func NewMatcher(fn func([]byte) [][]int, opts ...MatcherOption) Matcher {
+	if fn == nil {
+		panic("nil function in trw.NewMatcher() function")
+	}
+
+	var o matcherOptions
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return func(s []byte) [][]int {
+		ms := fn(s)
+
+		if len(ms) == 0 {
+			return nil
+		}
+
+		for _, m := range ms {
+			if len(m) < 2 || m[0] < 0 || m[1] < m[0] || m[1] > len(s) {
+				panic("invalid match " + formatMatch(m) + " from the function in trw.NewMatcher() matcher")
+			}
+		}
+
+		return o.normalise(ms)
+	}
+}
+
+// MatcherOption is a type of a function that configures a Matcher created by NewMatcher().
+type MatcherOption func(*matcherOptions)
+
+type matcherOptions struct {
+	merge     bool // merge overlapping matches
+	dropEmpty bool // discard empty matches
+}
+
+// MergeOverlapping creates a MatcherOption that makes the Matcher merge every match overlapping
+// the preceding one into it, instead of discarding it. The extra ints of the merged match are
+// those of its first part.
+func MergeOverlapping() MatcherOption {
+	return func(o *matcherOptions) { o.merge = true }
+}
+
+// DropEmpty creates a MatcherOption that makes the Matcher discard all empty matches, which
+// are otherwise treated as insertion points (see Matcher).
+func DropEmpty() MatcherOption {
+	return func(o *matcherOptions) { o.dropEmpty = true }
+}
+
+// normalise sorts the matches, and resolves the overlaps, as described in NewMatcher().
+func (o *matcherOptions) normalise(ms [][]int) [][]int {
+	if !sort.SliceIsSorted(ms, func(i, j int) bool { return matchLess(ms[i], ms[j]) }) {
+		ms = append([][]int(nil), ms...)
+		sort.SliceStable(ms, func(i, j int) bool { return matchLess(ms[i], ms[j]) })
+	}
+
+	res := ms[:0:0]
+	end := -1 // end of the preceding match
+
+	for i, m := range ms {
+		switch {
+		case o.dropEmpty && m[0] == m[1]:
+		case m[0] < end || (m[0] == end && m[0] == m[1]): // overlap
+			if o.merge && m[1] > end {
+				last := append([]int(nil), res[len(res)-1]...)
+				last[1], end = m[1], m[1]
+				res[len(res)-1] = last
+			}
+		case len(res) == i: // no changes so far
+			res, end = ms[:i+1], m[1]
+		default:
+			res, end = append(res, m), m[1]
+		}
+	}
+
+	if len(res) == 0 {
+		return nil
+	}
+
+	return res
+}
+
+// matchLess orders the matches by the start index, and then by the length, longest first.
+func matchLess(a, b []int) bool {
+	return a[0] < b[0] || (a[0] == b[0] && a[1] > b[1])
+}
+
+func formatMatch(m []int) string {
+	s := "["
+
+	for i, n := range m {
+		if i > 0 {
+			s += " "
+		}
+
+		s += strconv.Itoa(n)
+	}
+
+	return s + "]"
+}
@@ -0,0 +1,85 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewMatcher(t *testing.T) {
+	cases := []struct {
+		ms, exp [][]int
+		opts    []MatcherOption
+	}{
+		{nil, nil, nil},
+		{[][]int{{0, 1}, {2, 3}}, [][]int{{0, 1}, {2, 3}}, nil},
+		{[][]int{{2, 3}, {0, 1}}, [][]int{{0, 1}, {2, 3}}, nil},
+		{[][]int{{0, 2}, {1, 3}, {3, 4}}, [][]int{{0, 2}, {3, 4}}, nil},
+		{[][]int{{1, 2}, {1, 4}, {5, 5}}, [][]int{{1, 4}, {5, 5}}, nil},
+		{[][]int{{0, 2}, {2, 2}, {3, 3}}, [][]int{{0, 2}, {3, 3}}, nil},
+		{[][]int{{0, 2, 7}, {1, 3, 8}, {3, 4, 9}}, [][]int{{0, 3, 7}, {3, 4, 9}}, []MatcherOption{MergeOverlapping()}},
+		{[][]int{{0, 5}, {1, 3}}, [][]int{{0, 5}}, []MatcherOption{MergeOverlapping()}},
+		{[][]int{{0, 0}, {1, 2}, {3, 3}}, [][]int{{1, 2}}, []MatcherOption{DropEmpty()}},
+		{[][]int{{0, 0}}, nil, []MatcherOption{DropEmpty()}},
+	}
+
+	src := []byte("0123456789")
+
+	for i, c := range cases {
+		ms := c.ms
+		match := NewMatcher(func([]byte) [][]int { return ms }, c.opts...)
+
+		if res := match(src); !reflect.DeepEqual(res, c.exp) {
+			t.Errorf("[%d] Unexpected result: %v instead of %v", i, res, c.exp)
+			return
+		}
+	}
+
+	// rewriting
+	match := NewMatcher(func(s []byte) [][]int { return [][]int{{4, 5}, {0, 2}, {1, 3}} })
+
+	if res := Replace(match, "_").Do([]byte("abcdef")); string(res) != "_cd_f" {
+		t.Errorf("Unexpected result: %q instead of %q", string(res), "_cd_f")
+		return
+	}
+
+	// invalid matches
+	for i, m := range [][]int{{-1, 1}, {2, 1}, {0, 11}, {0}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("[%d] Missing panic", i)
+				}
+			}()
+
+			NewMatcher(func([]byte) [][]int { return [][]int{m} })(src)
+		}()
+	}
+}
@@ -0,0 +1,167 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import "strconv"
+
+// RoundNumbers creates a Rewriter that rounds all the floating-point numbers matched by the given
+// Matcher to the specified number of decimal places. Matches that cannot be parsed as numbers
+// are left intact. Negative numbers that round to zero are rendered without the minus sign.
+func RoundNumbers(match Matcher, decimals int) Rewriter {
+	if match == nil {
+		panic("nil matcher in trw.RoundNumbers() function")
+	}
+
+	if decimals < 0 {
+		panic("negative number of decimal places in trw.RoundNumbers() function")
+	}
+
+	return rewrite(match, func(dest, src []byte, m []int) []byte {
+		return appendFloat(dest, src[m[0]:m[1]], 'f', decimals)
+	})
+}
+
+// appendFloat parses the given text as a floating-point number, and appends it to the destination
+// slice in the specified format, or appends the text unchanged if it cannot be parsed.
+func appendFloat(dest, text []byte, format byte, prec int) []byte {
+	v, err := strconv.ParseFloat(string(text), 64)
+
+	if err != nil {
+		return append(dest, text...)
+	}
+
+	n := len(dest)
+	dest = strconv.AppendFloat(dest, v, format, prec, 64)
+
+	// avoid negative zero, like "-0.00"
+	if dest[n] == '-' && isZero(dest[n+1:]) {
+		dest = dest[:n+copy(dest[n:], dest[n+1:])]
+	}
+
+	return dest
+}
+
+// isZero checks if the given formatted number is zero.
+func isZero(s []byte) bool {
+	for _, c := range s {
+		switch {
+		case c == 'e' || c == 'E' || c == 'p':
+			return true
+		case c != '0' && c != '.':
+			return false
+		}
+	}
+
+	return true
+}
+
+// Floats creates a Matcher for unsigned floating-point literals, i.e., decimal numbers with
+// a fractional part, or an exponent, or both (like "1.5", "1e3", or "1.0E+03"). Integers,
+// as well as numbers that are parts of identifiers or version strings, are not matched.
+func Floats() Matcher {
+	return func(s []byte) (ms [][]int) {
+		for i := 0; i < len(s); {
+			if !isDigit(s[i]) && !(s[i] == '.' && i+1 < len(s) && isDigit(s[i+1])) {
+				i++
+				continue
+			}
+
+			// skip identifiers and dotted sequences like 1.2.3
+			if i > 0 && (isIdent(s[i-1]) || s[i-1] == '.') {
+				i = skipNumberLike(s, i)
+				continue
+			}
+
+			j, ok := scanFloat(s, i)
+
+			if ok && (j == len(s) || !(isIdent(s[j]) || s[j] == '.')) {
+				ms = append(ms, []int{i, j})
+				i = j
+			} else {
+				i = skipNumberLike(s, j)
+			}
+		}
+
+		return
+	}
+}
+
+// NormalizeFloats creates a Rewriter that reformats all floating-point literals (as matched by
+// Floats()) using the given format and precision, as in strconv.FormatFloat(). For example,
+// with format 'g' and precision -1, "1e3", "1000.0", and "1.0E+03" are all rendered as "1000".
+func NormalizeFloats(format byte, prec int) Rewriter {
+	switch format {
+	case 'e', 'E', 'f', 'g', 'G', 'x', 'X':
+		// ok
+	default:
+		panic("invalid format '" + string(format) + "' in trw.NormalizeFloats() function")
+	}
+
+	return rewrite(Floats(), func(dest, src []byte, m []int) []byte {
+		return appendFloat(dest, src[m[0]:m[1]], format, prec)
+	})
+}
+
+// scanFloat scans the floating-point literal starting at s[i], returning the index of the first
+// byte after it, and a flag indicating if the literal has a fractional part or an exponent.
+func scanFloat(s []byte, i int) (int, bool) {
+	start := i
+	i = skipDigits(s, i)
+	ok := false
+
+	if i < len(s) && s[i] == '.' {
+		if j := skipDigits(s, i+1); j > i+1 || i > start {
+			i, ok = j, true
+		}
+	}
+
+	if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+		j := i + 1
+
+		if j < len(s) && (s[j] == '+' || s[j] == '-') {
+			j++
+		}
+
+		if k := skipDigits(s, j); k > j {
+			i, ok = k, true
+		}
+	}
+
+	return i, ok
+}
+
+// skipNumberLike returns the index of the first byte after the run of identifier characters
+// and dots starting at s[i].
+func skipNumberLike(s []byte, i int) int {
+	for i < len(s) && (isIdent(s[i]) || s[i] == '.') {
+		i++
+	}
+
+	return i
+}
@@ -0,0 +1,79 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRoundNumbers(t *testing.T) {
+	cases := []struct {
+		src, exp string
+		decimals int
+	}{
+		{"no numbers", "no numbers", 2},
+		{"x=0.1234 y=2.5", "x=0.12 y=2.50", 2},
+		{"x=0.30000000000000004", "x=0.300", 3},
+		{"x=-0.001 y=-1.006", "x=0.00 y=-1.01", 2},
+		{"x=1e-3, y=12", "x=0.0, y=12.0", 1},
+		{"total: 99.5%", "total: 100%", 0},
+	}
+
+	for i, c := range cases {
+		if res := RoundNumbers(Patt(`-?\d+(\.\d+)?(e-?\d+)?`), c.decimals).Do([]byte(c.src)); !bytes.Equal(res, []byte(c.exp)) {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+	}
+}
+
+func TestNormalizeFloats(t *testing.T) {
+	cases := []struct {
+		src, exp string
+	}{
+		{"1e3 1000.0 1.0E+03 1000", "1000 1000 1000 1000"},
+		{"x=0.50, y=.5, z=5e-1", "x=0.5, y=0.5, z=0.5"},
+		{"v1.2.3 a1.5 1.5b 1.2.3", "v1.2.3 a1.5 1.5b 1.2.3"},
+		{"-1.50e+00 (2.)", "-1.5 (2)"},
+		{"1e400", "1e400"}, // out of range, left intact
+	}
+
+	for i, c := range cases {
+		if res := NormalizeFloats('g', -1).Do([]byte(c.src)); !bytes.Equal(res, []byte(c.exp)) {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+	}
+
+	if res := NormalizeFloats('e', 3).Do([]byte("x=1234.5")); string(res) != "x=1.234e+03" {
+		t.Errorf("Unexpected result: %q", string(res))
+		return
+	}
+}
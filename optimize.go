@@ -0,0 +1,186 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Stats accumulates the per-stage metrics of a pipeline, for use with Optimize(). The Record method
+// is a MetricsFunc, so the statistics can be collected with WithPipelineMetrics(stats.Record).
+// It is safe to use concurrently. The zero value is an empty Stats ready to use.
+type Stats struct {
+	mu     sync.Mutex
+	stages map[string]StageStats
+}
+
+// StageStats holds the accumulated metrics of a single pipeline stage.
+type StageStats struct {
+	Calls    int           // number of invocations
+	Matches  int           // total number of matches
+	Duration time.Duration // total time spent in the stage
+}
+
+// Record adds the metrics of a single invocation of the given stage.
+func (s *Stats) Record(stage string, matches int, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stages == nil {
+		s.stages = make(map[string]StageStats)
+	}
+
+	st := s.stages[stage]
+	st.Calls++
+	st.Matches += matches
+	st.Duration += d
+	s.stages[stage] = st
+}
+
+// Stage returns the accumulated metrics of the given stage.
+func (s *Stats) Stage(name string) StageStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.stages[name]
+}
+
+// Optimize returns a pipeline that produces the same result as the given one, with the provably dead
+// stages removed, and the commutative stages reordered by their average cost in the given statistics,
+// cheapest first. A literal stage is dead if its literal contains a byte that has been entirely
+// removed by a preceding single-byte literal stage, and not reintroduced by any substitution since.
+// Two literal stages commute if none of them can match or affect the text matched or produced by
+// the other; regular expression stages are never reordered. Stages with no statistics are placed after
+// those with, and the stats may be nil. Every unnamed stage is named after its position in the given
+// pipeline (as in WithPipelineMetrics()), so that the statistics of the returned pipeline refer
+// to the same names.
+func Optimize(p Pipeline, stats *Stats) Pipeline {
+	res := make(Pipeline, 0, len(p))
+
+	var gone [256]bool // bytes entirely removed from the text
+
+	for i := range p {
+		s := p[i]
+		s.Name = s.label(i)
+
+		if len(s.Patt) == 0 && containsAny(s.Lit, &gone) {
+			continue // dead stage
+		}
+
+		for j := 0; j < len(s.Subst); j++ {
+			gone[s.Subst[j]] = false
+		}
+
+		if len(s.Lit) == 1 && len(s.Patt) == 0 && s.Op != OpExpand && strings.IndexByte(s.Subst, s.Lit[0]) < 0 {
+			gone[s.Lit[0]] = true
+		}
+
+		res = append(res, s)
+	}
+
+	// average cost of a stage, or -1 if unknown
+	cost := func(s *Stage) time.Duration {
+		if stats != nil {
+			if st := stats.Stage(s.Name); st.Calls > 0 {
+				return st.Duration / time.Duration(st.Calls)
+			}
+		}
+
+		return -1
+	}
+
+	// blocks of mutually commutative stages
+	for i := 0; i < len(res); {
+		j := i + 1
+
+		for j < len(res) && commuteAll(res[i:j], &res[j]) {
+			j++
+		}
+
+		block := res[i:j]
+
+		sort.SliceStable(block, func(a, b int) bool {
+			ca, cb := cost(&block[a]), cost(&block[b])
+			return ca >= 0 && (cb < 0 || ca < cb)
+		})
+
+		i = j
+	}
+
+	return res
+}
+
+// containsAny checks if the given string contains any of the bytes from the set.
+func containsAny(s string, set *[256]bool) bool {
+	for i := 0; i < len(s); i++ {
+		if set[s[i]] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// commuteAll checks if the given stage commutes with every stage of the block.
+func commuteAll(block []Stage, s *Stage) bool {
+	for i := range block {
+		if !commute(&block[i], s) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// commute checks if the two stages can be applied in either order with the same result. This is
+// the case for literal deletions and replacements with no bytes in common, where a deletion
+// cannot join text into a match of the other literal.
+func commute(a, b *Stage) bool {
+	if len(a.Lit) == 0 || len(b.Lit) == 0 || len(a.Patt) > 0 || len(b.Patt) > 0 ||
+		a.Op == OpExpand || b.Op == OpExpand {
+		return false
+	}
+
+	var bytes [256]bool
+
+	for _, text := range [...]string{a.Lit, a.Subst} {
+		for i := 0; i < len(text); i++ {
+			bytes[text[i]] = true
+		}
+	}
+
+	if containsAny(b.Lit, &bytes) || containsAny(b.Subst, &bytes) {
+		return false
+	}
+
+	return (len(a.Subst) > 0 || len(b.Lit) == 1) && (len(b.Subst) > 0 || len(a.Lit) == 1)
+}
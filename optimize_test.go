@@ -0,0 +1,107 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOptimize(t *testing.T) {
+	p := Pipeline{
+		{Op: OpDelete, Lit: "x"},
+		{Op: OpReplace, Lit: "a", Subst: "A"},
+		{Op: OpDelete, Lit: "xy"}, // dead
+		{Op: OpReplace, Lit: "b", Subst: "B"},
+		{Op: OpReplace, Patt: `A+`, Subst: "x"},
+		{Op: OpDelete, Lit: "x"}, // alive, "x" reintroduced
+		{Op: OpDelete, Lit: "c"},
+		{Op: OpDelete, Lit: "dd"},
+	}
+
+	var stats Stats
+
+	stats.Record("#3", 1, 10*time.Millisecond)
+	stats.Record("#1", 1, 20*time.Millisecond)
+	stats.Record("#5", 1, 5*time.Millisecond)
+	stats.Record("#6", 1, 30*time.Millisecond)
+
+	q := Optimize(p, &stats)
+
+	var names []string
+
+	for _, s := range q {
+		names = append(names, s.Name)
+	}
+
+	if res, exp := strings.Join(names, " "), "#3 #1 #0 #4 #5 #6 #7"; res != exp {
+		t.Errorf("Unexpected stages: %q instead of %q", res, exp)
+		return
+	}
+
+	// same results
+	rw, orw := p.Rewriter(), q.Rewriter()
+	rnd := rand.New(rand.NewSource(1))
+
+	for n := 0; n < 1000; n++ {
+		src := make([]byte, rnd.Intn(20))
+
+		for i := range src {
+			src[i] = "abcdxyA"[rnd.Intn(7)]
+		}
+
+		if res, exp := string(orw.DoCopy(src)), string(rw.DoCopy(src)); res != exp {
+			t.Errorf("[%d] Unexpected result for %q: %q instead of %q", n, string(src), res, exp)
+			return
+		}
+	}
+}
+
+func TestCommute(t *testing.T) {
+	cases := []struct {
+		a, b Stage
+		exp  bool
+	}{
+		{Stage{Op: OpDelete, Lit: "a"}, Stage{Op: OpDelete, Lit: "b"}, true},
+		{Stage{Op: OpDelete, Lit: "a"}, Stage{Op: OpDelete, Lit: "bc"}, false},
+		{Stage{Op: OpReplace, Lit: "a", Subst: "x"}, Stage{Op: OpDelete, Lit: "bc"}, true},
+		{Stage{Op: OpReplace, Lit: "a", Subst: "b"}, Stage{Op: OpDelete, Lit: "b"}, false},
+		{Stage{Op: OpReplace, Lit: "ab", Subst: "x"}, Stage{Op: OpReplace, Lit: "bc", Subst: "y"}, false},
+		{Stage{Op: OpDelete, Patt: "a"}, Stage{Op: OpDelete, Lit: "b"}, false},
+	}
+
+	for i, c := range cases {
+		if res := commute(&c.a, &c.b); res != c.exp {
+			t.Errorf("[%d] Unexpected result: %v", i, res)
+			return
+		}
+	}
+}
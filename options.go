@@ -0,0 +1,290 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Option is a type of a function that configures a single run of a Rewriter,
+// as performed by Rewriter.DoWith(), or the compilation of a Pipeline.
+type Option func(*options)
+
+type options struct {
+	final    *int        // final buffer capacity report, or nil
+	limit    int         // soft memory limit, or 0
+	lineSafe bool        // the Rewriter never matches across lines
+	capacity int         // initial capacity of the buffers
+	growth   float64     // initial capacity of the buffers relative to the input size
+	backup   bool        // keep .bak copies of the rewritten files
+	journal  string      // journal directory, or ""
+	gzip     bool        // gzip-aware streaming
+	pool     *sync.Pool  // buffer pool, or nil
+	verify   []Matcher   // detectors to re-run on the result
+	metrics  MetricsFunc // pipeline stage metrics hook, or nil
+}
+
+func makeOptions(opts []Option) (o options) {
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return
+}
+
+// WithFinalCapacity creates an Option that stores to the given location the total capacity (in bytes)
+// of the two buffers that the stages of the pipeline alternate between, as they are after the run,
+// including the source slice if it has been reused. This is the memory retained by the buffers,
+// for example, for sizing a buffer pool; it is not the peak memory use during the run.
+func WithFinalCapacity(p *int) Option {
+	if p == nil {
+		panic("nil pointer in trw.WithFinalCapacity() function")
+	}
+
+	return func(o *options) { o.final = p }
+}
+
+// WithMemoryLimit creates an Option that sets a soft limit (in bytes) on the size of the input
+// that RewriteStream() processes in memory as a whole. If the input turns out to be larger than
+// the limit and the Rewriter is declared line-safe via WithLineSafe(), the input is processed
+// in streaming mode, line by line; otherwise the limit is ignored.
+func WithMemoryLimit(n int) Option {
+	if n <= 0 {
+		panic("invalid memory limit in trw.WithMemoryLimit() function")
+	}
+
+	return func(o *options) { o.limit = n }
+}
+
+// WithLineSafe creates an Option that declares that the Rewriter never matches across line
+// boundaries, so the input may be safely processed line by line.
+func WithLineSafe() Option {
+	return func(o *options) { o.lineSafe = true }
+}
+
+// WithInitialCapacity creates an Option that sets the minimum initial capacity (in bytes) of the two
+// buffers that the stages of the pipeline alternate between. Without the option the buffers
+// are allocated on demand by the stages, each time with 20% spare capacity, which may cause
+// repeated reallocations in pipelines that expand the text significantly. The option only applies
+// to the runs made through DoWith(), where it sizes the buffers handed to the Rewriter; plain Do()
+// and Seq() ignore it, as does Pipeline.Rewriter(). Also, once the capacity is exceeded, Replace
+// and Expand stages still grow their buffers with the usual 20% spare capacity.
+func WithInitialCapacity(n int) Option {
+	if n < 0 {
+		panic("invalid capacity in trw.WithInitialCapacity() function")
+	}
+
+	return func(o *options) { o.capacity = n }
+}
+
+// WithGrowthFactor creates an Option that sets the initial capacity of the two buffers the stages
+// of the pipeline alternate between, relative to the size of the input. For example, for a pipeline
+// that roughly triples the size of the text, a factor of 3 avoids all the reallocations.
+// If WithInitialCapacity() is also given, the larger of the two capacities is used. As with
+// WithInitialCapacity(), the option only applies to the runs made through DoWith(); plain Do()
+// and Seq() ignore it, and Replace and Expand stages still reallocate with 20% spare capacity.
+func WithGrowthFactor(f float64) Option {
+	if !(f >= 1) {
+		panic("invalid growth factor in trw.WithGrowthFactor() function")
+	}
+
+	return func(o *options) { o.growth = f }
+}
+
+// WithBackup creates an Option that makes RewriteFile() keep a copy of the original file
+// under the same name with ".bak" suffix appended. An existing backup file is overwritten.
+func WithBackup() Option {
+	return func(o *options) { o.backup = true }
+}
+
+// WithJournal creates an Option that makes RewriteFile() record the original content of every
+// file it changes to the journal in the given directory, which must exist. All the changes
+// recorded to the journal can be reverted by Rollback(). The same journal may be used with
+// any number of files, including concurrent invocations of RewriteFile().
+func WithJournal(dir string) Option {
+	if len(dir) == 0 {
+		panic("empty journal directory in trw.WithJournal() function")
+	}
+
+	return func(o *options) { o.journal = dir }
+}
+
+// WithGzip creates an Option that makes RewriteStream() detect gzip-compressed input, and
+// rewrite its decompressed content, compressing the result with the original gzip header
+// fields (name, comment, and modification time). Uncompressed input is rewritten as is.
+func WithGzip() Option {
+	return func(o *options) { o.gzip = true }
+}
+
+// WithPool creates an Option that makes DoWith() take the destination buffer from the given pool,
+// and put the spare buffer back to the pool after the run, to reduce the allocation rate
+// in long-running programs. The pool must hold values of type *[]byte; other values are ignored.
+// The result of the run is owned by the caller; the caller's source slice is never put to the pool.
+func WithPool(p *sync.Pool) Option {
+	if p == nil {
+		panic("nil pool in trw.WithPool() function")
+	}
+
+	return func(o *options) { o.pool = p }
+}
+
+// Verify creates an Option that re-scans the result of the run with the given detectors, typically
+// the same Matchers the pipeline uses to find the sensitive data it removes. Any match found
+// in the result is reported as a *ResidualError from DoChecked(), RewriteStream(), and RewriteFile().
+// The latter two do not write out the result that has failed the verification.
+func Verify(detectors []Matcher) Option {
+	if len(detectors) == 0 {
+		panic("empty detector list in trw.Verify() function")
+	}
+
+	for _, m := range detectors {
+		if m == nil {
+			panic("nil detector in trw.Verify() function")
+		}
+	}
+
+	ds := append([]Matcher(nil), detectors...)
+
+	return func(o *options) { o.verify = ds }
+}
+
+// ResidualError is the error reported when a detector given to Verify() finds matches
+// in the result of the run.
+type ResidualError struct {
+	Detector int     // index of the detector in the list given to Verify()
+	Matches  [][]int // matches found by the detector
+}
+
+func (e *ResidualError) Error() string {
+	return "trw: " + strconv.Itoa(len(e.Matches)) + " residual match(es) of detector #" +
+		strconv.Itoa(e.Detector) + " after rewrite"
+}
+
+// check re-scans the given result with the detectors from Verify() option, if any.
+func (o *options) check(res []byte) error {
+	for i, m := range o.verify {
+		if ms := m(res); len(ms) > 0 {
+			return &ResidualError{Detector: i, Matches: ms}
+		}
+	}
+
+	return nil
+}
+
+// DoChecked applies the Rewriter to the specified byte slice with the given options, as DoWith()
+// does, and then verifies the result as specified by Verify() option. The result is returned
+// even if the verification fails, so that the residual matches can be inspected.
+func (rw Rewriter) DoChecked(src []byte, opts ...Option) ([]byte, error) {
+	o := makeOptions(opts)
+	res := rw.DoWith(src, opts...)
+
+	return res, o.check(res)
+}
+
+// MetricsFunc is a type of a function that receives the metrics of a pipeline stage invocation:
+// the stage name, the number of matches, and the time spent in the stage.
+type MetricsFunc = func(stage string, matches int, d time.Duration)
+
+// WithPipelineMetrics creates an Option that makes Pipeline.Rewriter() instrument every stage of
+// the pipeline, so that the given function is invoked after each stage invocation with the metrics
+// of it, for example, to export them to a monitoring system. Stages without a name are reported
+// as "#i", where i is the stage index. The matches are counted as the stage consumes them, so
+// the instrumentation does not change the way the matches are found. The function may be called
+// concurrently if the Rewriter is. The option only applies to the stages of a Pipeline: a Seq()
+// of arbitrary Rewriters cannot be instrumented, and DoWith() ignores the option.
+func WithPipelineMetrics(fn MetricsFunc) Option {
+	if fn == nil {
+		panic("nil metrics function in trw.WithPipelineMetrics() function")
+	}
+
+	return func(o *options) { o.metrics = fn }
+}
+
+// DoWith applies the Rewriter to the specified byte slice, as Do() does, with the given options.
+// Verify() option is ignored; see DoChecked().
+func (rw Rewriter) DoWith(src []byte, opts ...Option) (result []byte) {
+	o := makeOptions(opts)
+	orig := src
+
+	var dest []byte
+	var bp *[]byte
+
+	if o.pool != nil {
+		if bp, _ = o.pool.Get().(*[]byte); bp != nil {
+			dest = (*bp)[:0]
+		}
+	}
+
+	if n := o.bufferSize(len(src)); n > 0 {
+		// preallocate both buffers
+		if n > cap(src) {
+			src = append(make([]byte, 0, n), src...)
+		}
+
+		if n > cap(dest) {
+			dest = make([]byte, 0, n)
+		}
+	}
+
+	result, spare := rw(dest, src)
+
+	if o.final != nil {
+		*o.final = cap(result) + cap(spare)
+	}
+
+	if o.pool != nil && cap(spare) > 0 && !sameStart(spare, orig) {
+		if bp == nil {
+			bp = new([]byte)
+		}
+
+		*bp = spare[:0]
+		o.pool.Put(bp)
+	}
+
+	return
+}
+
+// bufferSize returns the initial capacity of the buffers for the input of the given size,
+// or 0 if the buffers are to be allocated on demand.
+func (o *options) bufferSize(n int) int {
+	if o.growth > 0 {
+		if k := int(o.growth * float64(n)); k > o.capacity {
+			return k
+		}
+	}
+
+	return o.capacity
+}
+
+// sameStart checks if the two slices start at the same address.
+func sameStart(a, b []byte) bool {
+	return cap(a) > 0 && cap(b) > 0 && &a[:1][0] == &b[:1][0]
+}
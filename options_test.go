@@ -0,0 +1,200 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestFinalCapacity(t *testing.T) {
+	cases := []struct {
+		rw       Rewriter
+		src, exp string
+		grows    bool
+	}{
+		{Delete(Lit("a")), "abcabc", "bcbc", false},
+		{Replace(Lit("a"), "XXXX"), "abcabc", "XXXXbcXXXXbc", true},
+		{Seq(Replace(Lit("a"), "XXXX"), Delete(Lit("XX"))), "abcabc", "bcbc", true},
+	}
+
+	for i, c := range cases {
+		var final int
+
+		src := []byte(c.src)
+		res := c.rw.DoWith(src, WithFinalCapacity(&final))
+
+		if string(res) != c.exp {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+
+		if c.grows {
+			if final <= cap(src)+len(c.src) || final < cap(src)+cap(res) {
+				t.Errorf("[%d] Unexpected final capacity: %d", i, final)
+				return
+			}
+		} else if final != cap(src) {
+			t.Errorf("[%d] Unexpected final capacity: %d instead of %d", i, final, cap(src))
+			return
+		}
+	}
+}
+
+func TestBufferCapacity(t *testing.T) {
+	const src = "abcabcabca"
+
+	rw := Seq(Replace(Lit("a"), "aaa"), Replace(Lit("b"), "bbb"), Replace(Lit("c"), "ccc"))
+	exp := "aaabbbcccaaabbbcccaaabbbcccaaa"
+
+	cases := []struct {
+		opts []Option
+		cap  int
+	}{
+		{[]Option{WithGrowthFactor(3)}, 30},
+		{[]Option{WithInitialCapacity(40)}, 40},
+		{[]Option{WithInitialCapacity(20), WithGrowthFactor(3.5)}, 35},
+		{[]Option{WithInitialCapacity(40), WithGrowthFactor(3.5)}, 40},
+	}
+
+	for i, c := range cases {
+		var final int
+
+		res := rw.DoWith([]byte(src), append(c.opts, WithFinalCapacity(&final))...)
+
+		if string(res) != exp {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), exp)
+			return
+		}
+
+		if cap(res) != c.cap || final != 2*c.cap {
+			t.Errorf("[%d] Unexpected capacity: %d, final %d", i, cap(res), final)
+			return
+		}
+	}
+}
+
+func TestPool(t *testing.T) {
+	var created int
+
+	pool := &sync.Pool{
+		New: func() interface{} {
+			created++
+			b := make([]byte, 0, 64)
+			return &b
+		},
+	}
+
+	rw := Seq(Replace(Lit("a"), "aa"), Replace(Lit("b"), "bb"))
+
+	var srcs, results [][]byte
+
+	for i := 0; i < 10; i++ {
+		src := []byte("ab-ab")
+		res := rw.DoWith(src, WithPool(pool))
+
+		if string(res) != "aabb-aabb" {
+			t.Errorf("[%d] Unexpected result: %q", i, string(res))
+			return
+		}
+
+		srcs, results = append(srcs, src), append(results, res)
+	}
+
+	// results and sources must not be reused
+	for i := range results {
+		if string(results[i]) != "aabb-aabb" || string(srcs[i]) != "ab-ab" {
+			t.Errorf("[%d] Buffer reused: %q, %q", i, string(results[i]), string(srcs[i]))
+			return
+		}
+	}
+
+	if created == 10 {
+		t.Error("Pool is never reused")
+		return
+	}
+}
+
+func TestVerify(t *testing.T) {
+	detectors := []Matcher{Lit("secret"), Patt(`\d{4}`)}
+
+	cases := []struct {
+		rw       Rewriter
+		src, exp string
+		detector int // -1 for no error
+	}{
+		{Seq(Delete(Lit("secret")), Delete(Patt(`\d{4}`))), "a secret 1234", "a  ", -1},
+		{Delete(Lit("secret")), "a secret 1234", "a  1234", 1},
+		{Delete(Lit("secret")), "a secsecretret", "a secret", 0},
+	}
+
+	for i, c := range cases {
+		res, err := c.rw.DoChecked([]byte(c.src), Verify(detectors))
+
+		if string(res) != c.exp {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+
+		if c.detector < 0 {
+			if err != nil {
+				t.Errorf("[%d] Unexpected error: %s", i, err)
+				return
+			}
+
+			continue
+		}
+
+		e, ok := err.(*ResidualError)
+
+		if !ok {
+			t.Errorf("[%d] Unexpected error: %v", i, err)
+			return
+		}
+
+		if e.Detector != c.detector || len(e.Matches) != 1 {
+			t.Errorf("[%d] Unexpected residual matches: %d of detector #%d", i, len(e.Matches), e.Detector)
+			return
+		}
+
+		// streaming, in memory and line by line
+		for _, opts := range [][]Option{nil, {WithMemoryLimit(1), WithLineSafe()}} {
+			var buf bytes.Buffer
+
+			err = RewriteStream(&buf, strings.NewReader(c.src), c.rw, append(opts, Verify(detectors))...)
+
+			if _, ok = err.(*ResidualError); !ok || buf.Len() > 0 {
+				t.Errorf("[%d] Unexpected stream result: %q, error %v", i, buf.String(), err)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,596 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"regexp/syntax"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Pipeline is a declarative description of a sequence of rewriting stages. Unlike a Rewriter,
+// which is an opaque function, a Pipeline can be inspected and converted to other forms.
+// It marshals to a JSON array of stages, like [{"op":"replace","lit":"a","subst":"b"}],
+// and it is compiled either to a Rewriter with Rewriter() method, or to a Program that keeps
+// the Pipeline along with the compiled Rewriter, so it can be shipped elsewhere as JSON.
+type Pipeline []Stage
+
+// Stage is a single rewriting operation in a Pipeline. A stage matches either the literal Lit,
+// or the regular expression Patt (exactly one of the two must be set), and applies the operation
+// to every match. The optional Name does not affect the rewriting.
+type Stage struct {
+	Name  string `json:"name,omitempty"`  // stage name, for metrics
+	Op    Op     `json:"op"`              // operation to apply
+	Lit   string `json:"lit,omitempty"`   // literal to match
+	Patt  string `json:"patt,omitempty"`  // regular expression to match
+	Subst string `json:"subst,omitempty"` // replacement, or template for OpExpand
+}
+
+// Op specifies the operation of a pipeline stage.
+type Op int
+
+// Pipeline stage operations.
+const (
+	OpDelete  Op = iota // delete the matches
+	OpReplace           // replace the matches with Subst, taken literally
+	OpExpand            // replace the matches with Subst template, as in Regexp.Expand(); Patt only
+)
+
+var opNames = [...]string{
+	OpDelete:  "delete",
+	OpReplace: "replace",
+	OpExpand:  "expand",
+}
+
+// String returns the name of the operation, like "delete".
+func (op Op) String() string {
+	if op >= 0 && int(op) < len(opNames) {
+		return opNames[op]
+	}
+
+	return "Op(" + strconv.Itoa(int(op)) + ")"
+}
+
+// MarshalText implements encoding.TextMarshaler interface.
+func (op Op) MarshalText() ([]byte, error) {
+	return []byte(op.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler interface.
+func (op *Op) UnmarshalText(text []byte) error {
+	for i, name := range opNames {
+		if string(text) == name {
+			*op = Op(i)
+			return nil
+		}
+	}
+
+	return errors.New("invalid pipeline operation " + strconv.Quote(string(text)))
+}
+
+// Rewriter compiles the pipeline to a Rewriter applying all the stages in sequence.
+// The method panics if any of the stages is invalid. The only option applicable here
+// is WithPipelineMetrics().
+func (p Pipeline) Rewriter(opts ...Option) Rewriter {
+	return p.compile(opts, "Rewriter")
+}
+
+// Compile compiles the pipeline to a Program. As with Rewriter() method, it panics if any of
+// the stages is invalid, and the only option applicable here is WithPipelineMetrics().
+func (p Pipeline) Compile(opts ...Option) Program {
+	return Program{
+		Rewriter: p.compile(opts, "Compile"),
+		pipeline: append(Pipeline(nil), p...),
+	}
+}
+
+func (p Pipeline) compile(opts []Option, method string) Rewriter {
+	if len(p) == 0 {
+		panic("empty pipeline in trw.Pipeline." + method + "() method")
+	}
+
+	o := makeOptions(opts)
+	rws := make([]Rewriter, len(p))
+
+	for i := range p {
+		st, err := p[i].parse()
+
+		if err != nil {
+			panic("stage #" + strconv.Itoa(i) + ": " + err.Error() + " in trw.Pipeline." + method + "() method")
+		}
+
+		if o.metrics != nil {
+			rws[i] = st.instrument(p[i].label(i), o.metrics)
+		} else {
+			rws[i] = st.rewriter()
+		}
+	}
+
+	return Seq(rws...)
+}
+
+// Program is a Rewriter compiled from a Pipeline, along with the Pipeline itself. A Program can be
+// used wherever a Rewriter can, via the embedded field, and it can also be marshalled to JSON, and
+// reconstructed from it. The zero value is an empty Program with a nil Rewriter.
+type Program struct {
+	Rewriter // the compiled pipeline
+
+	pipeline Pipeline
+}
+
+// Pipeline returns a copy of the pipeline the program has been compiled from.
+func (prog Program) Pipeline() Pipeline {
+	return append(Pipeline(nil), prog.pipeline...)
+}
+
+// MarshalJSON implements json.Marshaler interface. The result is the JSON form of the program's
+// Pipeline; an empty Program marshals to JSON null.
+func (prog Program) MarshalJSON() ([]byte, error) {
+	if prog.Rewriter == nil {
+		return []byte("null"), nil
+	}
+
+	return json.Marshal(prog.pipeline)
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface. The data must be a non-empty JSON array
+// of stages, as produced by MarshalJSON(); the stages are validated as in Pipeline.UnmarshalJSON(),
+// and compiled to the program's Rewriter. JSON null is a no-op.
+func (prog *Program) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+
+	var p Pipeline
+
+	if err := p.UnmarshalJSON(data); err != nil {
+		return err
+	}
+
+	if len(p) == 0 {
+		return errors.New("trw: empty pipeline")
+	}
+
+	*prog = p.Compile()
+	return nil
+}
+
+// stage is a compiled pipeline stage.
+type stage struct {
+	matches func(src []byte) *matches                            // creates an iterator over the matches
+	apply   func(dest, src []byte, it *matches) ([]byte, []byte) // rewrites the matches from the iterator
+}
+
+// rewriter creates a Rewriter for the stage.
+func (st *stage) rewriter() Rewriter {
+	return func(dest, src []byte) ([]byte, []byte) {
+		return st.apply(dest, src, st.matches(src))
+	}
+}
+
+// instrument creates a Rewriter for the stage that reports its metrics after every invocation.
+// The matches are counted as they are consumed, so the stage finds them in the same way
+// as the uninstrumented one.
+func (st *stage) instrument(name string, fn MetricsFunc) Rewriter {
+	return func(dest, src []byte) ([]byte, []byte) {
+		start := time.Now()
+		it := st.matches(src)
+
+		dest, src = st.apply(dest, src, it)
+
+		fn(name, it.count, time.Since(start))
+		return dest, src
+	}
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface. Unlike the default decoding, unknown
+// stage fields are rejected, and every stage is validated, so that Rewriter() method never
+// panics on the unmarshalled pipeline (unless it is empty).
+func (p *Pipeline) UnmarshalJSON(data []byte) error {
+	var stages []Stage
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(&stages); err != nil {
+		return err
+	}
+
+	for i := range stages {
+		if _, err := stages[i].parse(); err != nil {
+			return errors.New("stage #" + strconv.Itoa(i) + ": " + err.Error())
+		}
+	}
+
+	*p = stages
+	return nil
+}
+
+// parse validates the stage, and compiles it. The matches of the literals, and of the patterns without
+// anchors or word boundaries, are found one at a time, as with DeleteLazy() and ReplaceLazy().
+func (s *Stage) parse() (*stage, error) {
+	if (len(s.Lit) == 0) == (len(s.Patt) == 0) {
+		return nil, errors.New("exactly one of the literal and the pattern must be set")
+	}
+
+	var re *regexp.Regexp
+
+	if len(s.Patt) > 0 {
+		var err error
+
+		if re, err = regexp.Compile(s.Patt); err != nil {
+			return nil, err
+		}
+	}
+
+	st := &stage{matches: lazyMatches(s.Lit, re)}
+
+	if st.matches == nil {
+		st.matches = func(src []byte) *matches { return &matches{ms: re.FindAllIndex(src, -1)} }
+	}
+
+	subst := s.Subst
+
+	switch s.Op {
+	case OpDelete:
+		if len(subst) > 0 {
+			return nil, errors.New("substitution in a delete stage")
+		}
+
+		st.apply = deleteStage
+
+	case OpReplace:
+		if len(subst) == 0 {
+			st.apply = deleteStage
+			break
+		}
+
+		st.apply = func(dest, src []byte, it *matches) ([]byte, []byte) {
+			return replaceAll(dest, src, subst, it, it.resultSize(len(src), subst))
+		}
+
+	case OpExpand:
+		if re == nil {
+			return nil, errors.New("literal in an expand stage")
+		}
+
+		templ := []byte(subst)
+
+		st.matches = func(src []byte) *matches { return &matches{ms: re.FindAllSubmatchIndex(src, -1)} }
+		st.apply = func(dest, src []byte, it *matches) ([]byte, []byte) {
+			return rewriteAll(dest, src, it, func(dest, src []byte, m []int) []byte {
+				return re.Expand(dest, templ, src, m)
+			})
+		}
+
+	default:
+		return nil, errors.New("invalid operation " + s.Op.String())
+	}
+
+	return st, nil
+}
+
+// deleteStage removes all the matches from the iterator.
+func deleteStage(unused, src []byte, it *matches) ([]byte, []byte) {
+	return deleteAll(src, it), unused
+}
+
+// label returns the name of the i-th stage, or "#i" if the stage has no name.
+func (s *Stage) label(i int) string {
+	if len(s.Name) > 0 {
+		return s.Name
+	}
+
+	return "#" + strconv.Itoa(i)
+}
+
+// AsReplacer converts the given pipeline to a strings.Replacer with the same semantics, if possible.
+// This is only the case for pipelines of literal deletions and replacements where no stage can match
+// text produced or affected by the preceding stages. Specifically, no literal may have bytes in common
+// with the literals and substitutions of the preceding stages, and literals longer than one byte
+// may not follow a deletion.
+func AsReplacer(p Pipeline) (*strings.Replacer, bool) {
+	if len(p) == 0 {
+		return nil, false
+	}
+
+	var seen [256]bool // bytes of the preceding literals and substitutions
+
+	deleted := false
+	oldnew := make([]string, 0, 2*len(p))
+
+	for i := range p {
+		s := &p[i]
+
+		if len(s.Lit) == 0 || len(s.Patt) > 0 || (s.Op != OpDelete && s.Op != OpReplace) {
+			return nil, false
+		}
+
+		if s.Op == OpDelete && len(s.Subst) > 0 {
+			return nil, false
+		}
+
+		if deleted && len(s.Lit) > 1 {
+			return nil, false
+		}
+
+		for j := 0; j < len(s.Lit); j++ {
+			if seen[s.Lit[j]] {
+				return nil, false
+			}
+		}
+
+		for _, text := range [...]string{s.Lit, s.Subst} {
+			for j := 0; j < len(text); j++ {
+				seen[text[j]] = true
+			}
+		}
+
+		deleted = deleted || len(s.Subst) == 0
+		oldnew = append(oldnew, s.Lit, s.Subst)
+	}
+
+	return strings.NewReplacer(oldnew...), true
+}
+
+// Explain returns a human-readable description of the given pipeline, one stage per line, followed
+// by the diagnostics for the common hazards, each on a separate indented line: regular expressions
+// matching the empty string, stages that may match text produced by the preceding replacements,
+// and literal stages that can only match text formed by the preceding deletions. A stage is
+// considered to match text produced by a replacement if its match may include a part of
+// the substitution, either lying entirely within it, or crossing its boundary with the surrounding
+// text; "expand" templates are checked as written. The analysis is based on the pipeline alone,
+// so the diagnostics are warnings about what may happen, not a proof that it does. Invalid stages
+// are reported as such, and skipped.
+func Explain(p Pipeline) string {
+	var b strings.Builder
+
+	progs := make([]*syntax.Prog, len(p)) // compiled patterns
+	valid := make([]bool, len(p))
+
+	for i := range p {
+		s := &p[i]
+
+		b.WriteString("stage #" + strconv.Itoa(i) + ": " + s.describe() + "\n")
+
+		if _, err := s.parse(); err != nil {
+			b.WriteString("\terror: " + err.Error() + "\n")
+			continue
+		}
+
+		valid[i] = true
+
+		if len(s.Patt) > 0 {
+			if regexp.MustCompile(s.Patt).MatchString("") {
+				if s.Op == OpDelete {
+					b.WriteString("\twarning: pattern matches the empty string, such matches are ignored\n")
+				} else {
+					b.WriteString("\twarning: pattern matches the empty string, the substitution is inserted at every such match\n")
+				}
+			}
+
+			progs[i] = compileProg(s.Patt)
+		}
+
+		for j := 0; j < i; j++ {
+			prev := &p[j]
+
+			if !valid[j] {
+				continue
+			}
+
+			if len(prev.Subst) > 0 && (progs[i] != nil && mayMatchAcross(progs[i], prev.Subst) ||
+				len(s.Lit) > 0 && overlaps(s.Lit, prev.Subst)) {
+				b.WriteString("\twarning: may match text produced by stage #" + strconv.Itoa(j) + "\n")
+			}
+
+			if len(s.Lit) > 0 && len(prev.Lit) > 0 && prev.Op == OpDelete &&
+				strings.Contains(s.Lit, prev.Lit) {
+				b.WriteString("\twarning: literal contains " + strconv.Quote(prev.Lit) +
+					" deleted by stage #" + strconv.Itoa(j) + ", so it only matches text formed by the deletion\n")
+			}
+		}
+	}
+
+	return b.String()
+}
+
+// overlaps checks if the literal may match text including a part of the given substitution,
+// that is, if the two strings can be aligned so that they overlap, and agree on the overlap.
+func overlaps(lit, subst string) bool {
+	// lit is placed at the offset d from the start of subst
+	for d := 1 - len(lit); d < len(subst); d++ {
+		a, b := d, d+len(lit)
+
+		if a < 0 {
+			a = 0
+		}
+
+		if b > len(subst) {
+			b = len(subst)
+		}
+
+		if subst[a:b] == lit[a-d:b-d] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// compileProg compiles the given (valid) regular expression to a program for mayMatchAcross().
+func compileProg(patt string) *syntax.Prog {
+	re, err := syntax.Parse(patt, syntax.Perl)
+
+	if err != nil {
+		panic(err)
+	}
+
+	prog, err := syntax.Compile(re.Simplify())
+
+	if err != nil {
+		panic(err)
+	}
+
+	return prog
+}
+
+// mayMatchAcross checks if a match of the given program may include a part of the given substitution:
+// a match may either start before the substitution in any state of the program, or start at any
+// position within it, and then it must end within the substitution, or be able to continue after it.
+// Empty-width assertions are assumed to hold, so the result is an over-approximation.
+func mayMatchAcross(prog *syntax.Prog, subst string) bool {
+	n := len(prog.Inst)
+	cur, next := make([]bool, n), make([]bool, n)
+
+	// a match started before the substitution
+	for i := range cur {
+		cur[i] = true
+	}
+
+	alive := false // some match may continue after the substitution
+
+	for _, r := range subst {
+		for i := range next {
+			next[i] = false
+		}
+
+		for i, ok := range cur {
+			if ok && matchRune(&prog.Inst[i], r) {
+				addState(prog, next, prog.Inst[i].Out)
+			}
+		}
+
+		alive = false
+
+		for i, ok := range next {
+			if !ok {
+				continue
+			}
+
+			if prog.Inst[i].Op == syntax.InstMatch {
+				return true // ends within the substitution
+			}
+
+			alive = alive || matchRune(&prog.Inst[i], -1)
+		}
+
+		// a match starting at the next position
+		cur, next = next, cur
+		addState(prog, cur, uint32(prog.Start))
+	}
+
+	return alive
+}
+
+// addState adds to the set the given state, and all the states reachable from it without
+// consuming any input.
+func addState(prog *syntax.Prog, set []bool, pc uint32) {
+	if set[pc] {
+		return
+	}
+
+	set[pc] = true
+
+	switch inst := &prog.Inst[pc]; inst.Op {
+	case syntax.InstAlt, syntax.InstAltMatch:
+		addState(prog, set, inst.Out)
+		addState(prog, set, inst.Arg)
+	case syntax.InstCapture, syntax.InstEmptyWidth, syntax.InstNop:
+		addState(prog, set, inst.Out)
+	}
+}
+
+// matchRune checks if the given instruction consumes the rune; for a negative rune it checks
+// if the instruction consumes any input at all.
+func matchRune(inst *syntax.Inst, r rune) bool {
+	switch inst.Op {
+	case syntax.InstRune, syntax.InstRune1:
+		return r < 0 || inst.MatchRune(r)
+	case syntax.InstRuneAny:
+		return true
+	case syntax.InstRuneAnyNotNL:
+		return r != '\n'
+	default:
+		return false
+	}
+}
+
+// describe returns a short description of the stage, like `replace "a" with "b"`.
+func (s *Stage) describe() string {
+	var d string
+
+	if len(s.Patt) > 0 {
+		d = s.Op.String() + " /" + s.Patt + "/"
+	} else {
+		d = s.Op.String() + " " + strconv.Quote(s.Lit)
+	}
+
+	if s.Op != OpDelete {
+		d += " with " + strconv.Quote(s.Subst)
+	}
+
+	return d
+}
+
+// Fingerprint returns a stable hash of the given pipeline, as a hex string. Pipelines with the same
+// stages always have the same fingerprint, across program runs and versions of this package, and any
+// change to a stage (operation, literal, pattern, or substitution) or to the order of the stages
+// changes the fingerprint, so it can be used as the pipeline version in cache keys. Stage names
+// are not included. Note that the patterns are hashed as written, so equivalent but differently
+// written regular expressions have different fingerprints.
+func Fingerprint(p Pipeline) string {
+	h := sha256.New()
+	buf := append(make([]byte, 0, 64), "trw.Pipeline/1"...)
+
+	for i := range p {
+		s := &p[i]
+
+		buf = strconv.AppendInt(append(buf, ';'), int64(s.Op), 10)
+
+		// length-prefixed fields
+		for _, f := range [...]string{s.Lit, s.Patt, s.Subst} {
+			buf = append(strconv.AppendInt(append(buf, ','), int64(len(f)), 10), ':')
+			h.Write(buf)
+			h.Write([]byte(f))
+			buf = buf[:0]
+		}
+	}
+
+	h.Write(buf)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
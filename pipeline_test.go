@@ -0,0 +1,412 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPipeline(t *testing.T) {
+	p := Pipeline{
+		{Op: OpDelete, Lit: "--"},
+		{Op: OpReplace, Patt: `\d+`, Subst: "$0"},
+		{Op: OpExpand, Patt: `(\w+)@(\w+)`, Subst: "${2}/${1}"},
+		{Op: OpReplace, Lit: "/", Subst: " at "},
+	}
+
+	const src, exp = "x--y 123 me@host", "xy $0 host at me"
+
+	if res := p.Rewriter().Do([]byte(src)); string(res) != exp {
+		t.Errorf("Unexpected result: %q instead of %q", string(res), exp)
+		return
+	}
+
+	invalid := []Pipeline{
+		nil,
+		{{Op: OpDelete}},
+		{{Op: OpDelete, Lit: "a", Patt: "b"}},
+		{{Op: OpDelete, Lit: "a", Subst: "b"}},
+		{{Op: OpExpand, Lit: "a", Subst: "b"}},
+		{{Op: OpReplace, Patt: "(", Subst: "b"}},
+		{{Op: Op(10), Lit: "a"}},
+	}
+
+	for i, p := range invalid {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("[%d] Missing panic", i)
+				}
+			}()
+
+			p.Rewriter()
+		}()
+	}
+}
+
+func TestPipelineJSON(t *testing.T) {
+	p := Pipeline{
+		{Op: OpDelete, Lit: "--"},
+		{Op: OpExpand, Patt: `(\w+)@(\w+)`, Subst: "${2}/${1}"},
+	}
+
+	data, err := json.Marshal(p)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	const exp = `[{"op":"delete","lit":"--"},{"op":"expand","patt":"(\\w+)@(\\w+)","subst":"${2}/${1}"}]`
+
+	if string(data) != exp {
+		t.Errorf("Unexpected JSON: %s instead of %s", data, exp)
+		return
+	}
+
+	var q Pipeline
+
+	if err = json.Unmarshal(data, &q); err != nil {
+		t.Error(err)
+		return
+	}
+
+	const src = "x--y me@host"
+
+	if res, exp := string(q.Rewriter().Do([]byte(src))), string(p.Rewriter().Do([]byte(src))); res != exp {
+		t.Errorf("Unexpected result: %q instead of %q", res, exp)
+		return
+	}
+
+	invalid := []string{
+		`{}`,
+		`[{"op":"remove","lit":"a"}]`,
+		`[{"op":"delete","lit":"a","extra":1}]`,
+		`[{"op":"delete","lit":"a"},{"op":"expand","lit":"a"}]`,
+		`[{"op":"replace","patt":"("}]`,
+	}
+
+	for i, s := range invalid {
+		if err = json.Unmarshal([]byte(s), &q); err == nil {
+			t.Errorf("[%d] Missing error", i)
+			return
+		}
+	}
+}
+
+func TestProgramJSON(t *testing.T) {
+	prog := Pipeline{
+		{Op: OpDelete, Lit: "--"},
+		{Op: OpReplace, Patt: `\d+`, Subst: "N"},
+		{Op: OpExpand, Patt: `(\w+)@(\w+)`, Subst: "${2}/${1}"},
+	}.Compile()
+
+	data, err := json.Marshal(prog)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	const exp = `[{"op":"delete","lit":"--"},{"op":"replace","patt":"\\d+","subst":"N"},` +
+		`{"op":"expand","patt":"(\\w+)@(\\w+)","subst":"${2}/${1}"}]`
+
+	if string(data) != exp {
+		t.Errorf("Unexpected JSON: %s instead of %s", data, exp)
+		return
+	}
+
+	// round trip, as a struct field
+	var v struct{ Prog Program }
+
+	if err = json.Unmarshal([]byte(`{"Prog":`+string(data)+`}`), &v); err != nil {
+		t.Error(err)
+		return
+	}
+
+	const src = "x--y 123 me@host"
+
+	if res, exp := string(v.Prog.Do([]byte(src))), string(prog.Do([]byte(src))); res != exp {
+		t.Errorf("Unexpected result: %q instead of %q", res, exp)
+		return
+	}
+
+	if again, err := json.Marshal(v.Prog); err != nil || string(again) != exp {
+		t.Errorf("Unexpected JSON: %s, %v", again, err)
+		return
+	}
+
+	if !reflect.DeepEqual(v.Prog.Pipeline(), prog.Pipeline()) {
+		t.Errorf("Unexpected pipeline: %v", v.Prog.Pipeline())
+		return
+	}
+
+	// empty program
+	if data, err = json.Marshal(Program{}); err != nil || string(data) != "null" {
+		t.Errorf("Unexpected JSON of an empty program: %s, %v", data, err)
+		return
+	}
+
+	// invalid JSON
+	for i, s := range []string{`[]`, `{}`, `[{"op":"delete"}]`} {
+		var prog Program
+
+		if err = json.Unmarshal([]byte(s), &prog); err == nil || prog.Rewriter != nil {
+			t.Errorf("[%d] Missing error", i)
+			return
+		}
+	}
+}
+
+func TestAsReplacer(t *testing.T) {
+	cases := []struct {
+		p   Pipeline
+		ok  bool
+		src string
+	}{
+		{Pipeline{{Op: OpReplace, Lit: "a", Subst: "b"}}, true, "aaa"},
+		{Pipeline{{Op: OpReplace, Lit: "a", Subst: "b"}, {Op: OpReplace, Lit: "c", Subst: "d"}}, true, "abcd"},
+		{Pipeline{{Op: OpReplace, Lit: "a", Subst: "b"}, {Op: OpReplace, Lit: "b", Subst: "c"}}, false, "ab"},
+		{Pipeline{{Op: OpReplace, Lit: "ab", Subst: "x"}, {Op: OpReplace, Lit: "bc", Subst: "y"}}, false, "abc"},
+		{Pipeline{{Op: OpDelete, Lit: "x"}, {Op: OpReplace, Lit: "ab", Subst: "y"}}, false, "axb"},
+		{Pipeline{{Op: OpDelete, Lit: "x"}, {Op: OpReplace, Lit: "a", Subst: "y"}}, true, "axb"},
+		{Pipeline{{Op: OpReplace, Lit: "<", Subst: "&lt;"}, {Op: OpReplace, Lit: ">", Subst: "&gt;"}}, true, "<a>"},
+		{Pipeline{{Op: OpReplace, Lit: "&", Subst: "&amp;"}, {Op: OpReplace, Lit: "<", Subst: "&lt;"}}, true, "&<"},
+		{Pipeline{{Op: OpReplace, Lit: "<", Subst: "&lt;"}, {Op: OpReplace, Lit: "&", Subst: "&amp;"}}, false, "&<"},
+		{Pipeline{{Op: OpReplace, Patt: "a", Subst: "b"}}, false, "a"},
+		{Pipeline{{Op: OpExpand, Patt: "a", Subst: "b"}}, false, "a"},
+	}
+
+	for i, c := range cases {
+		r, ok := AsReplacer(c.p)
+
+		if ok != c.ok {
+			t.Errorf("[%d] Unexpected conversion result: %v", i, ok)
+			return
+		}
+
+		if ok {
+			if res, exp := r.Replace(c.src), string(c.p.Rewriter().Do([]byte(c.src))); res != exp {
+				t.Errorf("[%d] Unexpected result: %q instead of %q", i, res, exp)
+				return
+			}
+		}
+	}
+
+	if _, ok := AsReplacer(nil); ok {
+		t.Error("Unexpected conversion of an empty pipeline")
+		return
+	}
+}
+
+func TestExplain(t *testing.T) {
+	cases := []struct {
+		p   Pipeline
+		exp string
+	}{
+		{
+			Pipeline{{Op: OpReplace, Lit: "a", Subst: "b"}, {Op: OpDelete, Patt: `\d+`}},
+			"stage #0: replace \"a\" with \"b\"\nstage #1: delete /\\d+/\n",
+		},
+		{
+			Pipeline{{Op: OpReplace, Lit: "<", Subst: "&lt;"}, {Op: OpReplace, Lit: "&", Subst: "&amp;"}},
+			"stage #0: replace \"<\" with \"&lt;\"\nstage #1: replace \"&\" with \"&amp;\"\n" +
+				"\twarning: may match text produced by stage #0\n",
+		},
+		{ // literal overlapping the end of the substitution
+			Pipeline{{Op: OpReplace, Lit: "c", Subst: "b"}, {Op: OpDelete, Lit: "ab"}},
+			"stage #0: replace \"c\" with \"b\"\nstage #1: delete \"ab\"\n" +
+				"\twarning: may match text produced by stage #0\n",
+		},
+		{ // literal overlapping the start of the substitution
+			Pipeline{{Op: OpReplace, Lit: "c", Subst: "bx"}, {Op: OpDelete, Lit: "xb"}},
+			"stage #0: replace \"c\" with \"bx\"\nstage #1: delete \"xb\"\n" +
+				"\twarning: may match text produced by stage #0\n",
+		},
+		{ // common bytes only
+			Pipeline{{Op: OpReplace, Lit: "c", Subst: "x y"}, {Op: OpDelete, Lit: " z"}, {Op: OpDelete, Lit: "a b"}},
+			"stage #0: replace \"c\" with \"x y\"\nstage #1: delete \" z\"\nstage #2: delete \"a b\"\n",
+		},
+		{
+			Pipeline{{Op: OpReplace, Lit: "a", Subst: "123"}, {Op: OpExpand, Patt: `\d+`, Subst: "<$0>"}},
+			"stage #0: replace \"a\" with \"123\"\nstage #1: expand /\\d+/ with \"<$0>\"\n" +
+				"\twarning: may match text produced by stage #0\n",
+		},
+		{ // pattern match across the end of the substitution
+			Pipeline{{Op: OpReplace, Lit: "€", Subst: "EUR"}, {Op: OpReplace, Patt: `R\d`, Subst: "x"}},
+			"stage #0: replace \"€\" with \"EUR\"\nstage #1: replace /R\\d/ with \"x\"\n" +
+				"\twarning: may match text produced by stage #0\n",
+		},
+		{ // pattern match across the start of the substitution
+			Pipeline{{Op: OpReplace, Lit: "€", Subst: "EUR"}, {Op: OpDelete, Patt: `\dE`}},
+			"stage #0: replace \"€\" with \"EUR\"\nstage #1: delete /\\dE/\n" +
+				"\twarning: may match text produced by stage #0\n",
+		},
+		{ // pattern match spanning the whole substitution
+			Pipeline{{Op: OpReplace, Lit: "€", Subst: "EUR"}, {Op: OpDelete, Patt: `\d[A-Z]+\d`}},
+			"stage #0: replace \"€\" with \"EUR\"\nstage #1: delete /\\d[A-Z]+\\d/\n" +
+				"\twarning: may match text produced by stage #0\n",
+		},
+		{ // no possible match
+			Pipeline{{Op: OpReplace, Lit: "€", Subst: "EUR"}, {Op: OpDelete, Patt: `\d+@[a-z]+`}, {Op: OpDelete, Patt: `U\d`}},
+			"stage #0: replace \"€\" with \"EUR\"\nstage #1: delete /\\d+@[a-z]+/\nstage #2: delete /U\\d/\n",
+		},
+		{
+			Pipeline{{Op: OpDelete, Patt: `x*`}, {Op: OpReplace, Patt: `y*`, Subst: "-"}},
+			"stage #0: delete /x*/\n\twarning: pattern matches the empty string, such matches are ignored\n" +
+				"stage #1: replace /y*/ with \"-\"\n" +
+				"\twarning: pattern matches the empty string, the substitution is inserted at every such match\n",
+		},
+		{
+			Pipeline{{Op: OpDelete, Lit: "b"}, {Op: OpDelete, Lit: "abc"}},
+			"stage #0: delete \"b\"\nstage #1: delete \"abc\"\n" +
+				"\twarning: literal contains \"b\" deleted by stage #0, so it only matches text formed by the deletion\n",
+		},
+		{ // invalid stages
+			Pipeline{{Op: OpReplace, Patt: "(", Subst: "a"}, {Op: OpExpand, Lit: "a", Subst: "b"}, {Op: OpDelete, Lit: "a"}},
+			"stage #0: replace /(/ with \"a\"\n\terror: error parsing regexp: missing closing ): `(`\n" +
+				"stage #1: expand \"a\" with \"b\"\n\terror: literal in an expand stage\n" +
+				"stage #2: delete \"a\"\n",
+		},
+	}
+
+	for i, c := range cases {
+		if res := Explain(c.p); res != c.exp {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, res, c.exp)
+			return
+		}
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	ps := []Pipeline{
+		{{Op: OpDelete, Lit: "a"}},
+		{{Op: OpDelete, Patt: "a"}},
+		{{Op: OpReplace, Lit: "a"}},
+		{{Op: OpReplace, Lit: "a", Subst: "b"}},
+		{{Op: OpReplace, Lit: "ab"}},
+		{{Op: OpReplace, Lit: "a", Subst: "b"}, {Op: OpDelete, Lit: "c"}},
+		{{Op: OpDelete, Lit: "c"}, {Op: OpReplace, Lit: "a", Subst: "b"}},
+		{{Op: OpDelete, Lit: "a"}, {Op: OpDelete, Lit: "a"}},
+	}
+
+	seen := make(map[string]int)
+
+	for i, p := range ps {
+		fp := Fingerprint(p)
+
+		if j, ok := seen[fp]; ok {
+			t.Errorf("[%d] Same fingerprint as of pipeline #%d", i, j)
+			return
+		}
+
+		seen[fp] = i
+
+		if fp != Fingerprint(append(Pipeline(nil), p...)) {
+			t.Errorf("[%d] Unstable fingerprint", i)
+			return
+		}
+	}
+
+	// the fingerprint must not change between versions
+	const exp = "f8901165936886d33b6aca0911f51d0b9913310f32e19795d74bac97e8734c42"
+
+	if fp := Fingerprint(ps[3]); fp != exp {
+		t.Errorf("Unexpected fingerprint: %s", fp)
+		return
+	}
+
+	// names are not included
+	if fp := Fingerprint(Pipeline{{Name: "ab", Op: OpReplace, Lit: "a", Subst: "b"}}); fp != exp {
+		t.Errorf("Unexpected fingerprint of a named stage: %s", fp)
+		return
+	}
+}
+
+func TestPipelineMetrics(t *testing.T) {
+	p := Pipeline{
+		{Name: "dashes", Op: OpDelete, Lit: "--"},
+		{Op: OpReplace, Patt: `\d+`, Subst: "N"},
+		{Op: OpExpand, Patt: `(\w+)@(\w+)`, Subst: "${2}/${1}"},
+	}
+
+	var stages []string
+	var counts []int
+
+	rw := p.Rewriter(WithPipelineMetrics(func(stage string, matches int, d time.Duration) {
+		if d < 0 {
+			t.Errorf("Negative duration of stage %s", stage)
+		}
+
+		stages = append(stages, stage)
+		counts = append(counts, matches)
+	}))
+
+	const src, exp = "x--y--z 123 45 me@host", "xyz N N host/me"
+
+	if res := rw.Do([]byte(src)); string(res) != exp {
+		t.Errorf("Unexpected result: %q instead of %q", string(res), exp)
+		return
+	}
+
+	if e := []string{"dashes", "#1", "#2"}; !reflect.DeepEqual(stages, e) {
+		t.Errorf("Unexpected stages: %q instead of %q", stages, e)
+		return
+	}
+
+	if e := []int{2, 2, 1}; !reflect.DeepEqual(counts, e) {
+		t.Errorf("Unexpected match counts: %v instead of %v", counts, e)
+		return
+	}
+
+	// the instrumented literal stage still finds the matches one at a time
+	total := 0
+	rw = Pipeline{{Op: OpDelete, Lit: "--"}}.Rewriter(WithPipelineMetrics(func(_ string, matches int, _ time.Duration) {
+		total += matches
+	}))
+
+	few, many := []byte(strings.Repeat("a--", 10)), []byte(strings.Repeat("a--", 1000))
+	allocs := func(src []byte) float64 {
+		return testing.AllocsPerRun(10, func() { rw.DoCopy(src) })
+	}
+
+	if a, b := allocs(few), allocs(many); a != b {
+		t.Errorf("Allocations depend on the number of matches: %v vs %v", a, b)
+		return
+	}
+
+	if total != 11*(10+1000) {
+		t.Errorf("Unexpected total match count: %d", total)
+		return
+	}
+}
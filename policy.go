@@ -0,0 +1,477 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strconv"
+)
+
+// Action specifies what a Policy does with the text found by a detector.
+type Action int
+
+// Policy actions.
+const (
+	ActionMask         Action = iota // replace the match with the detector's mask string
+	ActionHash                       // replace the match with a keyed hash of it
+	ActionPseudonymize               // replace the match with its pseudonym from the detector's table
+	ActionDropLine                   // delete the whole line(s) containing the match
+	ActionReject                     // reject the whole input
+)
+
+var actionNames = [...]string{
+	ActionMask:         "mask",
+	ActionHash:         "hash",
+	ActionPseudonymize: "pseudonymize",
+	ActionDropLine:     "drop-line",
+	ActionReject:       "reject",
+}
+
+// String returns the name of the action, like "mask".
+func (a Action) String() string {
+	if a >= 0 && int(a) < len(actionNames) {
+		return actionNames[a]
+	}
+
+	return "Action(" + strconv.Itoa(int(a)) + ")"
+}
+
+// MarshalText implements encoding.TextMarshaler interface.
+func (a Action) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler interface.
+func (a *Action) UnmarshalText(text []byte) error {
+	for i, name := range actionNames {
+		if string(text) == name {
+			*a = Action(i)
+			return nil
+		}
+	}
+
+	return errors.New("invalid action " + strconv.Quote(string(text)))
+}
+
+// Detector is a named Matcher with an associated action.
+type Detector struct {
+	Name     string      // detector name, like "email"
+	Match    Matcher     // matcher for the sensitive data
+	Action   Action      // what to do with the matches
+	Mask     string      // replacement for ActionMask; defaults to "[NAME]", with the name in upper case
+	Table    *Pseudonyms // pseudonym table for ActionPseudonymize
+	Severity Severity    // severity of the findings, for reporting
+}
+
+// DetectorMap converts the given map of detectors to a list suitable for Policy.Detectors,
+// with each detector's name set to its key. Since the list order defines the detector priorities,
+// the list is sorted by name, so that the result does not depend on the map iteration order.
+func DetectorMap(m map[string]Detector) []Detector {
+	names := make([]string, 0, len(m))
+
+	for name := range m {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	list := make([]Detector, len(names))
+
+	for i, name := range names {
+		list[i] = m[name]
+		list[i].Name = name
+	}
+
+	return list
+}
+
+// Policy is a declarative description of a redaction pipeline: a list of detectors, each with
+// its own action, and a list of exempt regions where no detectors are applied. A Policy is
+// compiled to a single Rewriter that runs all the detectors over the input, and then rewrites
+// it in one pass.
+type Policy struct {
+	Detectors []Detector // detectors, in the order of priority
+	Exempt    []Matcher  // matchers for the regions that are never redacted, like code blocks
+	Seed      []byte     // secret key for ActionHash
+}
+
+// Compile creates a Rewriter that applies the policy. If any ActionReject detector matches
+// the input outside the exempt regions, the Rewriter produces empty output; use Apply()
+// to get an error instead. Otherwise, all the detectors are run on the input,
+// and the matches are resolved so that the one that starts first wins, and among the matches
+// starting at the same position, the one from the detector that comes first in the list wins;
+// the winner is extended to cover all the matches overlapping it, which are then discarded,
+// so that no part of them is left unredacted. For the purpose of the resolution, matches
+// from ActionDropLine detectors span whole lines, and take precedence over all other matches
+// starting on the same lines. Empty matches, and matches overlapping
+// any exempt region, are ignored. The policy is copied, so modifying it after the call
+// does not affect the Rewriter.
+func (p *Policy) Compile() Rewriter {
+	c := p.compile("Compile")
+
+	return func(dest, src []byte) ([]byte, []byte) {
+		ms, rejected := c.find(src)
+
+		if rejected {
+			return dest[:0], src
+		}
+
+		return c.rewrite(dest, src, ms)
+	}
+}
+
+// Apply applies the policy to the given input, as in Compile(), and returns the result.
+// If any ActionReject detector matches the input outside the exempt regions, Apply returns nil
+// and a *RejectError with the report of the rejecting findings. The input slice may be
+// modified in place.
+func (p *Policy) Apply(src []byte) ([]byte, error) {
+	c := p.compile("Apply")
+	ms, rejected := c.find(src)
+
+	if rejected {
+		return nil, &RejectError{Report: c.report(src, ms, true)}
+	}
+
+	res, _ := c.rewrite(nil, src, ms)
+	return res, nil
+}
+
+// RejectError is the error returned from Policy.Apply() when the input has been rejected.
+type RejectError struct {
+	Report *Report // findings from the ActionReject detectors
+}
+
+// Error implements error interface.
+func (e *RejectError) Error() string {
+	f := &e.Report.Findings[0]
+
+	return "input rejected by detector " + strconv.Quote(f.Detector) + " at line " + strconv.Itoa(f.Line)
+}
+
+// compiledPolicy is the immutable copy of a Policy.
+type compiledPolicy struct {
+	detectors []Detector
+	reject    bool     // true if there is at least one ActionReject detector
+	labels    []string // detector names, or "#index"
+	exempt    []Matcher
+	seed      []byte
+}
+
+// policyMatch is a match from a detector; for ActionDropLine the location is expanded
+// to the whole line(s).
+type policyMatch struct {
+	start, end int
+	det        int // detector index
+}
+
+func (p *Policy) compile(method string) *compiledPolicy {
+	if errs := p.validate(); len(errs) > 0 {
+		panic(errs[0].Message + " in trw.Policy." + method + "() method")
+	}
+
+	c := &compiledPolicy{
+		detectors: append([]Detector(nil), p.Detectors...),
+		exempt:    append([]Matcher(nil), p.Exempt...),
+		seed:      append([]byte(nil), p.Seed...),
+	}
+
+	for i := range c.detectors {
+		c.labels = append(c.labels, p.label(i))
+		c.reject = c.reject || c.detectors[i].Action == ActionReject
+
+		if d := &c.detectors[i]; d.Action == ActionMask && len(d.Mask) == 0 {
+			d.Mask = "[" + string(bytes.ToUpper([]byte(policyName(d)))) + "]"
+		}
+	}
+
+	return c
+}
+
+// validate returns the list of errors that make the policy unusable.
+func (p *Policy) validate() (errs []LintWarning) {
+	if len(p.Detectors) == 0 {
+		errs = append(errs, LintWarning{Message: "empty detector list"})
+	}
+
+	for i := range p.Detectors {
+		d := &p.Detectors[i]
+		msg := ""
+
+		switch {
+		case d.Match == nil:
+			msg = "nil matcher"
+		case d.Action == ActionHash && len(p.Seed) == 0:
+			msg = "empty seed"
+		case d.Action == ActionPseudonymize && d.Table == nil:
+			msg = "nil pseudonym table"
+		case d.Action < ActionMask || d.Action > ActionReject:
+			msg = "invalid action"
+		case d.Severity < SeverityInfo || d.Severity > SeverityCritical:
+			msg = "invalid severity"
+		default:
+			continue
+		}
+
+		errs = append(errs, LintWarning{
+			Detector: p.label(i),
+			Message:  msg + " in detector " + strconv.Quote(p.label(i)),
+		})
+	}
+
+	for _, match := range p.Exempt {
+		if match == nil {
+			errs = append(errs, LintWarning{Message: "nil exempt matcher"})
+			break
+		}
+	}
+
+	return
+}
+
+// label returns the name of the i-th detector, or "#i" if the detector has no name.
+func (p *Policy) label(i int) string {
+	if name := p.Detectors[i].Name; len(name) > 0 {
+		return name
+	}
+
+	return "#" + strconv.Itoa(i)
+}
+
+func policyName(d *Detector) string {
+	if len(d.Name) == 0 {
+		return "redacted"
+	}
+
+	return d.Name
+}
+
+// find runs all the detectors on the given input, and returns the resolved non-overlapping matches,
+// sorted by their location. If the input is rejected, only the matches from ActionReject detectors
+// are returned, and the flag is set.
+func (c *compiledPolicy) find(s []byte) ([]policyMatch, bool) {
+	ms := c.candidates(s)
+
+	if len(ms) == 0 {
+		return nil, false
+	}
+
+	exempt := c.exemptRegions(s)
+
+	if c.reject {
+		var rejects []policyMatch
+
+		for _, m := range c.resolveExempt(append([]policyMatch(nil), ms...), exempt) {
+			if c.detectors[m.det].Action == ActionReject {
+				rejects = append(rejects, m)
+			}
+		}
+
+		if len(rejects) > 0 {
+			return rejects, true
+		}
+	}
+
+	return c.resolve(s, ms, exempt), false
+}
+
+// candidates runs all the detectors on the given input, and returns all their non-empty matches,
+// sorted in the order of priority.
+func (c *compiledPolicy) candidates(s []byte) (ms []policyMatch) {
+	for k := range c.detectors {
+		drop := c.detectors[k].Action == ActionDropLine
+
+		for _, m := range c.detectors[k].Match(s) {
+			if m[0] == m[1] {
+				continue
+			}
+
+			pm := policyMatch{m[0], m[1], k}
+
+			if drop {
+				pm.start = bytes.LastIndexByte(s[:pm.start], '\n') + 1
+				_, pm.end = nextLine(s, pm.end-1)
+			}
+
+			ms = append(ms, pm)
+		}
+	}
+
+	sort.SliceStable(ms, func(i, j int) bool {
+		if ms[i].start != ms[j].start {
+			return ms[i].start < ms[j].start
+		}
+
+		if di, dj := c.detectors[ms[i].det].Action == ActionDropLine, c.detectors[ms[j].det].Action == ActionDropLine; di != dj {
+			return di
+		}
+
+		return ms[i].det < ms[j].det
+	})
+
+	return
+}
+
+// resolve selects the non-overlapping matches outside of the exempt regions from the given
+// candidates, reusing the candidates' slice. Each selected match is extended to cover all
+// the candidates overlapping it, so that no part of the discarded matches is left in clear text.
+func (c *compiledPolicy) resolve(s []byte, ms []policyMatch, exempt [][]int) []policyMatch {
+	res := ms[:0]
+	end := 0 // end of the last accepted match
+
+	for _, m := range ms {
+		// skip the exempt regions ending before the match
+		for len(exempt) > 0 && exempt[0][1] <= m.start {
+			exempt = exempt[1:]
+		}
+
+		if len(exempt) > 0 && exempt[0][0] < m.end {
+			continue
+		}
+
+		if m.start < end {
+			// extend the last accepted match
+			if last := &res[len(res)-1]; m.end > end {
+				if last.end = m.end; c.detectors[last.det].Action == ActionDropLine {
+					_, last.end = nextLine(s, m.end-1)
+				}
+
+				end = last.end
+			}
+
+			continue
+		}
+
+		res = append(res, m)
+		end = m.end
+	}
+
+	return res
+}
+
+// rewrite applies the substitutions for the given matches.
+func (c *compiledPolicy) rewrite(dest, src []byte, ms []policyMatch) ([]byte, []byte) {
+	if len(ms) == 0 {
+		return src, dest
+	}
+
+	// (speculatively) reallocate destination slice
+	if len(src) > cap(dest) {
+		dest = make([]byte, 0, len(src)+len(src)/5) // +20%
+	}
+
+	dest = dest[:0]
+	prev := 0
+
+	for _, m := range ms {
+		dest = append(dest, src[prev:m.start]...)
+		dest = c.appendSubst(dest, src, &m)
+		prev = m.end
+	}
+
+	return append(dest, src[prev:]...), src
+}
+
+// resolveExempt removes the candidates overlapping the exempt regions, reusing the candidates' slice.
+func (c *compiledPolicy) resolveExempt(ms []policyMatch, exempt [][]int) []policyMatch {
+	res := ms[:0]
+
+	for _, m := range ms {
+		for len(exempt) > 0 && exempt[0][1] <= m.start {
+			exempt = exempt[1:]
+		}
+
+		if len(exempt) == 0 || exempt[0][0] >= m.end {
+			res = append(res, m)
+		}
+	}
+
+	return res
+}
+
+// exemptRegions returns the sorted list of non-overlapping exempt regions.
+func (c *compiledPolicy) exemptRegions(s []byte) [][]int {
+	var regions [][]int
+
+	for _, match := range c.exempt {
+		for _, m := range match(s) {
+			if m[0] < m[1] {
+				regions = append(regions, m[:2])
+			}
+		}
+	}
+
+	if len(regions) < 2 {
+		return regions
+	}
+
+	sort.Slice(regions, func(i, j int) bool { return regions[i][0] < regions[j][0] })
+
+	// merge
+	res := regions[:1]
+
+	for _, r := range regions[1:] {
+		if last := res[len(res)-1]; r[0] <= last[1] {
+			if r[1] > last[1] {
+				res[len(res)-1] = []int{last[0], r[1]}
+			}
+		} else {
+			res = append(res, r)
+		}
+	}
+
+	return res
+}
+
+// appendSubst appends to the destination slice the substitution for the given match.
+func (c *compiledPolicy) appendSubst(dest, src []byte, m *policyMatch) []byte {
+	d := &c.detectors[m.det]
+
+	switch d.Action {
+	case ActionMask:
+		return append(dest, d.Mask...)
+	case ActionHash:
+		mac := hmac.New(sha256.New, c.seed)
+
+		mac.Write(src[m.start:m.end])
+
+		var buf [2 * sha256.Size]byte
+
+		hex.Encode(buf[:], mac.Sum(nil))
+		return append(dest, buf[:16]...)
+	case ActionPseudonymize:
+		return append(dest, d.Table.Get(string(src[m.start:m.end]))...)
+	default: // ActionDropLine
+		return dest
+	}
+}
@@ -0,0 +1,324 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// RenameMetric creates a Rewriter that renames the given metric family in text in Prometheus
+// exposition format. Both the samples (including those with _bucket, _count, _sum, _total,
+// and _created suffixes) and the HELP, TYPE, and UNIT lines are renamed.
+func RenameMetric(oldName, newName string) Rewriter {
+	if !isMetricName(oldName) || !isMetricName(newName) {
+		panic("invalid metric name in trw.RenameMetric() function")
+	}
+
+	match := func(s []byte) (ms [][]int) {
+		for i := 0; i < len(s); {
+			end, next := nextLine(s, i)
+
+			if p, ok := parseSample(s, i, end); ok {
+				if isMetricFamily(s[p.n0:p.n1], oldName) {
+					ms = append(ms, []int{p.n0, p.n0 + len(oldName)})
+				}
+			} else if j := metricComment(s, i, end); j >= 0 {
+				if k := j + len(oldName); k <= end && string(s[j:k]) == oldName && (k == end || s[k] == ' ') {
+					ms = append(ms, []int{j, k})
+				}
+			}
+
+			i = next
+		}
+
+		return
+	}
+
+	return Replace(match, newName)
+}
+
+// AddLabel creates a Rewriter that adds the given label to all samples in text in Prometheus
+// exposition format, replacing the existing value if the label is already present.
+// HELP and TYPE lines, as well as exemplars, are left intact.
+func AddLabel(name, value string) Rewriter {
+	if !isLabelName(name) {
+		panic("invalid label name in trw.AddLabel() function")
+	}
+
+	// replacements: label value, label appended, label in empty braces, label in new braces
+	pair := name + `="` + labelEscaper.Replace(value) + `"`
+	repl := [...]string{pair[len(name)+1:], "," + pair, pair, "{" + pair + "}"}
+
+	match := func(s []byte) (ms [][]int) {
+		for i := 0; i < len(s); {
+			end, next := nextLine(s, i)
+
+			if p, ok := parseSample(s, i, end); ok {
+				var m []int
+
+				switch {
+				case p.l0 == p.l1:
+					m = []int{p.n1, p.n1, 3}
+				case len(p.labels) == 0:
+					m = []int{p.l0 + 1, p.l0 + 1, 2}
+				default:
+					last := p.labels[len(p.labels)-1]
+					m = []int{last.p1, last.p1, 1}
+
+					for _, l := range p.labels {
+						if string(s[l.p0:l.k1]) == name {
+							m = []int{l.v0, l.p1, 0}
+							break
+						}
+					}
+				}
+
+				ms = append(ms, m)
+			}
+
+			i = next
+		}
+
+		return
+	}
+
+	return rewrite(match, func(dest, _ []byte, m []int) []byte {
+		return append(dest, repl[m[2]]...)
+	})
+}
+
+// DropLabel creates a Rewriter that removes the given label from all samples in text
+// in Prometheus exposition format. Exemplars are left intact.
+func DropLabel(name string) Rewriter {
+	if !isLabelName(name) {
+		panic("invalid label name in trw.DropLabel() function")
+	}
+
+	match := func(s []byte) (ms [][]int) {
+		for i := 0; i < len(s); {
+			end, next := nextLine(s, i)
+
+			if p, ok := parseSample(s, i, end); ok {
+				for j, l := range p.labels {
+					if string(s[l.p0:l.k1]) != name {
+						continue
+					}
+
+					switch {
+					case len(p.labels) == 1: // the only label, remove the braces as well
+						ms = append(ms, []int{p.l0, p.l1})
+					case j > 0: // remove the label and the preceding comma
+						ms = append(ms, []int{p.labels[j-1].p1, l.p1})
+					default: // remove the label and the following comma
+						ms = append(ms, []int{l.p0, p.labels[1].p0})
+					}
+
+					break
+				}
+			}
+
+			i = next
+		}
+
+		return
+	}
+
+	return Delete(match)
+}
+
+// sample is the location of the parts of a sample line in Prometheus exposition format.
+type sample struct {
+	n0, n1 int     // metric name
+	l0, l1 int     // label set, including the braces (l0 == l1 if absent)
+	labels []label // individual labels
+}
+
+// label is the location of a label within the label set.
+type label struct {
+	p0, p1 int // the whole name="value" pair
+	k1     int // end of the label name
+	v0     int // start of the quoted value
+}
+
+// parseSample parses the sample line s[i:end], which must have the metric name, optional label set,
+// and the numeric value separated by whitespace.
+func parseSample(s []byte, i, end int) (p sample, ok bool) {
+	for i < end && (s[i] == ' ' || s[i] == '\t') {
+		i++
+	}
+
+	if p.n0 = i; i < end && isMetricChar(s[i], true) {
+		for i++; i < end && isMetricChar(s[i], false); i++ {
+		}
+	}
+
+	if p.n1, p.l0, p.l1 = i, i, i; p.n1 == p.n0 {
+		return
+	}
+
+	if i < end && s[i] == '{' {
+		if p.l1 = parseLabels(s, i, end, &p.labels); p.l1 < 0 {
+			return
+		}
+
+		i = p.l1
+	}
+
+	// whitespace and the value
+	j := i
+
+	for j < end && (s[j] == ' ' || s[j] == '\t') {
+		j++
+	}
+
+	k := j
+
+	for k < end && s[k] != ' ' && s[k] != '\t' && s[k] != '\r' {
+		k++
+	}
+
+	if j == i || k == j {
+		return
+	}
+
+	if _, err := strconv.ParseFloat(string(s[j:k]), 64); err != nil {
+		return
+	}
+
+	return p, true
+}
+
+// parseLabels parses the label set starting at s[i] (which must be '{'), and returns the index
+// of the first byte after the closing brace, or -1 if the label set is malformed.
+func parseLabels(s []byte, i, end int, labels *[]label) int {
+	skip := func() {
+		for i < end && (s[i] == ' ' || s[i] == '\t') {
+			i++
+		}
+	}
+
+	for i++; ; {
+		if skip(); i == end {
+			return -1
+		}
+
+		if s[i] == '}' {
+			return i + 1
+		}
+
+		// name
+		l := label{p0: i}
+
+		for i < end && isMetricChar(s[i], i == l.p0) && s[i] != ':' {
+			i++
+		}
+
+		l.k1 = i
+
+		if skip(); i == l.p0 || i == end || s[i] != '=' {
+			return -1
+		}
+
+		// value
+		i++
+
+		if skip(); i == end || s[i] != '"' {
+			return -1
+		}
+
+		for l.v0, i = i, i+1; i < end && s[i] != '"'; i++ {
+			if s[i] == '\\' {
+				i++
+			}
+		}
+
+		if i >= end {
+			return -1
+		}
+
+		l.p1 = i + 1
+		*labels = append(*labels, l)
+
+		i++
+
+		if skip(); i < end && s[i] == ',' {
+			i++
+		}
+	}
+}
+
+// metricComment returns the index of the metric name in the HELP, TYPE, or UNIT comment
+// line s[i:end], or -1 if the line is not such a comment.
+func metricComment(s []byte, i, end int) int {
+	line := s[i:end]
+
+	for _, prefix := range [...]string{"# HELP ", "# TYPE ", "# UNIT "} {
+		if bytes.HasPrefix(line, []byte(prefix)) {
+			return i + len(prefix)
+		}
+	}
+
+	return -1
+}
+
+// isMetricFamily checks if the given sample name belongs to the given metric family.
+func isMetricFamily(name []byte, family string) bool {
+	if !bytes.HasPrefix(name, []byte(family)) {
+		return false
+	}
+
+	switch string(name[len(family):]) {
+	case "", "_bucket", "_count", "_sum", "_total", "_created":
+		return true
+	default:
+		return false
+	}
+}
+
+func isMetricChar(c byte, first bool) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_' || c == ':' || (!first && isDigit(c))
+}
+
+func isMetricName(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isMetricChar(s[i], i == 0) {
+			return false
+		}
+	}
+
+	return len(s) > 0
+}
+
+func isLabelName(s string) bool {
+	return isMetricName(s) && strings.IndexByte(s, ':') < 0
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
@@ -0,0 +1,131 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"bytes"
+	"testing"
+)
+
+const promSample = `# HELP http_requests Total requests.
+# TYPE http_requests counter
+http_requests_total{method="GET",code="200"} 1027 1395066363000
+http_requests_total{method="POST", code="400"} 3
+# HELP latency Request latency.
+# TYPE latency histogram
+latency_bucket{le="0.5"} 10 # {trace_id="abc"} 0.3
+latency_count 10
+http_requests_other{} 1
+`
+
+func TestRenameMetric(t *testing.T) {
+	const exp = `# HELP requests Total requests.
+# TYPE requests counter
+requests_total{method="GET",code="200"} 1027 1395066363000
+requests_total{method="POST", code="400"} 3
+# HELP latency Request latency.
+# TYPE latency histogram
+latency_bucket{le="0.5"} 10 # {trace_id="abc"} 0.3
+latency_count 10
+http_requests_other{} 1
+`
+
+	if res := RenameMetric("http_requests", "requests").Do([]byte(promSample)); !bytes.Equal(res, []byte(exp)) {
+		t.Errorf("Unexpected result: %q instead of %q", string(res), exp)
+		return
+	}
+}
+
+func TestAddLabel(t *testing.T) {
+	const exp = `# HELP http_requests Total requests.
+# TYPE http_requests counter
+http_requests_total{method="GET",code="200",env="a\"b"} 1027 1395066363000
+http_requests_total{method="POST", code="400",env="a\"b"} 3
+# HELP latency Request latency.
+# TYPE latency histogram
+latency_bucket{le="0.5",env="a\"b"} 10 # {trace_id="abc"} 0.3
+latency_count{env="a\"b"} 10
+http_requests_other{env="a\"b"} 1
+`
+
+	if res := AddLabel("env", `a"b`).Do([]byte(promSample)); !bytes.Equal(res, []byte(exp)) {
+		t.Errorf("Unexpected result: %q instead of %q", string(res), exp)
+		return
+	}
+
+	const exp2 = `x{code="500",a="1"} 1`
+
+	if res := AddLabel("code", "500").Do([]byte(`x{code="200",a="1"} 1`)); !bytes.Equal(res, []byte(exp2)) {
+		t.Errorf("Unexpected result: %q instead of %q", string(res), exp2)
+		return
+	}
+
+	const exp3 = `x{env="a"} +Inf` + "\r\n" + `y{env="a"}	NaN`
+
+	if res := AddLabel("env", "a").Do([]byte("x +Inf\r\ny\tNaN")); !bytes.Equal(res, []byte(exp3)) {
+		t.Errorf("Unexpected result: %q instead of %q", string(res), exp3)
+		return
+	}
+
+	// not samples
+	for i, src := range []string{"x", "x ", "x{}", "x\r\n", "see http://example.com", "metric_a-x 1", "x{a=\"1\"}1", "x # 1", "x 1.5.3"} {
+		if res := AddLabel("env", "a").Do([]byte(src)); !bytes.Equal(res, []byte(src)) {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), src)
+			return
+		}
+	}
+}
+
+func TestDropLabel(t *testing.T) {
+	cases := []struct {
+		src, name, exp string
+	}{
+		{promSample, "method", `# HELP http_requests Total requests.
+# TYPE http_requests counter
+http_requests_total{code="200"} 1027 1395066363000
+http_requests_total{code="400"} 3
+# HELP latency Request latency.
+# TYPE latency histogram
+latency_bucket{le="0.5"} 10 # {trace_id="abc"} 0.3
+latency_count 10
+http_requests_other{} 1
+`},
+		{`x{a="1",b="2",c="3"} 1`, "b", `x{a="1",c="3"} 1`},
+		{`x{a="1",b="2",c="3"} 1`, "c", `x{a="1",b="2"} 1`},
+		{`x{le="0.5"} 1 # {le="0.1"} 2`, "le", `x 1 # {le="0.1"} 2`},
+		{`x{a="\"}"} 1`, "a", `x 1`},
+	}
+
+	for i, c := range cases {
+		if res := DropLabel(c.name).Do([]byte(c.src)); !bytes.Equal(res, []byte(c.exp)) {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+	}
+}
@@ -0,0 +1,186 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+)
+
+// Pseudonyms is a table mapping original values to their pseudonyms, where each distinct value
+// is assigned the next pseudonym from a generator function on its first occurrence. The table
+// is safe for concurrent use.
+type Pseudonyms struct {
+	gen   func(int) string
+	mu    sync.Mutex
+	table map[string]string
+}
+
+// NewPseudonyms creates a new empty table of pseudonyms. The given function generates
+// the n-th pseudonym, with n starting from 1; the generated values must all be distinct.
+func NewPseudonyms(gen func(n int) string) *Pseudonyms {
+	if gen == nil {
+		panic("nil generator function in trw.NewPseudonyms() function")
+	}
+
+	return &Pseudonyms{
+		gen:   gen,
+		table: make(map[string]string),
+	}
+}
+
+// Get returns the pseudonym for the given value, allocating a new one if necessary.
+func (p *Pseudonyms) Get(value string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.get(value)
+}
+
+// Len returns the number of values in the table.
+func (p *Pseudonyms) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.table)
+}
+
+// Mapping returns a copy of the table in reverse direction, mapping pseudonyms to the original
+// values, suitable for use with Restore().
+func (p *Pseudonyms) Mapping() map[string]string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	mapping := make(map[string]string, len(p.table))
+
+	for value, s := range p.table {
+		mapping[s] = value
+	}
+
+	return mapping
+}
+
+// MarshalJSON implements json.Marshaler interface. The table is encoded as a JSON object mapping
+// the original values to their pseudonyms, with the keys sorted.
+func (p *Pseudonyms) MarshalJSON() ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return json.Marshal(p.table)
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface. The table content is replaced with the
+// decoded mapping, so that the values pseudonymized in a previous run keep their pseudonyms,
+// while new values are assigned pseudonyms from the generator, starting from the n-th one,
+// where n is one more than the number of loaded entries. The table must have been created
+// with NewPseudonyms(), using the same generator function as in the previous run.
+func (p *Pseudonyms) UnmarshalJSON(data []byte) error {
+	var table map[string]string
+
+	if err := json.Unmarshal(data, &table); err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool, len(table))
+
+	for _, s := range table {
+		if seen[s] {
+			return errors.New("duplicate pseudonym " + strconv.Quote(s))
+		}
+
+		seen[s] = true
+	}
+
+	if table == nil {
+		table = make(map[string]string)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.table = table
+	return nil
+}
+
+func (p *Pseudonyms) get(value string) string {
+	s, ok := p.table[value]
+
+	if !ok {
+		s = p.gen(len(p.table) + 1)
+		p.table[value] = s
+	}
+
+	return s
+}
+
+// Pseudonymize creates a Rewriter that substitutes every match produced by the given Matcher
+// with its pseudonym from the given table.
+func Pseudonymize(match Matcher, p *Pseudonyms) Rewriter {
+	if match == nil {
+		panic("nil matcher in trw.Pseudonymize() function")
+	}
+
+	if p == nil {
+		panic("nil pseudonym table in trw.Pseudonymize() function")
+	}
+
+	return func(dest, src []byte) ([]byte, []byte) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		return rewrite(match, func(dest, src []byte, m []int) []byte {
+			return append(dest, p.get(string(src[m[0]:m[1]]))...)
+		})(dest, src)
+	}
+}
+
+// Placeholders creates a new empty table of reversible placeholders of the form "⟦LABEL_n⟧",
+// for example, "⟦EMAIL_3⟧". Text pseudonymized with the table can be restored using
+// Restore(p.Mapping()).
+func Placeholders(label string) *Pseudonyms {
+	if len(label) == 0 {
+		panic("empty label in trw.Placeholders() function")
+	}
+
+	prefix := "⟦" + label + "_"
+
+	return NewPseudonyms(func(n int) string {
+		return prefix + strconv.Itoa(n) + "⟧"
+	})
+}
+
+// Restore creates a Rewriter that substitutes every occurrence of each key of the given mapping
+// with the corresponding value, in one pass. Where keys overlap, the longest one is used.
+// Typically, the mapping comes from Pseudonyms.Mapping(), and the Rewriter reverses
+// the pseudonymization.
+func Restore(mapping map[string]string) Rewriter {
+	return replaceMap(mapping, "Restore")
+}
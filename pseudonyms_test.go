@@ -0,0 +1,140 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestPlaceholders(t *testing.T) {
+	emails, phones := Placeholders("EMAIL"), Placeholders("PHONE")
+
+	rw := Seq(
+		Pseudonymize(Patt(`[a-z.]+@[a-z.]+`), emails),
+		Pseudonymize(Patt(`\+\d{11}`), phones),
+	)
+
+	const src = "From: ann@example.com, To: bob@example.com, Cc: ann@example.com, Tel: +12025550123"
+	const exp = "From: ⟦EMAIL_1⟧, To: ⟦EMAIL_2⟧, Cc: ⟦EMAIL_1⟧, Tel: ⟦PHONE_1⟧"
+
+	res := rw.Do([]byte(src))
+
+	if !bytes.Equal(res, []byte(exp)) {
+		t.Errorf("Unexpected result: %q instead of %q", string(res), exp)
+		return
+	}
+
+	// round trip
+	mapping := emails.Mapping()
+
+	for k, v := range phones.Mapping() {
+		mapping[k] = v
+	}
+
+	if len(mapping) != 3 {
+		t.Errorf("Unexpected mapping: %v", mapping)
+		return
+	}
+
+	if res = Restore(mapping).Do(res); !bytes.Equal(res, []byte(src)) {
+		t.Errorf("Unexpected result: %q instead of %q", string(res), src)
+		return
+	}
+}
+
+func TestRestore(t *testing.T) {
+	cases := []struct {
+		mapping  map[string]string
+		src, exp string
+	}{
+		{map[string]string{"<1>": "one", "<11>": "eleven"}, "<1><11>x<111>", "oneelevenx<111>"},
+		{map[string]string{"ab": "X", "abc": "Y"}, "abcab", "YX"},
+		{map[string]string{}, "abc", "abc"},
+		{nil, "", ""},
+	}
+
+	for i, c := range cases {
+		if res := Restore(c.mapping).Do([]byte(c.src)); !bytes.Equal(res, []byte(c.exp)) {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+	}
+}
+
+func TestPseudonymsJSON(t *testing.T) {
+	p := Placeholders("ID")
+	rw := Pseudonymize(Patt(`\d+`), p)
+
+	if res := rw.Do([]byte("7 3 7")); string(res) != "⟦ID_1⟧ ⟦ID_2⟧ ⟦ID_1⟧" {
+		t.Errorf("Unexpected result: %q", string(res))
+		return
+	}
+
+	data, err := json.Marshal(p)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	const exp = `{"3":"⟦ID_2⟧","7":"⟦ID_1⟧"}`
+
+	if string(data) != exp {
+		t.Errorf("Unexpected JSON: %s instead of %s", data, exp)
+		return
+	}
+
+	// next run
+	q := Placeholders("ID")
+
+	if err = json.Unmarshal(data, q); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if res := Pseudonymize(Patt(`\d+`), q).Do([]byte("5 3 7")); string(res) != "⟦ID_3⟧ ⟦ID_2⟧ ⟦ID_1⟧" {
+		t.Errorf("Unexpected result: %q", string(res))
+		return
+	}
+
+	// errors
+	for i, s := range []string{`["x"]`, `{"a":"x","b":"x"}`} {
+		if err = json.Unmarshal([]byte(s), q); err == nil {
+			t.Errorf("[%d] Missing error", i)
+			return
+		}
+	}
+
+	if q.Len() != 3 {
+		t.Errorf("Unexpected table size: %d", q.Len())
+		return
+	}
+}
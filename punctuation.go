@@ -0,0 +1,188 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// ASCIIPunctuation creates a Rewriter that converts typographic punctuation to its ASCII
+// equivalents: curly quotes and guillemets to straight quotes, en dashes and minus signs to "-",
+// em dashes to "--", and ellipses to "...".
+func ASCIIPunctuation() Rewriter {
+	return ReplacePairs(
+		"‘", "'", "’", "'", "‚", "'", "‛", "'", "′", "'", "‹", "'", "›", "'",
+		"“", `"`, "”", `"`, "„", `"`, "‟", `"`, "″", `"`, "«", `"`, "»", `"`,
+		"‐", "-", "‑", "-", "‒", "-", "–", "-", "−", "-", "—", "--", "―", "--",
+		"…", "...",
+	)
+}
+
+// SmartPunctuation creates a Rewriter that converts ASCII punctuation to its typographic form:
+// straight quotes to curly ones (opening or closing, depending on the preceding character,
+// so that apostrophes become right single quotes), "--" to em dashes, and "..." to ellipses.
+// It is the reverse of ASCIIPunctuation() for most English text.
+func SmartPunctuation() Rewriter {
+	match := func(s []byte) (ms [][]int) {
+		for i := 0; i < len(s); i++ {
+			switch c := s[i]; {
+			case c == '"' || c == '\'':
+				kind := smartClose
+
+				if n := len(ms); n > 0 && ms[n-1][1] == i && ms[n-1][2] < smartDash {
+					// an adjacent quote: opening after opening, closing after closing
+					kind = ms[n-1][2] & 1
+				} else if isOpeningContext(s, i) {
+					kind = smartOpen
+				}
+
+				if c == '"' {
+					kind += 2
+				}
+
+				ms = append(ms, []int{i, i + 1, kind})
+			case c == '-' && i+1 < len(s) && s[i+1] == '-':
+				ms = append(ms, []int{i, i + 2, smartDash})
+				i++
+			case c == '.' && i+2 < len(s) && s[i+1] == '.' && s[i+2] == '.':
+				ms = append(ms, []int{i, i + 3, smartEllipsis})
+				i += 2
+			}
+		}
+
+		return
+	}
+
+	return rewrite(match, func(dest, _ []byte, m []int) []byte {
+		return append(dest, smartPunct[m[2]]...)
+	})
+}
+
+// Dehyphenate creates a Rewriter that removes soft hyphens (U+00AD), and rejoins the words hyphenated
+// across line breaks, as in "exam-\nple", which is common in text extracted from PDF documents.
+// A hyphen at the end of a line is removed, together with the line break and the indentation of
+// the next line, only if it follows a letter, and the next line starts with a lowercase letter,
+// so that "Jean-\nPaul" is kept intact. A soft hyphen at the end of a line is always joined with
+// the next line, unless that line is empty. The rewriting is done in-place.
+func Dehyphenate() Rewriter {
+	return Delete(func(s []byte) (ms [][]int) {
+		for i := 0; i < len(s); i++ {
+			switch {
+			case s[i] == '\xC2' && i+1 < len(s) && s[i+1] == '\xAD':
+				j := i + 2
+
+				if k := nextLineStart(s, j); k < len(s) && isRuneAt(s, k, unicode.IsLetter) {
+					j = k
+				}
+
+				ms = append(ms, []int{i, j})
+				i = j - 1
+			case s[i] == '-' && i > 0 && isLetterBefore(s, i):
+				if j := nextLineStart(s, i+1); j < len(s) && isRuneAt(s, j, unicode.IsLower) {
+					ms = append(ms, []int{i, j})
+					i = j - 1
+				}
+			}
+		}
+
+		return
+	})
+}
+
+// nextLineStart returns the index of the first non-blank character of the next line, if s[i:]
+// starts with optional whitespace and a line break, or len(s) otherwise.
+func nextLineStart(s []byte, i int) int {
+	i = skipSpaces(s, i)
+
+	if i < len(s) && s[i] == '\r' {
+		i++
+	}
+
+	if i == len(s) || s[i] != '\n' {
+		return len(s)
+	}
+
+	return skipSpaces(s, i+1)
+}
+
+func isLetterBefore(s []byte, i int) bool {
+	r, _ := utf8.DecodeLastRune(s[:i])
+	return unicode.IsLetter(r)
+}
+
+func isRuneAt(s []byte, i int, fn func(rune) bool) bool {
+	r, _ := utf8.DecodeRune(s[i:])
+	return fn(r)
+}
+
+// typographic punctuation kinds
+const (
+	smartClose = iota
+	smartOpen
+	smartCloseDouble
+	smartOpenDouble
+	smartDash
+	smartEllipsis
+)
+
+var smartPunct = [...]string{
+	smartClose:       "’",
+	smartOpen:        "‘",
+	smartCloseDouble: "”",
+	smartOpenDouble:  "“",
+	smartDash:        "—",
+	smartEllipsis:    "…",
+}
+
+// isOpeningContext checks if a quote at s[i] is an opening one.
+func isOpeningContext(s []byte, i int) bool {
+	if i == 0 {
+		return true
+	}
+
+	switch c := s[i-1]; c {
+	case ' ', '\t', '\n', '\r', '(', '[', '{', '-':
+		return true
+	default:
+		if c < utf8.RuneSelf {
+			return false
+		}
+	}
+
+	// the preceding rune is an opening quote, a dash, or a space
+	r, _ := utf8.DecodeLastRune(s[:i])
+
+	switch r {
+	case '‘', '“', '—', '–', ' ':
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,87 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPunctuation(t *testing.T) {
+	cases := []struct {
+		src, smart string
+	}{
+		{`"Hello," she said.`, `“Hello,” she said.`},
+		{`It's the '90s -- or "so" they say...`, `It’s the ‘90s — or “so” they say…`},
+		{`("quoted") '"nested"'`, `(“quoted”) ‘“nested”’`},
+		{"plain text", "plain text"},
+		{"", ""},
+	}
+
+	for i, c := range cases {
+		res := SmartPunctuation().Do([]byte(c.src))
+
+		if !bytes.Equal(res, []byte(c.smart)) {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.smart)
+			return
+		}
+
+		if res = ASCIIPunctuation().Do(res); !bytes.Equal(res, []byte(c.src)) {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.src)
+			return
+		}
+	}
+
+	const src, exp = "«Bonjour» – „Hallo“ ‚ja‘ 5−3 ― end…", `"Bonjour" - "Hallo" 'ja' 5-3 -- end...`
+
+	if res := ASCIIPunctuation().Do([]byte(src)); !bytes.Equal(res, []byte(exp)) {
+		t.Errorf("Unexpected result: %q instead of %q", string(res), exp)
+		return
+	}
+}
+
+func TestDehyphenate(t *testing.T) {
+	cases := []struct {
+		src, exp string
+	}{
+		{"", ""},
+		{"exam-\nple", "example"},
+		{"an exam- \r\n   ple here", "an example here"},
+		{"Jean-\nPaul, well-known, 1-\nx, x-\n\ny, end-", "Jean-\nPaul, well-known, 1-\nx, x-\n\ny, end-"},
+		{"soft\u00adhyphen, hyphen\u00ad\n  ation, last\u00ad\n\nnext\u00ad", "softhyphen, hyphenation, last\n\nnext"},
+		{"при-\nмер", "пример"},
+	}
+
+	for i, c := range cases {
+		if res := Dehyphenate().Do([]byte(c.src)); !bytes.Equal(res, []byte(c.exp)) {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+	}
+}
@@ -0,0 +1,199 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import "bytes"
+
+// SQLLiterals creates a Matcher for string and numeric literals in SQL query text. A unary sign
+// is included in the numeric literal, so that, for example, "a = -5" and "a = 5" are matched alike.
+// String literals are enclosed in single quotes, with both doubled quotes and backslash
+// escapes recognised; text in double quotes or backticks is treated as quoted identifiers
+// and left unmatched.
+func SQLLiterals() Matcher {
+	return queryLiterals('\'', "\"`", true)
+}
+
+// GraphQLLiterals creates a Matcher for string (including block string) and numeric literals
+// in GraphQL query text. As in SQLLiterals(), a unary sign is included in the numeric literal.
+func GraphQLLiterals() Matcher {
+	return queryLiterals('"', "", false)
+}
+
+// ScrubSQL creates a Rewriter that replaces all string and numeric literals in SQL query text
+// with "?" placeholders, producing a normalised query fingerprint.
+func ScrubSQL() Rewriter {
+	return Replace(SQLLiterals(), "?")
+}
+
+// ScrubGraphQL creates a Rewriter that replaces all string and numeric literals in GraphQL
+// query text with "?" placeholders, producing a normalised query fingerprint.
+func ScrubGraphQL() Rewriter {
+	return Replace(GraphQLLiterals(), "?")
+}
+
+func queryLiterals(quote byte, idents string, doubling bool) Matcher {
+	return func(s []byte) (ms [][]int) {
+		for i := 0; i < len(s); {
+			switch c := s[i]; {
+			case c == quote:
+				j := skipString(s, i, doubling)
+				ms = append(ms, []int{i, j})
+				i = j
+
+			case isQuote(c, idents):
+				i = skipQuoted(s, i)
+
+			case isDigit(c):
+				j := skipNumber(s, i)
+
+				if j < len(s) && isIdent(s[j]) { // not a number, e.g. 1st
+					j = skipIdent(s, j)
+				} else {
+					ms = append(ms, []int{signStart(s, i), j})
+				}
+
+				i = j
+
+			case isIdent(c):
+				i = skipIdent(s, i)
+
+			default:
+				i++
+			}
+		}
+
+		return
+	}
+}
+
+// skipString returns the index of the first byte after the string literal starting at s[i].
+func skipString(s []byte, i int, doubling bool) int {
+	q := s[i]
+
+	if !doubling && bytes.HasPrefix(s[i:], []byte{q, q, q}) { // block string
+		if j := bytes.Index(s[i+3:], []byte{q, q, q}); j >= 0 {
+			return i + j + 6
+		}
+
+		return len(s)
+	}
+
+	j := skipQuoted(s, i)
+
+	for doubling && j < len(s) && s[j] == q {
+		j = skipQuoted(s, j)
+	}
+
+	return j
+}
+
+// signStart returns the index of the unary sign of the number starting at s[i], or i if there
+// is none. A sign is unary if it follows (possibly after spaces) an operator, an opening parenthesis
+// or bracket, a comma, or a colon (as in GraphQL arguments); "--" starts an SQL comment instead.
+func signStart(s []byte, i int) int {
+	if i == 0 || (s[i-1] != '-' && s[i-1] != '+') {
+		return i
+	}
+
+	k := i - 2
+
+	for k >= 0 && (s[k] == ' ' || s[k] == '\t' || s[k] == '\n' || s[k] == '\r') {
+		k--
+	}
+
+	if k < 0 || (k == i-2 && s[k] == '-' && s[i-1] == '-') {
+		return i
+	}
+
+	if bytes.IndexByte([]byte("=<>!+-*/%^&|~([,:"), s[k]) >= 0 {
+		return i - 1
+	}
+
+	return i
+}
+
+// skipNumber returns the index of the first byte after the numeric literal starting at s[i].
+func skipNumber(s []byte, i int) int {
+	if i+1 < len(s) && s[i] == '0' && (s[i+1] == 'x' || s[i+1] == 'X') {
+		for i += 2; i < len(s) && isHexDigit(s[i]); i++ {
+		}
+
+		return i
+	}
+
+	i = skipDigits(s, i)
+
+	if i+1 < len(s) && s[i] == '.' && isDigit(s[i+1]) {
+		i = skipDigits(s, i+1)
+	}
+
+	if i+1 < len(s) && (s[i] == 'e' || s[i] == 'E') {
+		j := i + 1
+
+		if j+1 < len(s) && (s[j] == '+' || s[j] == '-') {
+			j++
+		}
+
+		if j < len(s) && isDigit(s[j]) {
+			i = skipDigits(s, j)
+		}
+	}
+
+	return i
+}
+
+func skipDigits(s []byte, i int) int {
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+
+	return i
+}
+
+func skipIdent(s []byte, i int) int {
+	for i < len(s) && isIdent(s[i]) {
+		i++
+	}
+
+	return i
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isHexDigit(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// isIdent checks if the given byte may be a part of an identifier; all non-ASCII bytes
+// are assumed to be parts of identifiers.
+func isIdent(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_' || c == '$' || c >= 0x80
+}
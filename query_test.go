@@ -0,0 +1,78 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestScrubSQL(t *testing.T) {
+	cases := []struct {
+		src, exp string
+	}{
+		{"SELECT * FROM t", "SELECT * FROM t"},
+		{"SELECT * FROM t1 WHERE id = 42", "SELECT * FROM t1 WHERE id = ?"},
+		{"SELECT a FROM t WHERE x > 1.5e-3 AND y < 0x1F", "SELECT a FROM t WHERE x > ? AND y < ?"},
+		{"SELECT a FROM t WHERE name = 'O''Brien' AND c = 'a\\'b'", "SELECT a FROM t WHERE name = ? AND c = ?"},
+		{`SELECT "col 1", ` + "`t2`.c3" + ` FROM "t 2"`, `SELECT "col 1", ` + "`t2`.c3" + ` FROM "t 2"`},
+		{"INSERT INTO t(a, b) VALUES (1, 'x'), (2, 'y')", "INSERT INTO t(a, b) VALUES (?, ?), (?, ?)"},
+		{"SELECT $1, col_2 FROM t LIMIT 10", "SELECT $1, col_2 FROM t LIMIT ?"},
+		{"SELECT 'unterminated", "SELECT ?"},
+		{"SELECT a FROM t WHERE a = -5 AND b IN (-1, +2,-3)", "SELECT a FROM t WHERE a = ? AND b IN (?, ?,?)"},
+		{"SELECT a - 5, a-5, (a)-5, 'x'-5 FROM t", "SELECT a - ?, a-?, (a)-?, ?-? FROM t"},
+		{"SELECT a FROM t WHERE a >= -5 OR a = 1--5", "SELECT a FROM t WHERE a >= ? OR a = ?--?"},
+	}
+
+	for i, c := range cases {
+		if res := ScrubSQL().Do([]byte(c.src)); !bytes.Equal(res, []byte(c.exp)) {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+	}
+}
+
+func TestScrubGraphQL(t *testing.T) {
+	cases := []struct {
+		src, exp string
+	}{
+		{`{ user(id: 42) { name } }`, `{ user(id: ?) { name } }`},
+		{`{ user(name: "a \"b\" c", v2: -1.5) { f1 } }`, `{ user(name: ?, v2: ?) { f1 } }`},
+		{`mutation { add(text: """multi "line" text""") }`, `mutation { add(text: ?) }`},
+		{`query Q($id: ID = "x") { node(id: $id) }`, `query Q($id: ID = ?) { node(id: $id) }`},
+		{`{ f(a: [-1, -2.5], b: -3) }`, `{ f(a: [?, ?], b: ?) }`},
+	}
+
+	for i, c := range cases {
+		if res := ScrubGraphQL().Do([]byte(c.src)); !bytes.Equal(res, []byte(c.exp)) {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+	}
+}
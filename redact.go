@@ -0,0 +1,181 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"bytes"
+	"net/url"
+	"unicode/utf8"
+)
+
+// Params creates a Matcher for the values of the named query parameters in URLs and
+// the named cookies in Cookie and Set-Cookie headers found anywhere in the text.
+// Parameter names are compared after percent-decoding, and the values are matched
+// in their original (encoded) form, up to the first unescaped delimiter.
+func Params(names ...string) Matcher {
+	if len(names) == 0 {
+		panic("empty parameter list in trw.Params() function")
+	}
+
+	set := make(map[string]bool, len(names))
+
+	for _, name := range names {
+		if len(name) == 0 {
+			panic("empty parameter name in trw.Params() function")
+		}
+
+		set[name] = true
+	}
+
+	return func(s []byte) (ms [][]int) {
+		for i := 0; i < len(s); i++ {
+			switch s[i] {
+			case '?', '&', ';':
+				// ok
+			case ':':
+				if i < 6 || !bytes.EqualFold(s[i-6:i], []byte("cookie")) {
+					continue
+				}
+			default:
+				continue
+			}
+
+			if m := param(s, i+1, s[i] == ';' || s[i] == ':', set); m != nil {
+				ms = append(ms, m)
+				i = m[1] - 1
+			}
+		}
+
+		return
+	}
+}
+
+// RedactParams creates a Rewriter that replaces the values of the named query parameters
+// and cookies with the given mask string.
+func RedactParams(mask string, names ...string) Rewriter {
+	return Replace(Params(names...), mask)
+}
+
+// Mask creates a Rewriter that replaces every character of the text, except the last keep ones,
+// with the given mask character, as in Mask('*', 4) turning "4111111111111111" into
+// "************1111". It is mostly useful as the inner Rewriter of the rewriters applied to
+// parts of the text, like RewriteLogfmtValue(). A multi-byte UTF-8 character is replaced with
+// a single mask character.
+func Mask(mask byte, keep int) Rewriter {
+	if !isMaskChar(mask) || keep < 0 {
+		panic("invalid argument in trw.Mask() function")
+	}
+
+	return func(dest, src []byte) ([]byte, []byte) {
+		// length of the masked prefix
+		end := len(src)
+
+		for k := 0; k < keep && end > 0; k++ {
+			_, n := utf8.DecodeLastRune(src[:end])
+			end -= n
+		}
+
+		// masking in-place, as every mask character is not longer than the character it replaces
+		j := 0
+
+		for i := 0; i < end; j++ {
+			_, n := utf8.DecodeRune(src[i:end])
+			src[j] = mask
+			i += n
+		}
+
+		if j < end {
+			j += copy(src[j:], src[end:])
+			return src[:j], dest
+		}
+
+		return src, dest
+	}
+}
+
+// param returns the location of the value of the key=value pair starting at s[i],
+// if the key is in the given set.
+func param(s []byte, i int, skipSpace bool, set map[string]bool) []int {
+	for skipSpace && i < len(s) && s[i] == ' ' {
+		i++
+	}
+
+	// key
+	k := i
+
+	for k < len(s) && s[k] != '=' {
+		if isParamDelim(s[k]) || s[k] == '?' {
+			return nil
+		}
+
+		k++
+	}
+
+	if k == i || k == len(s) || !set[unescapeParam(s[i:k])] {
+		return nil
+	}
+
+	// value
+	j := k + 1
+
+	if j < len(s) && s[j] == '"' {
+		if e := bytes.IndexByte(s[j+1:], '"'); e >= 0 {
+			return []int{j, j + e + 2}
+		}
+	}
+
+	for j < len(s) && !isParamDelim(s[j]) {
+		j++
+	}
+
+	if j == k+1 {
+		return nil
+	}
+
+	return []int{k + 1, j}
+}
+
+func isParamDelim(c byte) bool {
+	switch c {
+	case '&', ';', '#', '"', '\'', '<', '>', ' ', '\t', '\r', '\n':
+		return true
+	default:
+		return false
+	}
+}
+
+func unescapeParam(key []byte) string {
+	s := string(key)
+
+	if r, err := url.QueryUnescape(s); err == nil {
+		return r
+	}
+
+	return s
+}
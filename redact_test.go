@@ -0,0 +1,81 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRedactParams(t *testing.T) {
+	cases := []struct {
+		src, exp string
+	}{
+		{"GET /a?x=1", "GET /a?x=1"},
+		{"GET /a?token=abc&x=1", "GET /a?token=***&x=1"},
+		{"GET /a?x=1&token=abc HTTP/1.1", "GET /a?x=1&token=*** HTTP/1.1"},
+		{"GET /a?x=1&to%6Ben=a%26b#frag", "GET /a?x=1&to%6Ben=***#frag"},
+		{`<a href="/a?token=abc">`, `<a href="/a?token=***">`},
+		{"/a?k=a==&token=", "/a?k=a==&token="},
+		{"really? token=abc", "really? token=abc"},
+		{"Cookie: sid=123; theme=dark", "Cookie: sid=***; theme=dark"},
+		{"cookie: theme=dark; sid=\"123\"\r\n", "cookie: theme=dark; sid=***\r\n"},
+		{"Set-Cookie: sid=123; Path=/; HttpOnly", "Set-Cookie: sid=***; Path=/; HttpOnly"},
+		{"/x?sid=1 /y?token=2", "/x?sid=*** /y?token=***"},
+	}
+
+	for i, c := range cases {
+		if res := RedactParams("***", "token", "sid").Do([]byte(c.src)); !bytes.Equal(res, []byte(c.exp)) {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+	}
+}
+
+func TestMask(t *testing.T) {
+	cases := []struct {
+		src, exp string
+		keep     int
+	}{
+		{"", "", 0},
+		{"", "", 4},
+		{"abc", "***", 0},
+		{"abc", "abc", 4},
+		{"4111111111111111", "************1111", 4},
+		{"пароль", "****ль", 2},
+		{"ab€€", "***€", 1},
+	}
+
+	for i, c := range cases {
+		if res := Mask('*', c.keep).Do([]byte(c.src)); !bytes.Equal(res, []byte(c.exp)) {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+	}
+}
@@ -0,0 +1,81 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"io"
+	"strings"
+)
+
+// Replacer is the set of methods of strings.Replacer. Both *strings.Replacer and the value
+// returned from Rewriter.Replacer() implement this interface, allowing for existing code
+// to be migrated between the two incrementally.
+type Replacer interface {
+	Replace(s string) string
+	WriteString(w io.Writer, s string) (n int, err error)
+}
+
+// FromReplacer creates a Rewriter that applies the given strings.Replacer to the text.
+func FromReplacer(r *strings.Replacer) Rewriter {
+	if r == nil {
+		panic("nil replacer in trw.FromReplacer() function")
+	}
+
+	return func(dest, src []byte) ([]byte, []byte) {
+		w := appender(dest[:0])
+
+		r.WriteString(&w, string(src)) // never fails
+		return w, src
+	}
+}
+
+// Replacer returns an adaptor implementing the methods of strings.Replacer via the Rewriter.
+func (rw Rewriter) Replacer() Replacer {
+	return rwReplacer{rw}
+}
+
+type rwReplacer struct {
+	rw Rewriter
+}
+
+func (r rwReplacer) Replace(s string) string {
+	return string(r.rw.Do([]byte(s)))
+}
+
+func (r rwReplacer) WriteString(w io.Writer, s string) (int, error) {
+	return w.Write(r.rw.Do([]byte(s)))
+}
+
+// appender is an io.Writer appending to the byte slice.
+type appender []byte
+
+func (w *appender) Write(s []byte) (int, error) {
+	*w = append(*w, s...)
+	return len(s), nil
+}
@@ -0,0 +1,69 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestFromReplacer(t *testing.T) {
+	rw := Seq(
+		FromReplacer(strings.NewReplacer("a", "1", "b", "2")),
+		Replace(Lit("12"), "X"),
+		FromReplacer(strings.NewReplacer("X", "<x>")),
+	)
+
+	if res := rw.Do([]byte("ab ba abc")); string(res) != "<x> 21 <x>c" {
+		t.Errorf("Unexpected result: %q", string(res))
+		return
+	}
+}
+
+func TestRewriterReplacer(t *testing.T) {
+	replacers := []Replacer{
+		strings.NewReplacer("a", "1", "b", "2"),
+		ReplacePairs("a", "1", "b", "2").Replacer(),
+	}
+
+	for i, r := range replacers {
+		if s := r.Replace("abc"); s != "12c" {
+			t.Errorf("[%d] Unexpected result: %q", i, s)
+			return
+		}
+
+		var buff bytes.Buffer
+
+		if n, err := r.WriteString(&buff, "cba"); err != nil || n != 3 || buff.String() != "c21" {
+			t.Errorf("[%d] Unexpected result: %q, %d, %v", i, buff.String(), n, err)
+			return
+		}
+	}
+}
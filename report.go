@@ -0,0 +1,251 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"sync"
+)
+
+// Severity is the severity level of the findings from a detector.
+type Severity int
+
+// Severity levels.
+const (
+	SeverityInfo Severity = iota
+	SeverityLow
+	SeverityMedium
+	SeverityHigh
+	SeverityCritical
+)
+
+var severityNames = [...]string{
+	SeverityInfo:     "info",
+	SeverityLow:      "low",
+	SeverityMedium:   "medium",
+	SeverityHigh:     "high",
+	SeverityCritical: "critical",
+}
+
+// String returns the name of the severity level, like "high".
+func (s Severity) String() string {
+	if s >= 0 && int(s) < len(severityNames) {
+		return severityNames[s]
+	}
+
+	return "Severity(" + strconv.Itoa(int(s)) + ")"
+}
+
+// MarshalText implements encoding.TextMarshaler interface.
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler interface.
+func (s *Severity) UnmarshalText(text []byte) error {
+	for i, name := range severityNames {
+		if string(text) == name {
+			*s = Severity(i)
+			return nil
+		}
+	}
+
+	return errors.New("invalid severity level " + strconv.Quote(string(text)))
+}
+
+// Finding is a single piece of sensitive data found by a Policy. The original text is not
+// included, so the finding can be safely stored or sent elsewhere.
+type Finding struct {
+	Detector string   `json:"detector"` // detector name (or "#index")
+	Severity Severity `json:"severity"` // detector severity
+	Action   Action   `json:"action"`   // action taken
+	Offset   int      `json:"offset"`   // byte offset of the rewritten text in the input
+	Length   int      `json:"length"`   // length of the rewritten text, in bytes
+	Line     int      `json:"line"`     // line number in the input, starting from 1
+}
+
+// Report is the list of findings from one invocation of a Policy Rewriter. Its JSON encoding
+// is a machine-readable summary suitable for alerting.
+type Report struct {
+	Findings    []Finding      `json:"findings"`     // all findings, ordered by offset
+	Counts      map[string]int `json:"counts"`       // number of findings per detector
+	MaxSeverity Severity       `json:"max_severity"` // the highest severity among the findings
+	Rejected    bool           `json:"rejected"`     // true if the input has been rejected
+}
+
+// Audit creates a Rewriter that applies the policy, as in Compile(), and then invokes the given
+// function with the report of the findings; for rejected input, the report only contains
+// the findings from the ActionReject detectors. The function is invoked on every call to the Rewriter,
+// even if nothing was found.
+func (p *Policy) Audit(fn func(*Report)) Rewriter {
+	if fn == nil {
+		panic("nil report function in trw.Policy.Audit() method")
+	}
+
+	c := p.compile("Audit")
+
+	return func(dest, src []byte) ([]byte, []byte) {
+		ms, rejected := c.find(src)
+
+		// the report must be built before the source is rewritten
+		r := c.report(src, ms, rejected)
+
+		if rejected {
+			dest = dest[:0]
+		} else {
+			dest, src = c.rewrite(dest, src, ms)
+		}
+
+		fn(r)
+		return dest, src
+	}
+}
+
+// FindingSink is the interface for receiving findings from a Policy as soon as they are detected,
+// for example, to forward them to a SIEM.
+type FindingSink interface {
+	Emit(f Finding)
+}
+
+// AuditTo creates a Rewriter that applies the policy, as in Compile(), sending all the findings
+// to the given sink. The Rewriter treats its successive inputs as parts of one stream, so that
+// the offsets and the line numbers in the findings are counted from the beginning of the first
+// input; this is what is needed when the Rewriter is used in a streaming setup, where each
+// input is a chunk of the stream. The Rewriter is safe for concurrent use, although the positions
+// are only meaningful when the inputs are supplied in order. For rejected input, only the findings
+// from the ActionReject detectors are emitted.
+func (p *Policy) AuditTo(sink FindingSink) Rewriter {
+	if sink == nil {
+		panic("nil sink in trw.Policy.AuditTo() method")
+	}
+
+	c := p.compile("AuditTo")
+
+	var mu sync.Mutex
+	var offset, lines int // the position of the current input in the stream
+
+	return func(dest, src []byte) ([]byte, []byte) {
+		ms, rejected := c.find(src)
+		r := c.report(src, ms, rejected)
+		n := bytes.Count(src, []byte{'\n'})
+
+		mu.Lock()
+
+		for _, f := range r.Findings {
+			f.Offset += offset
+			f.Line += lines
+			sink.Emit(f)
+		}
+
+		offset += len(src)
+		lines += n
+
+		mu.Unlock()
+
+		if rejected {
+			return dest[:0], src
+		}
+
+		return c.rewrite(dest, src, ms)
+	}
+}
+
+// JSONLines is a FindingSink that writes each finding to the underlying io.Writer as a JSON
+// object on a separate line. After the first write error, all further findings are discarded.
+// JSONLines is safe for concurrent use.
+type JSONLines struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+// NewJSONLines creates a new JSONLines sink writing to the given io.Writer.
+func NewJSONLines(w io.Writer) *JSONLines {
+	if w == nil {
+		panic("nil writer in trw.NewJSONLines() function")
+	}
+
+	return &JSONLines{enc: json.NewEncoder(w)}
+}
+
+// Emit implements FindingSink interface.
+func (s *JSONLines) Emit(f Finding) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err == nil {
+		s.err = s.enc.Encode(&f)
+	}
+}
+
+// Err returns the first write error, if any.
+func (s *JSONLines) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.err
+}
+
+// report builds the report from the given matches.
+func (c *compiledPolicy) report(src []byte, ms []policyMatch, rejected bool) *Report {
+	r := &Report{
+		Findings: make([]Finding, 0, len(ms)),
+		Counts:   make(map[string]int),
+		Rejected: rejected,
+	}
+
+	line, pos := 1, 0
+
+	for _, m := range ms {
+		d := &c.detectors[m.det]
+		line += bytes.Count(src[pos:m.start], []byte{'\n'})
+		pos = m.start
+
+		r.Findings = append(r.Findings, Finding{
+			Detector: c.labels[m.det],
+			Severity: d.Severity,
+			Action:   d.Action,
+			Offset:   m.start,
+			Length:   m.end - m.start,
+			Line:     line,
+		})
+
+		r.Counts[c.labels[m.det]]++
+
+		if d.Severity > r.MaxSeverity {
+			r.MaxSeverity = d.Severity
+		}
+	}
+
+	return r
+}
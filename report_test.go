@@ -0,0 +1,179 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestAudit(t *testing.T) {
+	p := Policy{
+		Detectors: []Detector{
+			{Name: "card", Match: Cards(), Severity: SeverityCritical},
+			{Name: "ip", Match: IPs(), Severity: SeverityLow},
+			{Name: "password", Match: Params("password"), Action: ActionDropLine, Severity: SeverityHigh},
+		},
+	}
+
+	var reports []*Report
+
+	rw := p.Audit(func(r *Report) { reports = append(reports, r) })
+
+	const src = "from 10.0.0.1\nGET /?password=x\ncard 4111111111111111 at 10.0.0.2\n"
+	const exp = "from [IP]\ncard [CARD] at [IP]\n"
+
+	if res := rw.Do([]byte(src)); !bytes.Equal(res, []byte(exp)) {
+		t.Errorf("Unexpected result: %q instead of %q", string(res), exp)
+		return
+	}
+
+	if res := rw.Do([]byte("nothing here")); string(res) != "nothing here" {
+		t.Errorf("Unexpected result: %q", string(res))
+		return
+	}
+
+	if len(reports) != 2 {
+		t.Errorf("Unexpected number of reports: %d", len(reports))
+		return
+	}
+
+	data, err := json.Marshal(reports)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	const expJSON = `[{"findings":[` +
+		`{"detector":"ip","severity":"low","action":"mask","offset":5,"length":8,"line":1},` +
+		`{"detector":"password","severity":"high","action":"drop-line","offset":14,"length":17,"line":2},` +
+		`{"detector":"card","severity":"critical","action":"mask","offset":36,"length":16,"line":3},` +
+		`{"detector":"ip","severity":"low","action":"mask","offset":56,"length":8,"line":3}],` +
+		`"counts":{"card":1,"ip":2,"password":1},"max_severity":"critical","rejected":false},` +
+		`{"findings":[],"counts":{},"max_severity":"info","rejected":false}]`
+
+	if string(data) != expJSON {
+		t.Errorf("Unexpected JSON:\n%s\ninstead of\n%s", data, expJSON)
+		return
+	}
+
+	// severity decoding
+	var s Severity
+
+	if err = json.Unmarshal([]byte(`"medium"`), &s); err != nil || s != SeverityMedium {
+		t.Errorf("Unexpected severity: %v, %v", s, err)
+		return
+	}
+
+	if err = json.Unmarshal([]byte(`"urgent"`), &s); err == nil {
+		t.Error("Missing error")
+		return
+	}
+}
+
+func TestAuditTo(t *testing.T) {
+	p := Policy{
+		Detectors: []Detector{
+			{Name: "ip", Match: IPs(), Severity: SeverityLow},
+			{Name: "key", Match: Lit("PRIVATE KEY"), Action: ActionReject, Severity: SeverityCritical},
+		},
+	}
+
+	var buf bytes.Buffer
+
+	sink := NewJSONLines(&buf)
+	rw := p.AuditTo(sink)
+
+	// a stream of lines
+	lines := []string{"from 10.0.0.1\n", "nothing\n", "PRIVATE KEY\n", "to 10.0.0.2\n"}
+	exp := []string{"from [IP]\n", "nothing\n", "", "to [IP]\n"}
+
+	for i, line := range lines {
+		if res := rw.Do([]byte(line)); string(res) != exp[i] {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), exp[i])
+			return
+		}
+	}
+
+	if err := sink.Err(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	const expJSON = `{"detector":"ip","severity":"low","action":"mask","offset":5,"length":8,"line":1}
+{"detector":"key","severity":"critical","action":"reject","offset":22,"length":11,"line":3}
+{"detector":"ip","severity":"low","action":"mask","offset":37,"length":8,"line":4}
+`
+
+	if buf.String() != expJSON {
+		t.Errorf("Unexpected JSON:\n%s\ninstead of\n%s", buf.String(), expJSON)
+		return
+	}
+
+	// round trip
+	for i, line := range strings.SplitAfter(strings.TrimSuffix(expJSON, "\n"), "\n") {
+		var f Finding
+
+		if err := json.Unmarshal([]byte(line), &f); err != nil {
+			t.Errorf("[%d] %v", i, err)
+			return
+		}
+
+		if data, err := json.Marshal(&f); err != nil || string(data) != strings.TrimSuffix(line, "\n") {
+			t.Errorf("[%d] Unexpected JSON: %s, %v", i, data, err)
+			return
+		}
+	}
+
+	var a Action
+
+	if err := json.Unmarshal([]byte(`"erase"`), &a); err == nil {
+		t.Error("Missing error")
+		return
+	}
+
+	// write errors are sticky
+	sink = NewJSONLines(failingWriter{})
+	p.AuditTo(sink).Do([]byte("10.0.0.1 10.0.0.2"))
+
+	if sink.Err() == nil {
+		t.Error("Missing error")
+		return
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("write failed")
+}
@@ -0,0 +1,306 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BucketTimestamps creates a Rewriter that rounds down all timestamps matched by the given Matcher
+// to a multiple of the specified duration (for example, 5 minutes), using the given layout, as
+// in time.Parse(), for both parsing and formatting. The rounding is done on the wall clock time
+// at the timestamp's own location, so one-day buckets start at local midnight. Matches that
+// cannot be parsed are left intact.
+func BucketTimestamps(match Matcher, layout string, d time.Duration) Rewriter {
+	if match == nil {
+		panic("nil matcher in trw.BucketTimestamps() function")
+	}
+
+	if d <= 0 {
+		panic("non-positive duration in trw.BucketTimestamps() function")
+	}
+
+	return rewrite(match, func(dest, src []byte, m []int) []byte {
+		ts, err := time.Parse(layout, string(src[m[0]:m[1]]))
+
+		if err != nil {
+			return append(dest, src[m[0]:m[1]]...)
+		}
+
+		return truncateTime(ts, d).AppendFormat(dest, layout)
+	})
+}
+
+// Timestamps creates a Matcher for the timestamps in any of the given layouts, as in time.Parse().
+// At each position, the first layout in the argument list that parses the timestamp is chosen,
+// and in each match the index pair is followed by the index of the layout.
+func Timestamps(layouts ...string) Matcher {
+	return timestamps(layouts, "Timestamps")
+}
+
+// NormalizeTimestamps creates a Rewriter that reformats all the timestamps in any of the given
+// layouts using the output layout, for example, to convert a mix of RFC 1123 and Unix date
+// timestamps to RFC 3339. Timestamps in layouts without a year, like time.Stamp used by syslog,
+// are assumed to be from the current year at the time of the rewrite, and February 29 without
+// a year is left intact unless the current year is a leap year. As in time.Parse(),
+// a zone abbreviation unknown in the local time zone, like "PST" outside of the US Pacific time,
+// is parsed with zero offset, so such timestamps come out as UTC.
+func NormalizeTimestamps(layouts []string, outLayout string) Rewriter {
+	match := timestamps(layouts, "NormalizeTimestamps")
+
+	if len(outLayout) == 0 {
+		panic("empty output layout in trw.NormalizeTimestamps() function")
+	}
+
+	yearless := make([]bool, len(layouts))
+
+	for i, layout := range layouts {
+		yearless[i] = !hasYear(layout)
+	}
+
+	layouts = append([]string(nil), layouts...)
+
+	return rewrite(match, func(dest, src []byte, m []int) []byte {
+		ts, _ := time.Parse(layouts[m[2]], string(src[m[0]:m[1]]))
+
+		if yearless[m[2]] {
+			var ok bool
+
+			if ts, ok = withYear(ts, time.Now().In(ts.Location()).Year()); !ok {
+				return append(dest, src[m[0]:m[1]]...)
+			}
+		}
+
+		return ts.AppendFormat(dest, outLayout)
+	})
+}
+
+// withYear returns the given time with the year replaced, or false if there is no such date
+// in that year (February 29 in a non-leap year).
+func withYear(ts time.Time, year int) (time.Time, bool) {
+	res := time.Date(year, ts.Month(), ts.Day(), ts.Hour(), ts.Minute(), ts.Second(), ts.Nanosecond(), ts.Location())
+
+	return res, res.Day() == ts.Day()
+}
+
+// hasYear checks if the given time layout includes the year.
+func hasYear(layout string) bool {
+	for len(layout) > 0 {
+		_, n := layoutChunk(layout)
+
+		if n == 0 {
+			n = 1
+		} else if chunk := layout[:n]; chunk == "2006" || chunk == "06" {
+			return true
+		}
+
+		layout = layout[n:]
+	}
+
+	return false
+}
+
+func timestamps(layouts []string, fn string) Matcher {
+	if len(layouts) == 0 {
+		panic("empty layout list in trw." + fn + "() function")
+	}
+
+	layouts = append([]string(nil), layouts...)
+	alts := make([]string, len(layouts))
+	anchored := make([]*regexp.Regexp, len(layouts)) // for trying the other layouts at a position
+
+	for i, layout := range layouts {
+		if len(layout) == 0 {
+			panic("empty layout in trw." + fn + "() function")
+		}
+
+		patt := layoutPatt(layout)
+		alts[i] = "(" + patt + ")"
+		anchored[i] = regexp.MustCompile("^(?:" + patt + ")")
+	}
+
+	re := regexp.MustCompile(strings.Join(alts, "|"))
+
+	// parse tries the layouts starting from the k-th one for the timestamp at s[i], where
+	// s[i:j] is the match for the k-th layout, and returns the end of the timestamp and its
+	// layout index, or -1 if no layout parses it.
+	parse := func(s []byte, i, j, k int) (int, int) {
+		for ; k < len(layouts); k++ {
+			if j < 0 {
+				loc := anchored[k].FindIndex(s[i:])
+
+				if loc == nil {
+					continue
+				}
+
+				j = i + loc[1]
+			}
+
+			// skip matches that are a part of a longer number
+			if j == len(s) || !isDigit(s[j-1]) || !isDigit(s[j]) {
+				if _, err := time.Parse(layouts[k], string(s[i:j])); err == nil {
+					return j, k
+				}
+			}
+
+			j = -1
+		}
+
+		return -1, -1
+	}
+
+	return func(s []byte) (ms [][]int) {
+		for pos := 0; pos < len(s); {
+			sm := re.FindSubmatchIndex(s[pos:])
+
+			if sm == nil {
+				break
+			}
+
+			i, j := pos+sm[0], pos+sm[1]
+			k := 0
+
+			for sm[2*k+2] < 0 {
+				k++
+			}
+
+			if i == 0 || !isDigit(s[i-1]) || !isDigit(s[i]) {
+				if j, k = parse(s, i, j, k); j >= 0 {
+					ms = append(ms, []int{i, j, k})
+					pos = j
+					continue
+				}
+			}
+
+			pos = i + 1
+		}
+
+		return
+	}
+}
+
+// layoutPatt converts the given time layout to a regular expression pattern, not necessarily
+// exact, but matching at least all the timestamps in the layout.
+func layoutPatt(layout string) string {
+	var b strings.Builder
+
+	for len(layout) > 0 {
+		patt, n := layoutChunk(layout)
+
+		if n == 0 {
+			patt, n = regexp.QuoteMeta(layout[:1]), 1
+		}
+
+		b.WriteString(patt)
+		layout = layout[n:]
+	}
+
+	return b.String()
+}
+
+// layout chunks, in the order they are tried (longer ones first), with their patterns
+var layoutChunks = [...][2]string{
+	{"January", `[A-Z][a-z]{2,8}`},
+	{"Jan", `[A-Z][a-z]{2}`},
+	{"Monday", `[A-Z][a-z]{5,8}`},
+	{"Mon", `[A-Z][a-z]{2}`},
+	{"MST", `(?:[A-Z]{3,5}|[+-]\d\d(?:\d\d)?)`},
+	{"2006", `\d{4}`},
+	{"002", `\d{3}`},
+	{"__2", `[ \d]{2}\d`},
+	{"_2", `[ \d]\d`},
+	{"01", `\d\d`},
+	{"02", `\d\d`},
+	{"03", `\d\d`},
+	{"04", `\d\d`},
+	{"05", `\d\d`},
+	{"06", `\d\d`},
+	{"15", `\d\d`},
+	{"1", `\d\d?`},
+	{"2", `\d\d?`},
+	{"3", `\d\d?`},
+	{"4", `\d\d?`},
+	{"5", `\d\d?`},
+	{"PM", `[AP]M`},
+	{"pm", `[ap]m`},
+	{"Z07:00:00", `(?:Z|[+-]\d\d:\d\d:\d\d)`},
+	{"Z070000", `(?:Z|[+-]\d{6})`},
+	{"Z07:00", `(?:Z|[+-]\d\d:\d\d)`},
+	{"Z0700", `(?:Z|[+-]\d{4})`},
+	{"Z07", `(?:Z|[+-]\d\d)`},
+	{"-07:00:00", `[+-]\d\d:\d\d:\d\d`},
+	{"-070000", `[+-]\d{6}`},
+	{"-07:00", `[+-]\d\d:\d\d`},
+	{"-0700", `[+-]\d{4}`},
+	{"-07", `[+-]\d\d`},
+}
+
+// layoutChunk returns the pattern for the layout chunk at the beginning of the given string,
+// and the length of the chunk, or 0 if there is no chunk.
+func layoutChunk(layout string) (string, int) {
+	// fractional seconds
+	if c := layout[0]; (c == '.' || c == ',') && len(layout) > 1 && (layout[1] == '0' || layout[1] == '9') {
+		n := 2
+
+		for n < len(layout) && layout[n] == layout[1] {
+			n++
+		}
+
+		if n == len(layout) || !isDigit(layout[n]) {
+			if layout[1] == '0' {
+				return `[.,]\d{` + strconv.Itoa(n-1) + `}`, n
+			}
+
+			return `(?:[.,]\d+)?`, n
+		}
+	}
+
+	for _, chunk := range layoutChunks {
+		if strings.HasPrefix(layout, chunk[0]) {
+			return chunk[1], len(chunk[0])
+		}
+	}
+
+	return "", 0
+}
+
+// truncateTime rounds the wall clock time of the given timestamp down to a multiple of d.
+func truncateTime(ts time.Time, d time.Duration) time.Time {
+	year, month, day := ts.Date()
+	hour, min, sec := ts.Clock()
+	wall := time.Date(year, month, day, hour, min, sec, ts.Nanosecond(), time.UTC).Truncate(d)
+
+	year, month, day = wall.Date()
+	hour, min, sec = wall.Clock()
+
+	return time.Date(year, month, day, hour, min, sec, wall.Nanosecond(), ts.Location())
+}
@@ -0,0 +1,172 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"bytes"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestBucketTimestamps(t *testing.T) {
+	rfc := Patt(`\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d(\.\d+)?(Z|[+-]\d\d:\d\d)`)
+
+	cases := []struct {
+		rw       Rewriter
+		src, exp string
+	}{
+		{
+			BucketTimestamps(rfc, time.RFC3339, 5*time.Minute),
+			"a 2024-03-01T10:07:59Z b 2024-03-01T10:10:00+02:00 c",
+			"a 2024-03-01T10:05:00Z b 2024-03-01T10:10:00+02:00 c",
+		},
+		{
+			BucketTimestamps(rfc, time.RFC3339Nano, time.Second),
+			"2024-03-01T10:07:59.999Z",
+			"2024-03-01T10:07:59Z",
+		},
+		{
+			BucketTimestamps(rfc, time.RFC3339, 24*time.Hour),
+			"2024-03-01T23:30:00-05:00",
+			"2024-03-01T00:00:00-05:00",
+		},
+		{
+			BucketTimestamps(Patt(`\d\d:\d\d:\d\d`), "15:04:05", time.Hour),
+			"[09:59:59] start, [10:00:01] end, [99:00:00] bad",
+			"[09:00:00] start, [10:00:00] end, [99:00:00] bad",
+		},
+	}
+
+	for i, c := range cases {
+		if res := c.rw.Do([]byte(c.src)); !bytes.Equal(res, []byte(c.exp)) {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+	}
+}
+
+func TestNormalizeTimestamps(t *testing.T) {
+	// zone abbreviations depend on the local time zone
+	defer func(loc *time.Location) { time.Local = loc }(time.Local)
+
+	time.Local = time.UTC
+
+	rw := NormalizeTimestamps([]string{time.RFC1123, time.RFC3339Nano, "02/01/2006 15:04", time.Stamp}, time.RFC3339)
+	year := time.Now().UTC().Year()
+	leapDay := "Feb 29 10:00:00 host"
+
+	if time.Date(year, 2, 29, 0, 0, 0, 0, time.UTC).Day() == 29 {
+		leapDay = strconv.Itoa(year) + "-02-29T10:00:00Z host"
+	}
+
+	cases := []struct {
+		src, exp string
+	}{
+		{"", ""},
+		{"no time here", "no time here"},
+		{"at Fri, 01 Mar 2024 10:07:59 UTC.", "at 2024-03-01T10:07:59Z."},
+		{"2024-03-01T10:07:59.123+02:00 x", "2024-03-01T10:07:59+02:00 x"},
+		{"2024-03-01T10:07:59Z", "2024-03-01T10:07:59Z"},
+		{"[01/03/2024 10:07] [31/02/2024 10:07]", "[2024-03-01T10:07:00Z] [31/02/2024 10:07]"},
+		{"101/03/2024 10:07", "101/03/2024 10:07"},
+		{"Mar  1 10:07:59 host", strconv.Itoa(year) + "-03-01T10:07:59Z host"},
+		{"Fri, 01 Mar 2024 10:07:59 PST", "2024-03-01T10:07:59Z"},
+		{"Feb 29 10:00:00 host", leapDay},
+	}
+
+	for i, c := range cases {
+		if res := rw.Do([]byte(c.src)); !bytes.Equal(res, []byte(c.exp)) {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+	}
+}
+
+func TestWithYear(t *testing.T) {
+	ts := time.Date(2024, 2, 29, 10, 7, 59, 5, time.UTC)
+
+	if res, ok := withYear(ts, 2028); !ok || !res.Equal(time.Date(2028, 2, 29, 10, 7, 59, 5, time.UTC)) {
+		t.Errorf("Unexpected result: %v, %v", res, ok)
+		return
+	}
+
+	if res, ok := withYear(ts, 2026); ok {
+		t.Errorf("Unexpected result: %v", res)
+		return
+	}
+}
+
+func TestHasYear(t *testing.T) {
+	cases := []struct {
+		layout string
+		exp    bool
+	}{
+		{time.RFC3339, true},
+		{"01/02/06", true},
+		{time.Stamp, false},
+		{time.Kitchen, false},
+		{"Jan _2 002", false},
+	}
+
+	for i, c := range cases {
+		if res := hasYear(c.layout); res != c.exp {
+			t.Errorf("[%d] Unexpected result: %v", i, res)
+			return
+		}
+	}
+}
+
+func TestTimestamps(t *testing.T) {
+	match := Timestamps("2006-01-02", "15:04:05.000", "3:04PM")
+	src := []byte("2024-03-01 10:07:59.123 9:30AM 2024-13-01 10:07:59")
+	exp := [][]int{{0, 10, 0}, {11, 23, 1}, {24, 30, 2}}
+
+	if ms := match(src); !reflect.DeepEqual(ms, exp) {
+		t.Errorf("Unexpected matches: %v instead of %v", ms, exp)
+		return
+	}
+
+	// fallback to the next layout matching at the same position
+	match = Timestamps("01/02/2006", "02/01/2006")
+	exp = [][]int{{1, 11, 1}, {12, 22, 0}}
+
+	if ms := match([]byte("[31/01/2024 01/31/2024 31/31/2024]")); !reflect.DeepEqual(ms, exp) {
+		t.Errorf("Unexpected matches: %v instead of %v", ms, exp)
+		return
+	}
+
+	const res = "2024-01-31"
+
+	if out := NormalizeTimestamps([]string{"01/02/2006", "02/01/2006"}, "2006-01-02").Do([]byte("31/01/2024")); string(out) != res {
+		t.Errorf("Unexpected result: %q instead of %q", string(out), res)
+		return
+	}
+}
@@ -36,6 +36,9 @@ package trw
 import (
 	"bytes"
 	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 )
 
 // Rewriter is an opaque type representing a text rewriting operation.
@@ -43,6 +46,38 @@ type Rewriter func([]byte, []byte) ([]byte, []byte)
 
 // fn(dest, src) -> (result, spare)
 
+// Interface is the method form of the Rewriter type, for rewriting operations implemented
+// in other packages that do not want to depend on the function type. Rewrite() takes
+// a destination and a source slice, and returns the result and a spare slice; it may modify
+// the source in-place, or write the result to the destination slice (reallocated if too
+// small), and then the source becomes the spare slice. A Rewriter implements the interface,
+// and FromInterface() converts any implementation back to a Rewriter.
+type Interface interface {
+	Rewrite(dest, src []byte) (result, spare []byte)
+}
+
+// Rewrite invokes the Rewriter, implementing Interface.
+func (rw Rewriter) Rewrite(dest, src []byte) ([]byte, []byte) {
+	return rw(dest, src)
+}
+
+// FromInterface converts the given Interface implementation to a Rewriter, for use in pipelines.
+func FromInterface(i Interface) Rewriter {
+	if i == nil {
+		panic("nil interface in trw.FromInterface() function")
+	}
+
+	if rw, ok := i.(Rewriter); ok {
+		if rw == nil {
+			panic("nil rewriter in trw.FromInterface() function")
+		}
+
+		return rw
+	}
+
+	return i.Rewrite
+}
+
 // Do applies the Rewriter to the specified byte slice. The returned result may be
 // either the source slice modified in-place, or a new slice.
 func (rw Rewriter) Do(src []byte) (result []byte) {
@@ -50,6 +85,56 @@ func (rw Rewriter) Do(src []byte) (result []byte) {
 	return
 }
 
+// DoCopy applies the Rewriter to the specified byte slice, guaranteeing that the slice is never
+// modified, and that the result never shares memory with it.
+func (rw Rewriter) DoCopy(src []byte) []byte {
+	return rw.Do(append([]byte(nil), src...))
+}
+
+// DoToBuffer applies the Rewriter to the specified byte slice, appending the result to the given
+// bytes.Buffer. The spare capacity of the buffer is used as the destination for the rewriting,
+// so in many cases no intermediate allocation is needed.
+func (rw Rewriter) DoToBuffer(dst *bytes.Buffer, src []byte) {
+	dst.Grow(len(src))
+
+	b := dst.Bytes()
+	result, _ := rw(b[len(b):], src)
+
+	dst.Write(result)
+}
+
+// DoToBuilder applies the Rewriter to the specified byte slice, appending the result to the given
+// strings.Builder.
+func (rw Rewriter) DoToBuilder(dst *strings.Builder, src []byte) {
+	result, _ := rw(nil, src)
+
+	dst.Write(result)
+}
+
+// AppendDo applies the Rewriter to the specified byte slice, appends the result to dst, and returns
+// the extended slice, in the manner of strconv.AppendInt(). The spare capacity of dst is used as
+// the destination for the rewriting, so a buffer reused across many calls eventually removes
+// the need for any allocation. The source slice may be modified, and it must not overlap dst.
+func (rw Rewriter) AppendDo(dst, src []byte) []byte {
+	n := len(dst)
+	result, _ := rw(dst[n:], src)
+
+	if len(result) > 0 && cap(dst)-n >= len(result) && &dst[:n+1][n] == &result[0] {
+		return dst[:n+len(result)] // already in place
+	}
+
+	return append(dst, result...)
+}
+
+// DoTo applies the Rewriter to the specified byte slice, writing the result to the caller-supplied
+// buffer dst, overwriting its content. The result is returned in dst's memory if its capacity
+// allows, or in a new slice otherwise, so a buffer taken from the caller's pool should be
+// replaced with the returned slice after the call. The source slice may be modified,
+// and it must not overlap dst.
+func (rw Rewriter) DoTo(dst, src []byte) []byte {
+	return rw.AppendDo(dst[:0], src)
+}
+
 // Seq is a sequential composition of Rewriters.
 func Seq(rewriters ...Rewriter) Rewriter {
 	switch len(rewriters) {
@@ -70,38 +155,80 @@ func Seq(rewriters ...Rewriter) Rewriter {
 	}
 }
 
-// Matcher is a type of a function that, given a byte slice, returns
-// a slice holding the index pairs identifying all successive matches,
-// or nil if there is no match.
-type Matcher = func([]byte) [][]int
+// SeqUntilChange is a sequential composition of Rewriters that stops at the first Rewriter that
+// changes the text, so that at most one of them takes effect. This is useful for applying
+// whichever of the alternative normalisations fits the text.
+func SeqUntilChange(rewriters ...Rewriter) Rewriter {
+	if len(rewriters) == 0 {
+		panic("empty Rewriter list in trw.SeqUntilChange() function")
+	}
 
-// Delete creates a Rewriter that removes all the matches produced by the given Matcher.
-func Delete(match Matcher) Rewriter {
-	return func(unused, src []byte) ([]byte, []byte) {
-		ms := match(src)
+	return func(dest, src []byte) ([]byte, []byte) {
+		// the rewriters may modify the source in-place
+		orig := append([]byte(nil), src...)
 
-		if len(ms) == 0 {
-			return src, unused
-		}
+		for _, fn := range rewriters {
+			res, spare := fn(dest[:0], src)
 
-		// in-place copy, no need to allocate a new slice
-		i, j := ms[0][0], ms[0][1]
+			if !bytes.Equal(res, orig) {
+				return res, spare
+			}
 
-		for _, m := range ms[1:] {
-			i += copy(src[i:], src[j:m[0]])
-			j = m[1]
+			src, dest = res, spare
 		}
 
-		if j < len(src) {
-			i += copy(src[i:], src[j:])
+		return src, dest
+	}
+}
+
+// OnlyIf creates a Rewriter that applies the given Rewriter only if the sentinel Matcher finds
+// at least one match in the text, skipping the (possibly expensive) rewriting otherwise.
+// A sentinel that stops at the first match, like LitN("<", 1), is the cheapest.
+func OnlyIf(sentinel Matcher, rw Rewriter) Rewriter {
+	if sentinel == nil {
+		panic("nil sentinel in trw.OnlyIf() function")
+	}
+
+	if rw == nil {
+		panic("nil rewriter in trw.OnlyIf() function")
+	}
+
+	return func(dest, src []byte) ([]byte, []byte) {
+		if len(sentinel(src)) == 0 {
+			return src, dest
 		}
 
-		return src[:i], unused
+		return rw(dest, src)
+	}
+}
+
+// Matcher is a type of a function that, given a byte slice, returns
+// a slice holding the index pairs identifying all successive matches,
+// or nil if there is no match.
+//
+// Zero-length matches (like those of the regular expression "a*") are treated as insertion
+// points, with the same semantics as in regexp.Regexp.ReplaceAll(): Replace() and Expand()
+// insert the substitution at every empty match, and Delete() ignores them. Matchers built on
+// regular expressions follow the regexp package rules, where an empty match abutting
+// the preceding match is ignored, and the search resumes at the next rune after an empty match.
+//
+// Custom matchers that may return unsorted or overlapping matches should be created
+// with NewMatcher(), which documents the full contract.
+type Matcher = func([]byte) [][]int
+
+// Delete creates a Rewriter that removes all the matches produced by the given Matcher.
+// The Matcher produces the whole list of matches at once; see DeleteLazy() for finding
+// the matches one at a time, so that the memory required does not depend on their number.
+// The literal and pattern stages of a Pipeline find their matches in that way.
+func Delete(match Matcher) Rewriter {
+	return func(unused, src []byte) ([]byte, []byte) {
+		return deleteAll(src, &matches{ms: match(src)}), unused
 	}
 }
 
 // Replace creates a rewriter that substitutes all the matches produced by the given Matcher
-// with the specified string.
+// with the specified string. As with Delete(), the Matcher produces the whole list of matches
+// at once; see ReplaceLazy() for finding the matches one at a time.
 func Replace(match Matcher, subst string) Rewriter {
 	if len(subst) == 0 {
 		return Delete(match)
@@ -121,47 +248,56 @@ func Replace(match Matcher, subst string) Rewriter {
 			overlap = overlap || n < len(subst)
 		}
 
-		// quit if no matches found
-		if size == 0 {
+		// quit if no matches found (empty matches are insertion points)
+		if len(ms) == 0 {
 			return src, dest
 		}
 
-		if overlap {
-			// reallocate destination slice if necessary
-			if size = len(src) - size + len(ms)*len(subst); size > cap(dest) {
-				dest = make([]byte, 0, size+size/5) // +20%
-			}
-
-			// copy with replacement
-			i := 0
-
-			for _, m := range ms {
-				dest = append(append(dest, src[i:m[0]]...), []byte(subst)...)
-				i = m[1]
-			}
-
-			return append(dest, src[i:]...), src
+		if !overlap {
+			return replaceAll(dest, src, subst, &matches{ms: ms}, 0)
 		}
 
-		// in-place copy with replacement
-		i, j := ms[0][0], ms[0][1]
+		return replaceAll(dest, src, subst, &matches{ms: ms}, len(src)-size+len(ms)*len(subst))
+	}
+}
 
-		i += copy(src[i:], subst)
+// DeleteRe creates a Rewriter that removes all the matches of the given regular expression object.
+func DeleteRe(re *regexp.Regexp) Rewriter {
+	return Delete(Re(re))
+}
 
-		for _, m := range ms[1:] {
-			i += copy(src[i:], src[j:m[0]])
-			i += copy(src[i:], subst)
-			j = m[1]
-		}
+// DeleteFirst creates a Rewriter that removes the first non-empty match produced by the given Matcher.
+func DeleteFirst(match Matcher) Rewriter {
+	return Delete(firstMatch(match, true))
+}
+
+// ReplaceFirst creates a Rewriter that substitutes the first match produced by the given Matcher
+// with the specified string.
+func ReplaceFirst(match Matcher, subst string) Rewriter {
+	return Replace(firstMatch(match, len(subst) == 0), subst)
+}
 
-		if j < len(src) {
-			i += copy(src[i:], src[j:])
+// firstMatch creates a Matcher that returns the first match from the given Matcher, optionally
+// skipping empty matches.
+func firstMatch(match Matcher, skipEmpty bool) Matcher {
+	return func(s []byte) [][]int {
+		for _, m := range match(s) {
+			if !skipEmpty || m[0] < m[1] {
+				return [][]int{m}
+			}
 		}
 
-		return src[:i], dest
+		return nil
 	}
 }
 
+// ReplaceRe creates a Rewriter that substitutes all the matches of the given regular expression object
+// with the specified replacement, which is used literally, as in Regexp.ReplaceAllLiteral().
+// For the replacements with the template expansion see ExpandRe().
+func ReplaceRe(re *regexp.Regexp, repl []byte) Rewriter {
+	return Replace(Re(re), string(repl))
+}
+
 // Expand creates a Rewriter that applies Regexp.Expand() operation to every match
 // of the given regular expression pattern.
 func Expand(patt, subst string) Rewriter {
@@ -195,28 +331,284 @@ func ExpandReN(re *regexp.Regexp, subst string, n int) Rewriter {
 		return Delete(ReN(re, n))
 	}
 
-	return func(dest, src []byte) ([]byte, []byte) {
-		ms := re.FindAllSubmatchIndex(src, n)
+	return expandRe(re, subst, func(s []byte) [][]int {
+		return re.FindAllSubmatchIndex(s, n)
+	})
+}
 
-		if len(ms) == 0 { // avoid copying without a match
-			return src, dest
+// expandRe creates a Rewriter that applies Regexp.Expand() operation to every match from the given
+// Matcher, which must produce the submatch indices of the regular expression.
+func expandRe(re *regexp.Regexp, subst string, match Matcher) Rewriter {
+	templ := []byte(subst)
+
+	return rewrite(match, func(dest, src []byte, m []int) []byte {
+		return re.Expand(dest, templ, src, m)
+	})
+}
+
+// ExpandWith creates a Rewriter that substitutes every match of the given regular expression pattern
+// with the value from the given map, keyed by the text of the first capture group in the pattern
+// (or of the whole match, if there is no group). Matches with no corresponding key are left intact.
+func ExpandWith(patt string, data map[string]string) Rewriter {
+	return ExpandWithFunc(patt, func(name string) (value string, ok bool) {
+		value, ok = data[name]
+		return
+	})
+}
+
+// ExpandWithFunc creates a Rewriter that substitutes every match of the given regular expression
+// pattern with the value returned from the given function, which is invoked with the text of
+// the first capture group in the pattern (or of the whole match, if there is no group). Matches
+// for which the function returns false are left intact.
+func ExpandWithFunc(patt string, fn func(string) (string, bool)) Rewriter {
+	if len(patt) == 0 {
+		panic("empty pattern in trw.ExpandWithFunc() function")
+	}
+
+	if fn == nil {
+		panic("nil lookup function in trw.ExpandWithFunc() function")
+	}
+
+	re := regexp.MustCompile(patt)
+	k := 0
+
+	if re.NumSubexp() > 0 {
+		k = 2
+	}
+
+	match := func(s []byte) [][]int {
+		return re.FindAllSubmatchIndex(s, -1)
+	}
+
+	return rewrite(match, func(dest, src []byte, m []int) []byte {
+		if m[k] >= 0 {
+			if value, ok := fn(string(src[m[k]:m[k+1]])); ok {
+				return append(dest, value...)
+			}
 		}
 
-		// (speculatively) reallocate destination slice
-		if len(src) > cap(dest) {
-			dest = make([]byte, 0, len(src)+len(src)/5) // +20%
+		return append(dest, src[m[0]:m[1]]...)
+	})
+}
+
+// ExpandFunc creates a Rewriter that substitutes every match of the given regular expression pattern
+// with the bytes returned from the given function, which is invoked with the text of the match and
+// all the capture groups, as in Regexp.FindSubmatch(). The byte slices passed to the function
+// are only valid until it returns, and they must not be modified.
+func ExpandFunc(patt string, fn func(groups [][]byte) []byte) Rewriter {
+	if len(patt) == 0 {
+		panic("empty pattern in trw.ExpandFunc() function")
+	}
+
+	if fn == nil {
+		panic("nil callback function in trw.ExpandFunc() function")
+	}
+
+	re := regexp.MustCompile(patt)
+
+	match := func(s []byte) [][]int {
+		return re.FindAllSubmatchIndex(s, -1)
+	}
+
+	return rewrite(match, func(dest, src []byte, m []int) []byte {
+		groups := make([][]byte, len(m)/2)
+
+		for i := range groups {
+			if m[2*i] >= 0 {
+				groups[i] = src[m[2*i]:m[2*i+1]:m[2*i+1]]
+			}
 		}
 
-		// copy with replacement
-		i := 0
+		return append(dest, fn(groups)...)
+	})
+}
 
-		for _, m := range ms {
-			dest = re.Expand(append(dest, src[i:m[0]]...), []byte(subst), src, m)
-			i = m[1]
+// DeleteGroup creates a Rewriter that removes the text of the specified capture group from
+// every match of the given regular expression pattern, keeping the rest of the match intact.
+// Matches where the group does not participate are left unchanged.
+func DeleteGroup(patt string, group int) Rewriter {
+	if len(patt) == 0 {
+		panic("empty pattern in trw.DeleteGroup() function")
+	}
+
+	re := regexp.MustCompile(patt)
+
+	if group < 1 || group > re.NumSubexp() {
+		panic("invalid group number in trw.DeleteGroup() function")
+	}
+
+	match := func(s []byte) [][]int {
+		return re.FindAllSubmatchIndex(s, -1)
+	}
+
+	k := 2 * group
+
+	return rewrite(match, func(dest, src []byte, m []int) []byte {
+		if m[k] < 0 {
+			return append(dest, src[m[0]:m[1]]...)
+		}
+
+		return append(append(dest, src[m[0]:m[k]]...), src[m[k+1]:m[1]]...)
+	})
+}
+
+// ReorderGroups creates a Rewriter that substitutes every match of the given regular expression
+// pattern with the text of its capture groups, in the specified order, joined with the given
+// separator. Groups that do not participate in the match are skipped. For example, with
+// the pattern `(\w+), (\w+)`, order {2, 1}, and separator " ", "Smith, John" becomes "John Smith".
+func ReorderGroups(patt string, order []int, sep string) Rewriter {
+	if len(patt) == 0 {
+		panic("empty pattern in trw.ReorderGroups() function")
+	}
+
+	if len(order) == 0 {
+		panic("empty group list in trw.ReorderGroups() function")
+	}
+
+	re := regexp.MustCompile(patt)
+
+	for _, g := range order {
+		if g < 0 || g > re.NumSubexp() {
+			panic("invalid group number in trw.ReorderGroups() function")
+		}
+	}
+
+	order = append([]int(nil), order...)
+
+	match := func(s []byte) [][]int {
+		return re.FindAllSubmatchIndex(s, -1)
+	}
+
+	return rewrite(match, func(dest, src []byte, m []int) []byte {
+		first := true
+
+		for _, g := range order {
+			if m[2*g] < 0 {
+				continue
+			}
+
+			if !first {
+				dest = append(dest, sep...)
+			}
+
+			dest = append(dest, src[m[2*g]:m[2*g+1]]...)
+			first = false
 		}
 
-		return append(dest, src[i:]...), src
+		return dest
+	})
+}
+
+// Extract creates a Rewriter that invokes the given function for every match of the regular expression
+// pattern, passing it the text of the match and all the capture groups, as in Regexp.FindSubmatch().
+// The text itself is not modified. The byte slices passed to the function are only valid until
+// it returns.
+func Extract(patt string, fn func([][]byte)) Rewriter {
+	if len(patt) == 0 {
+		panic("empty pattern in trw.Extract() function")
+	}
+
+	if fn == nil {
+		panic("nil callback function in trw.Extract() function")
+	}
+
+	re := regexp.MustCompile(patt)
+
+	return func(dest, src []byte) ([]byte, []byte) {
+		for _, groups := range re.FindAllSubmatch(src, -1) {
+			fn(groups)
+		}
+
+		return src, dest
+	}
+}
+
+// AssertAbsent creates a Rewriter that passes the text through unchanged, verifying that the given
+// Matcher finds nothing in it. If there are any matches, the given function is invoked with them,
+// and it may record the failure, save it as an error to be returned after the rewrite, or panic,
+// depending on the caller's policy. The Rewriter is meant to be the final stage of a pipeline,
+// checking that all the sensitive data have actually been removed by the preceding stages.
+func AssertAbsent(match Matcher, fail func(ms [][]int)) Rewriter {
+	if match == nil {
+		panic("nil matcher in trw.AssertAbsent() function")
+	}
+
+	if fail == nil {
+		panic("nil callback function in trw.AssertAbsent() function")
+	}
+
+	return func(dest, src []byte) ([]byte, []byte) {
+		if ms := match(src); len(ms) > 0 {
+			fail(ms)
+		}
+
+		return src, dest
+	}
+}
+
+// ReplaceNumbered creates a Rewriter that substitutes all the matches produced by the given Matcher
+// with the specified template, where every occurrence of "${n}" is replaced with the ordinal number
+// of the match, starting from 1.
+func ReplaceNumbered(match Matcher, templ string) Rewriter {
+	parts := strings.Split(templ, "${n}")
+
+	if len(parts) == 1 {
+		return Replace(match, templ)
+	}
+
+	return func(dest, src []byte) ([]byte, []byte) {
+		n := int64(0)
+
+		return rewrite(match, func(dest, _ []byte, _ []int) []byte {
+			n++
+			return appendNumbered(dest, parts, n)
+		})(dest, src)
+	}
+}
+
+// appendNumbered appends the template split at "${n}" markers to the destination slice,
+// substituting the given number for each marker.
+func appendNumbered(dest []byte, parts []string, n int64) []byte {
+	dest = append(dest, parts[0]...)
+
+	for _, s := range parts[1:] {
+		dest = append(strconv.AppendInt(dest, n, 10), s...)
+	}
+
+	return dest
+}
+
+// rewrite creates a Rewriter that substitutes every match produced by the given Matcher
+// with the bytes appended to the destination slice by the given function.
+func rewrite(match Matcher, fn func(dest, src []byte, m []int) []byte) Rewriter {
+	return func(dest, src []byte) ([]byte, []byte) {
+		return rewriteAll(dest, src, &matches{ms: match(src)}, fn)
+	}
+}
+
+// rewriteAll substitutes every match from the iterator with the bytes appended to the destination
+// slice by the given function.
+func rewriteAll(dest, src []byte, it *matches, fn func(dest, src []byte, m []int) []byte) ([]byte, []byte) {
+	m := it.next()
+
+	if m == nil { // avoid copying without a match
+		return src, dest
+	}
+
+	// (speculatively) reallocate destination slice
+	if len(src) > cap(dest) {
+		dest = make([]byte, 0, len(src)+len(src)/5) // +20%
+	}
+
+	// copy with replacement
+	i := 0
+
+	for ; m != nil; m = it.next() {
+		dest = fn(append(dest, src[i:m[0]]...), src, m)
+		i = m[1]
 	}
+
+	return append(dest, src[i:]...), src
 }
 
 // Lit creates a Matcher for the given string literal.
@@ -225,14 +617,10 @@ func Lit(patt string) Matcher {
 		panic("empty pattern in trw.Lit() function")
 	}
 
-	return func(s []byte) (ms [][]int) {
-		for b, i := 0, bytes.Index(s, []byte(patt)); i >= 0; i = bytes.Index(s[b:], []byte(patt)) {
-			b += i
-			ms = append(ms, []int{b, b + len(patt)})
-			b += len(patt)
-		}
+	p := []byte(patt)
 
-		return
+	return func(s []byte) [][]int {
+		return matchLit(s, p, -1)
 	}
 }
 
@@ -246,14 +634,44 @@ func LitN(patt string, n int) Matcher {
 		panic("empty pattern in trw.LitN() function")
 	}
 
+	p := []byte(patt)
+
+	return func(s []byte) [][]int {
+		return matchLit(s, p, n)
+	}
+}
+
+// LitLong creates a Matcher for the given string literal using Boyer-Moore-Horspool algorithm,
+// which skips ahead through the input by up to the pattern length on a mismatch. For literals
+// of 32 bytes or longer this is usually faster than Lit() on large inputs.
+func LitLong(patt string) Matcher {
+	if len(patt) == 0 {
+		panic("empty pattern in trw.LitLong() function")
+	}
+
+	p := []byte(patt)
+	last := len(p) - 1
+
+	// bad character table
+	var skip [256]int
+
+	for i := range skip {
+		skip[i] = len(p)
+	}
+
+	for i := 0; i < last; i++ {
+		skip[p[i]] = last - i
+	}
+
 	return func(s []byte) (ms [][]int) {
-		for n, b := n, 0; n > 0; n-- {
-			if i := bytes.Index(s[b:], []byte(patt)); i >= 0 {
-				b += i
-				ms = append(ms, []int{b, b + len(patt)})
-				b += len(patt)
+		for i := 0; i+len(p) <= len(s); {
+			c := s[i+last]
+
+			if c == p[last] && bytes.Equal(s[i:i+last], p[:last]) {
+				ms = append(ms, []int{i, i + len(p)})
+				i += len(p)
 			} else {
-				break
+				i += skip[c]
 			}
 		}
 
@@ -261,6 +679,57 @@ func LitN(patt string, n int) Matcher {
 	}
 }
 
+// matchLit finds up to n (or all, if n < 0) non-overlapping occurrences of the given literal.
+// Single-byte literals are first counted (the counting is vectorised in the standard library),
+// so that all the matches are allocated at once; longer literals are found in a single pass.
+func matchLit(s, patt []byte, n int) [][]int {
+	if len(patt) != 1 {
+		return matchLitN(s, patt, n)
+	}
+
+	k := bytes.Count(s, patt)
+
+	if n >= 0 && k > n {
+		k = n
+	}
+
+	if k == 0 {
+		return nil
+	}
+
+	ms := make([][]int, k)
+	idx := make([]int, 2*k)
+
+	for i, b := 0, 0; i < k; i++ {
+		b += bytes.IndexByte(s[b:], patt[0])
+
+		m := idx[2*i : 2*i+2 : 2*i+2]
+		m[0], m[1] = b, b+1
+		ms[i] = m
+		b++
+	}
+
+	return ms
+}
+
+// matchLitN finds up to n (or all, if n < 0) non-overlapping occurrences of the given
+// multi-byte literal, scanning the input only once.
+func matchLitN(s, patt []byte, n int) (ms [][]int) {
+	for b := 0; n < 0 || len(ms) < n; {
+		i := bytes.Index(s[b:], patt)
+
+		if i < 0 {
+			break
+		}
+
+		b += i
+		ms = append(ms, []int{b, b + len(patt)})
+		b += len(patt)
+	}
+
+	return
+}
+
 // Patt creates a Matcher for the given regular expression pattern.
 func Patt(patt string) Matcher {
 	return PattN(patt, -1)
@@ -275,6 +744,84 @@ func PattN(patt string, n int) Matcher {
 	return ReN(regexp.MustCompile(patt), n)
 }
 
+// PattSpanning creates a Matcher for the given regular expression pattern, where the matches may
+// cross line boundaries (the pattern is compiled with the "s" flag set), but may not be longer than
+// maxSpan bytes. The regular expression is only ever applied to a bounded window of the input,
+// so, for example, `BEGIN.*END` is safe to use even on very large inputs. A match that would be
+// longer than maxSpan is cut to the match found within maxSpan bytes from its start, or dropped
+// if there is none. As with Windowed(), the pattern should not depend on the context outside
+// of the match.
+func PattSpanning(patt string, maxSpan int) Matcher {
+	if len(patt) == 0 {
+		panic("empty pattern in trw.PattSpanning() function")
+	}
+
+	if maxSpan <= 0 {
+		panic("invalid maximum span in trw.PattSpanning() function")
+	}
+
+	re := regexp.MustCompile("(?s:" + patt + ")")
+	window := maxSpan
+
+	if window < 4096 {
+		window = 4096
+	}
+
+	return func(s []byte) (ms [][]int) {
+		prev := -1 // end of the previous match
+
+		for b := 0; b <= len(s); {
+			e := b + window + maxSpan
+			last := e >= len(s)
+
+			if last {
+				e = len(s)
+			}
+
+			loc := re.FindIndex(s[b:e])
+
+			if loc == nil || (loc[0] >= window && !last) {
+				if last {
+					break
+				}
+
+				b += window
+				continue
+			}
+
+			i, j := b+loc[0], b+loc[1]
+
+			if j-i > maxSpan {
+				if loc = re.FindIndex(s[i : i+maxSpan]); loc == nil || loc[0] > 0 {
+					b = i + 1 // drop
+					continue
+				}
+
+				j = i + loc[1]
+			}
+
+			if i < j {
+				ms = append(ms, []int{i, j})
+				b, prev = j, j
+				continue
+			}
+
+			// ignore empty match abutting the preceding match, as in regexp
+			if i != prev {
+				ms = append(ms, []int{i, j})
+			}
+
+			if prev = j; j == len(s) {
+				break
+			}
+
+			b = j + runeLen(s[j:]) // resume at the next rune
+		}
+
+		return
+	}
+}
+
 // Re creates a matcher for the given regular expression object.
 func Re(re *regexp.Regexp) Matcher {
 	return ReN(re, -1)
@@ -290,3 +837,264 @@ func ReN(re *regexp.Regexp, n int) Matcher {
 		return re.FindAllIndex(s, n)
 	}
 }
+
+// runeLen returns the length of the first rune in the given non-empty slice, or 1 for invalid UTF-8.
+func runeLen(s []byte) int {
+	_, n := utf8.DecodeRune(s)
+	return n
+}
+
+// Bytes creates a Matcher for maximal runs of any bytes from the given set. The set is treated
+// as a list of bytes, not runes, so multi-byte UTF-8 sequences should not be included.
+func Bytes(set string) Matcher {
+	if len(set) == 0 {
+		panic("empty byte set in trw.Bytes() function")
+	}
+
+	var table [4]uint64 // bitmap
+
+	for i := 0; i < len(set); i++ {
+		table[set[i]>>6] |= 1 << (set[i] & 63)
+	}
+
+	return func(s []byte) (ms [][]int) {
+		for i := 0; i < len(s); i++ {
+			if table[s[i]>>6]&(1<<(s[i]&63)) == 0 {
+				continue
+			}
+
+			j := i + 1
+
+			for j < len(s) && table[s[j]>>6]&(1<<(s[j]&63)) != 0 {
+				j++
+			}
+
+			ms = append(ms, []int{i, j})
+			i = j
+		}
+
+		return
+	}
+}
+
+// Last creates a Matcher that returns only the last n matches produced by the given Matcher,
+// for example, to delete the final occurrence of a signature block. The underlying Matcher
+// still scans the whole input.
+func Last(match Matcher, n int) Matcher {
+	if match == nil {
+		panic("nil matcher in trw.Last() function")
+	}
+
+	if n <= 0 {
+		panic("invalid number of matches in trw.Last() function")
+	}
+
+	return func(s []byte) [][]int {
+		ms := match(s)
+
+		if len(ms) > n {
+			ms = ms[len(ms)-n:]
+		}
+
+		return ms
+	}
+}
+
+// Limit creates a Matcher that applies the given Matcher to the first maxOffset bytes of the input
+// only, for example, to restrict the rewriting to the header region of a document. Only the matches
+// lying entirely within the region are produced. The underlying Matcher sees the end of the region
+// as the end of the text, which affects anchors and word boundaries.
+func Limit(match Matcher, maxOffset int) Matcher {
+	if match == nil {
+		panic("nil matcher in trw.Limit() function")
+	}
+
+	if maxOffset < 0 {
+		panic("negative offset in trw.Limit() function")
+	}
+
+	return func(s []byte) [][]int {
+		if len(s) > maxOffset {
+			s = s[:maxOffset]
+		}
+
+		return match(s)
+	}
+}
+
+// From creates a Matcher that applies the given Matcher to the input starting at minOffset only,
+// skipping the first minOffset bytes. The underlying Matcher sees the start of the region
+// as the start of the text, which affects anchors and word boundaries. Only the index pairs
+// of the matches are adjusted by the offset; extra ints (like the literal indices from Lits())
+// are passed on as they are. See FromSubmatch() for matchers producing submatch indices.
+func From(match Matcher, minOffset int) Matcher {
+	return from(match, minOffset, false, "From")
+}
+
+// FromSubmatch works like From(), but adjusts all the non-negative ints of the matches by
+// the offset, as required for matchers producing submatch indices, as in
+// Regexp.FindAllSubmatchIndex().
+func FromSubmatch(match Matcher, minOffset int) Matcher {
+	return from(match, minOffset, true, "FromSubmatch")
+}
+
+func from(match Matcher, minOffset int, submatch bool, fn string) Matcher {
+	if match == nil {
+		panic("nil matcher in trw." + fn + "() function")
+	}
+
+	if minOffset < 0 {
+		panic("negative offset in trw." + fn + "() function")
+	}
+
+	return func(s []byte) [][]int {
+		if len(s) < minOffset {
+			return nil
+		}
+
+		ms := match(s[minOffset:])
+
+		for _, m := range ms {
+			shiftMatch(m, minOffset, submatch)
+		}
+
+		return ms
+	}
+}
+
+// shiftMatch adds the offset to the index pair of the match, or to all its non-negative ints,
+// if the match holds submatch indices.
+func shiftMatch(m []int, offset int, submatch bool) {
+	if !submatch {
+		m[0] += offset
+		m[1] += offset
+		return
+	}
+
+	for i, v := range m {
+		if v >= 0 {
+			m[i] = v + offset
+		}
+	}
+}
+
+// Windowed creates a Matcher that applies the given Matcher to successive windows of the input,
+// each of the specified size plus the maximum match length, so that no single invocation of the
+// underlying matcher sees more than window+maxLen bytes. Only the matches starting within
+// a window are accepted from it. A match longer than maxLen may reach the end of its window,
+// and then it is cut there, and the rest of it is matched anew from the next window, so that,
+// for example, with a window of 2 and maxLen of 2 the pattern `a+` matches a run of eight "a"
+// as two matches of four. The underlying matcher should not depend on the context outside of
+// the match (for example, anchors and word boundaries may match at window edges). As with From(),
+// only the index pairs of the matches are adjusted; see WindowedSubmatch() for matchers producing
+// submatch indices. The returned Matcher still produces the matches from all the windows at once;
+// DeleteWindowed() and ReplaceWindowed() only keep the matches from one window at a time.
+func Windowed(match Matcher, window, maxLen int) Matcher {
+	return windowedMatcher(newWindow(match, window, maxLen, false, "Windowed"))
+}
+
+// WindowedSubmatch works like Windowed(), but adjusts all the non-negative ints of the matches,
+// as required for matchers producing submatch indices, as in Regexp.FindAllSubmatchIndex().
+func WindowedSubmatch(match Matcher, window, maxLen int) Matcher {
+	return windowedMatcher(newWindow(match, window, maxLen, true, "WindowedSubmatch"))
+}
+
+// DeleteWindowed creates a Rewriter that removes all the matches produced by the given Matcher
+// applied to successive windows of the input, as with Windowed(). The matches are consumed
+// one window at a time, so the memory required for them is bounded by the window size,
+// not by the size of the input.
+func DeleteWindowed(match Matcher, window, maxLen int) Rewriter {
+	w := newWindow(match, window, maxLen, false, "DeleteWindowed")
+
+	return func(unused, src []byte) ([]byte, []byte) {
+		return deleteAll(src, &matches{win: w, src: src}), unused
+	}
+}
+
+// ReplaceWindowed creates a Rewriter that substitutes all the matches produced by the given Matcher
+// applied to successive windows of the input, as with Windowed(), with the specified string.
+// As with DeleteWindowed(), the matches are consumed one window at a time.
+func ReplaceWindowed(match Matcher, subst string, window, maxLen int) Rewriter {
+	w := newWindow(match, window, maxLen, false, "ReplaceWindowed")
+
+	if len(subst) == 0 {
+		return func(unused, src []byte) ([]byte, []byte) {
+			return deleteAll(src, &matches{win: w, src: src}), unused
+		}
+	}
+
+	return func(dest, src []byte) ([]byte, []byte) {
+		return replaceAll(dest, src, subst, &matches{win: w, src: src}, len(src))
+	}
+}
+
+// window is a Matcher applied to successive windows of the input.
+type window struct {
+	match        Matcher
+	size, maxLen int
+	submatch     bool
+}
+
+func newWindow(match Matcher, size, maxLen int, submatch bool, fn string) *window {
+	if match == nil {
+		panic("nil matcher in trw." + fn + "() function")
+	}
+
+	if size <= 0 || maxLen <= 0 {
+		panic("invalid window size in trw." + fn + "() function")
+	}
+
+	return &window{match: match, size: size, maxLen: maxLen, submatch: submatch}
+}
+
+// windowedMatcher creates a Matcher collecting the matches from all the windows.
+func windowedMatcher(w *window) Matcher {
+	return func(s []byte) (ms [][]int) {
+		it := matches{win: w, src: s}
+
+		for m := it.next(); m != nil; m = it.next() {
+			ms = append(ms, m)
+		}
+
+		return
+	}
+}
+
+// fill applies the Matcher to the windows of the iterator's source, starting at the iterator's
+// offset, until a window with some matches is found, and stores the accepted matches
+// to the iterator. The offset is advanced to the start of the next window.
+func (w *window) fill(it *matches) {
+	for len(it.ms) == 0 && it.from < len(it.src) {
+		b := it.from
+		e := b + w.size + w.maxLen
+		last := e >= len(it.src)
+
+		if last {
+			e = len(it.src)
+		}
+
+		next := b + w.size
+		ms := w.match(it.src[b:e])
+		k := 0
+
+		for _, m := range ms {
+			if m[0] >= w.size && !last {
+				break // belongs to the next window
+			}
+
+			shiftMatch(m, b, w.submatch)
+			ms[k] = m
+			k++
+
+			if m[1] > next {
+				next = m[1]
+			}
+		}
+
+		if last {
+			next = len(it.src)
+		}
+
+		it.ms, it.from = ms[:k], next
+	}
+}
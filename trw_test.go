@@ -30,6 +30,10 @@ package trw
 
 import (
 	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -147,6 +151,113 @@ func BenchmarkDelete(b *testing.B) {
 	}
 }
 
+func BenchmarkLitByte(b *testing.B) {
+	benchLit(b, Lit(" "), " ")
+}
+
+func BenchmarkLitByteBaseline(b *testing.B) {
+	benchLit(b, baselineLit(" "), " ")
+}
+
+func BenchmarkLitShort(b *testing.B) {
+	benchLit(b, Lit("the"), "the")
+}
+
+func BenchmarkLitShortBaseline(b *testing.B) {
+	benchLit(b, baselineLit("the"), "the")
+}
+
+func benchLit(b *testing.B, match Matcher, patt string) {
+	src := bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog\n"), 1000)
+	exp := bytes.Replace(src, []byte(patt), nil, -1)
+	s := make([]byte, len(src))
+	ok := true
+
+	b.SetBytes(int64(len(src)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for n := 0; n < b.N && ok; n++ {
+		copy(s, src)
+		ok = bytes.Equal(Delete(match).Do(s), exp)
+	}
+
+	b.StopTimer()
+
+	if !ok {
+		b.Error("Benchmark failed!")
+		return
+	}
+}
+
+// baselineLit is the original implementation of Lit(), for comparison.
+func baselineLit(patt string) Matcher {
+	return func(s []byte) (ms [][]int) {
+		for b, i := 0, bytes.Index(s, []byte(patt)); i >= 0; i = bytes.Index(s[b:], []byte(patt)) {
+			b += i
+			ms = append(ms, []int{b, b + len(patt)})
+			b += len(patt)
+		}
+
+		return
+	}
+}
+
+func TestLitLong(t *testing.T) {
+	cases := []struct {
+		src, patt string
+	}{
+		{"", "abc"},
+		{"ab", "abc"},
+		{"abc", "abc"},
+		{"xabcabcx", "abc"},
+		{"aaaaa", "aa"},
+		{"abababa", "aba"},
+		{"x", "x"},
+		{strings.Repeat("0123456789", 20) + "the key is here: abcdefghijklmnopqrstuvwxyz012345", "abcdefghijklmnopqrstuvwxyz012345"},
+	}
+
+	for i, c := range cases {
+		res, exp := LitLong(c.patt)([]byte(c.src)), Lit(c.patt)([]byte(c.src))
+
+		if fmt.Sprint(res) != fmt.Sprint(exp) {
+			t.Errorf("[%d] Unexpected result: %v instead of %v", i, res, exp)
+			return
+		}
+	}
+}
+
+func BenchmarkLitLong(b *testing.B) {
+	benchLitLong(b, LitLong(longLit))
+}
+
+func BenchmarkLitLongIndex(b *testing.B) {
+	benchLitLong(b, Lit(longLit))
+}
+
+const longLit = "Authorization: Bearer 0123456789abcdef"
+
+func benchLitLong(b *testing.B, match Matcher) {
+	src := bytes.Repeat([]byte("GET /index.html HTTP/1.1\r\nHost: example.com\r\nAccept: */*\r\n"), 1000)
+	src = append(src, longLit...)
+	ok := true
+
+	b.SetBytes(int64(len(src)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for n := 0; n < b.N && ok; n++ {
+		ok = len(match(src)) == 1
+	}
+
+	b.StopTimer()
+
+	if !ok {
+		b.Error("Benchmark failed!")
+		return
+	}
+}
+
 func TestReplace1(t *testing.T) {
 	cases := []struct {
 		src, patt, repl, exp string
@@ -250,6 +361,92 @@ func TestReplacePatt(t *testing.T) {
 	}
 }
 
+func TestAssertAbsent(t *testing.T) {
+	var found [][]int
+
+	rw := Seq(
+		Replace(Patt(`\d{3}-\d{4}`), "XXX-XXXX"),
+		AssertAbsent(Patt(`\d{3}-?\d{4}`), func(ms [][]int) { found = append(found, ms...) }),
+	)
+
+	cases := []struct {
+		src, exp string
+		found    int
+	}{
+		{"call 555-1234", "call XXX-XXXX", 0},
+		{"call 555-1234 or 5551234", "call XXX-XXXX or 5551234", 1},
+	}
+
+	for i, c := range cases {
+		found = nil
+
+		if res := rw.Do([]byte(c.src)); string(res) != c.exp {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+
+		if len(found) != c.found {
+			t.Errorf("[%d] Unexpected number of residual matches: %d instead of %d", i, len(found), c.found)
+			return
+		}
+	}
+}
+
+func TestReplaceNumbered(t *testing.T) {
+	cases := []struct {
+		src, patt, templ, exp string
+	}{
+		{"abc", "z", "[${n}]", "abc"},
+		{"a*b*c", `\*`, "[${n}]", "a[1]b[2]c"},
+		{"a*b*c", `\*`, "", "abc"},
+		{"a*b*c", `\*`, "-", "a-b-c"},
+		{"x x x", "x", "${n}:${n}", "1:1 2:2 3:3"},
+		{"aa bb cc dd ee ff gg hh ii jj kk", `[a-z]+`, "${n}", "1 2 3 4 5 6 7 8 9 10 11"},
+	}
+
+	for i, c := range cases {
+		rw := ReplaceNumbered(Patt(c.patt), c.templ)
+
+		// run twice to make sure the counter restarts
+		for k := 0; k < 2; k++ {
+			if res := rw.Do([]byte(c.src)); !bytes.Equal(res, []byte(c.exp)) {
+				t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+				return
+			}
+		}
+	}
+}
+
+func TestReplaceRe(t *testing.T) {
+	re := regexp.MustCompile(`b+`)
+
+	cases := []struct {
+		src, repl, exp string
+	}{
+		{"abbc", "X", "aXc"},
+		{"abbc abc", "$0", "a$0c a$0c"},
+		{"abbc abc", "", "ac ac"},
+		{"xyz", "X", "xyz"},
+	}
+
+	for i, c := range cases {
+		if res := ReplaceRe(re, []byte(c.repl)).Do([]byte(c.src)); !bytes.Equal(res, []byte(c.exp)) {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+
+		if exp := re.ReplaceAllLiteral([]byte(c.src), []byte(c.repl)); !bytes.Equal(exp, []byte(c.exp)) {
+			t.Errorf("[%d] Unexpected reference result: %q instead of %q", i, string(exp), c.exp)
+			return
+		}
+	}
+
+	if res := DeleteRe(re).Do([]byte("abbc")); string(res) != "ac" {
+		t.Errorf("Unexpected result: %q", string(res))
+		return
+	}
+}
+
 func BenchmarkReplace(b *testing.B) {
 	src := []byte("aa bb cc dd")
 	exp := []byte("X bb cc dd")
@@ -328,6 +525,137 @@ func TestExpandMulti(t *testing.T) {
 	}
 }
 
+func TestExpandWith(t *testing.T) {
+	data := map[string]string{
+		"name":  "World",
+		"greet": "Hello",
+		"empty": "",
+	}
+
+	cases := []struct {
+		src, patt, exp string
+	}{
+		{"${greet}, ${name}!", `\$\{(\w+)\}`, "Hello, World!"},
+		{"${greet}, ${other}!", `\$\{(\w+)\}`, "Hello, ${other}!"},
+		{"[${empty}]", `\$\{(\w+)\}`, "[]"},
+		{"greet name", `\w+`, "Hello World"},
+		{"no placeholders", `\$\{(\w+)\}`, "no placeholders"},
+	}
+
+	for i, c := range cases {
+		if res := ExpandWith(c.patt, data).Do([]byte(c.src)); !bytes.Equal(res, []byte(c.exp)) {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+	}
+}
+
+func TestExpandFunc(t *testing.T) {
+	// convert Celsius to Fahrenheit, keeping other units intact
+	rw := ExpandFunc(`(-?\d+)(C|K)`, func(groups [][]byte) []byte {
+		if string(groups[2]) != "C" {
+			return groups[0]
+		}
+
+		c, _ := strconv.Atoi(string(groups[1]))
+
+		return strconv.AppendInt(nil, int64(c*9/5+32), 10)
+	})
+
+	const src, exp = "-40C 100C 300K", "-40 212 300K"
+
+	if res := rw.Do([]byte(src)); string(res) != exp {
+		t.Errorf("Unexpected result: %q instead of %q", string(res), exp)
+		return
+	}
+
+	// optional group
+	rw = ExpandFunc(`(\w+)(=\w+)?`, func(groups [][]byte) []byte {
+		if groups[2] == nil {
+			return []byte("<" + string(groups[1]) + ">")
+		}
+
+		return bytes.ToUpper(groups[0])
+	})
+
+	if res := rw.Do([]byte("a=b c")); string(res) != "A=B <c>" {
+		t.Errorf("Unexpected result: %q", string(res))
+		return
+	}
+}
+
+func TestDeleteGroup(t *testing.T) {
+	cases := []struct {
+		patt     string
+		group    int
+		src, exp string
+	}{
+		{`(\w+)( \w+)`, 2, "John Smith, Jane Doe", "John, Jane"},
+		{`(\w+)( \w+)`, 1, "John Smith, Jane Doe", " Smith,  Doe"},
+		{`id=(\d+)?(;)`, 1, "id=123; id=; id=4;", "id=; id=; id=;"},
+		{`key(=\w+)?`, 1, "key=value keys", "key keys"},
+		{`(x)`, 1, "no match", "no match"},
+	}
+
+	for i, c := range cases {
+		if res := DeleteGroup(c.patt, c.group).Do([]byte(c.src)); string(res) != c.exp {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+	}
+}
+
+func TestReorderGroups(t *testing.T) {
+	cases := []struct {
+		patt     string
+		order    []int
+		sep      string
+		src, exp string
+	}{
+		{`(\w+), (\w+)`, []int{2, 1}, " ", "Smith, John; Doe, Jane", "John Smith; Jane Doe"},
+		{`(\d+)/(\d+)/(\d+)`, []int{3, 1, 2}, "-", "on 12/31/1999", "on 1999-12-31"},
+		{`(\w+)(?:=(\w+))?`, []int{2, 1}, ":", "a=b c", "b:a c"},
+		{`(\w+)`, []int{1, 0, 1}, "", "ab", "ababab"},
+		{`(x)`, []int{1}, "", "no match", "no match"},
+	}
+
+	for i, c := range cases {
+		if res := ReorderGroups(c.patt, c.order, c.sep).Do([]byte(c.src)); string(res) != c.exp {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+	}
+}
+
+func TestExtract(t *testing.T) {
+	const src = "a=1 b=22 c=333"
+
+	var keys, values []string
+
+	rw := Seq(
+		Extract(`(\w+)=(\d+)`, func(groups [][]byte) {
+			keys = append(keys, string(groups[1]))
+			values = append(values, string(groups[2]))
+		}),
+		Replace(Patt(`\d+`), "N"),
+	)
+
+	if res := rw.Do([]byte(src)); string(res) != "a=N b=N c=N" {
+		t.Errorf("Unexpected result: %q", string(res))
+		return
+	}
+
+	if s := strings.Join(keys, " "); s != "a b c" {
+		t.Errorf("Unexpected keys: %q", s)
+		return
+	}
+
+	if s := strings.Join(values, " "); s != "1 22 333" {
+		t.Errorf("Unexpected values: %q", s)
+		return
+	}
+}
+
 func BenchmarkExpand(b *testing.B) {
 	src := []byte("aa bb cc dd")
 	exp := []byte("aa _bb_ cc dd")
@@ -352,6 +680,437 @@ func BenchmarkExpand(b *testing.B) {
 	}
 }
 
+func TestPattSpanning(t *testing.T) {
+	cases := []struct {
+		patt     string
+		span     int
+		src, exp string
+	}{
+		{`BEGIN.*?END`, 100, "a BEGIN\nx\nEND b BEGIN y END c", "a  b  c"},
+		{`BEGIN.*END`, 100, "a BEGIN\nx\nEND b BEGIN y END c", "a  c"},
+		{`BEGIN.*END`, 12, "a BEGIN\nx\nEND b BEGIN y END c", "a  b  c"},
+		{`BEGIN.*END`, 11, "a BEGIN\nxxx\nEND b BEGIN y END c", "a BEGIN\nxxx\nEND b  c"},
+		{`x+`, 3, "axxxxxxxb", "ab"},
+		{`BEGIN.*END`, 100, strings.Repeat("x", 10000) + "BEGIN" + strings.Repeat("y", 90) + "END!", strings.Repeat("x", 10000) + "!"},
+	}
+
+	for i, c := range cases {
+		if res := Delete(PattSpanning(c.patt, c.span)).Do([]byte(c.src)); string(res) != c.exp {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+	}
+}
+
+func TestZeroLengthMatches(t *testing.T) {
+	// no anchors, see FindRe()
+	patts := []string{`x*`, `a*`, `a|`, `a|x*`, `[ax]?`}
+	srcs := []string{"", "abc", "aaxaa", "é€x", "a\nb\n", "baaab", strings.Repeat("baa", 3000)}
+
+	for i, patt := range patts {
+		re := regexp.MustCompile(patt)
+
+		for j, src := range srcs {
+			rws := []struct {
+				name string
+				rw   Rewriter
+				exp  string
+			}{
+				{"Replace", Replace(Patt(patt), "-"), re.ReplaceAllLiteralString(src, "-")},
+				{"ReplaceLazy", ReplaceLazy(FindPatt(patt), "-"), re.ReplaceAllLiteralString(src, "-")},
+				{"Expand", Expand(patt, "<$0>"), re.ReplaceAllString(src, "<$0>")},
+				{"Delete", Delete(Patt(patt)), re.ReplaceAllLiteralString(src, "")},
+				{"DeleteLazy", DeleteLazy(FindPatt(patt)), re.ReplaceAllLiteralString(src, "")},
+				{"PattSpanning", Replace(PattSpanning(patt, 10), "-"), re.ReplaceAllLiteralString(src, "-")},
+			}
+
+			for _, r := range rws {
+				if res := r.rw.Do([]byte(src)); string(res) != r.exp {
+					t.Errorf("[%d, %d] %s: Unexpected result: %q instead of %q", i, j, r.name, string(res), r.exp)
+					return
+				}
+			}
+		}
+	}
+}
+
+// upper is an Interface implementation not based on the Rewriter type
+type upper struct{}
+
+func (upper) Rewrite(dest, src []byte) ([]byte, []byte) {
+	return append(dest[:0], bytes.ToUpper(src)...), src
+}
+
+func TestInterface(t *testing.T) {
+	var i Interface = Replace(Lit("a"), "b")
+
+	if rw := FromInterface(i); string(rw.Do([]byte("aaa"))) != "bbb" {
+		t.Error("Unexpected result from the converted Rewriter")
+		return
+	}
+
+	rw := Seq(FromInterface(upper{}), Delete(Lit("B")))
+
+	if res := rw.Do([]byte("abcb")); string(res) != "AC" {
+		t.Errorf("Unexpected result: %q instead of %q", string(res), "AC")
+		return
+	}
+}
+
+func TestOnlyIf(t *testing.T) {
+	calls := 0
+	inner := func(dest, src []byte) ([]byte, []byte) {
+		calls++
+		return Delete(Patt(`<[^>]*>`))(dest, src)
+	}
+
+	rw := OnlyIf(LitN("<", 1), inner)
+
+	cases := []struct {
+		src, exp string
+		calls    int
+	}{
+		{"plain text", "plain text", 0},
+		{"<b>bold</b> text", "bold text", 1},
+		{"", "", 1},
+	}
+
+	for i, c := range cases {
+		if res := rw.Do([]byte(c.src)); string(res) != c.exp || calls != c.calls {
+			t.Errorf("[%d] Unexpected result: %q (%d calls) instead of %q", i, string(res), calls, c.exp)
+			return
+		}
+	}
+}
+
+func TestSeqUntilChange(t *testing.T) {
+	rw := SeqUntilChange(
+		Replace(Lit("colour"), "color"),
+		Replace(Lit("grey"), "gray"),
+		Delete(Lit("!")),
+	)
+
+	cases := []struct {
+		src, exp string
+	}{
+		{"", ""},
+		{"none", "none"},
+		{"colour grey!", "color grey!"},
+		{"grey!", "gray!"},
+		{"wow!", "wow"},
+	}
+
+	for i, c := range cases {
+		if res := rw.Do([]byte(c.src)); string(res) != c.exp {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+	}
+}
+
+func TestFirst(t *testing.T) {
+	cases := []struct {
+		rw       Rewriter
+		src, exp string
+	}{
+		{DeleteFirst(Lit("ab")), "xabyab", "xyab"},
+		{DeleteFirst(Lit("ab")), "xy", "xy"},
+		{DeleteFirst(Patt(`a*`)), "xaay", "xy"},
+		{ReplaceFirst(Lit("ab"), "_"), "xabyab", "x_yab"},
+		{ReplaceFirst(Patt(`a*`), "_"), "xaay", "_xaay"},
+		{ReplaceFirst(Lit("ab"), ""), "abab", "ab"},
+	}
+
+	for i, c := range cases {
+		if res := c.rw.Do([]byte(c.src)); string(res) != c.exp {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+	}
+}
+
+func TestLast(t *testing.T) {
+	cases := []struct {
+		src, exp string
+		n        int
+	}{
+		{"", "", 1},
+		{"a-b-c", "a-bc", 1},
+		{"a-b-c", "abc", 2},
+		{"a-b-c", "abc", 5},
+		{"abc", "abc", 1},
+	}
+
+	for i, c := range cases {
+		if res := Delete(Last(Lit("-"), c.n)).Do([]byte(c.src)); string(res) != c.exp {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+	}
+}
+
+func TestLimitFrom(t *testing.T) {
+	cases := []struct {
+		match    Matcher
+		src, exp string
+	}{
+		{Limit(Lit("ab"), 4), "ababab", "__ab"},
+		{Limit(Lit("ab"), 3), "ababab", "_abab"},
+		{Limit(Lit("ab"), 0), "ababab", "ababab"},
+		{Limit(Lit("ab"), 10), "ababab", "___"},
+		{From(Lit("ab"), 3), "ababab", "abab_"},
+		{From(Lit("ab"), 2), "ababab", "ab__"},
+		{From(Lit("ab"), 6), "ababab", "ababab"},
+		{From(Lit("ab"), 7), "ababab", "ababab"},
+		{From(Patt(`^b`), 1), "abab", "a_ab"},
+		{From(Limit(Lit("ab"), 4), 2), "abababab", "ab__ab"},
+	}
+
+	for i, c := range cases {
+		if res := Replace(c.match, "_").Do([]byte(c.src)); string(res) != c.exp {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+	}
+
+	// extra ints
+	ms := From(Lits("a", "b"), 2)([]byte("xxab"))
+
+	if exp := [][]int{{2, 3, 0}, {3, 4, 1}}; fmt.Sprint(ms) != fmt.Sprint(exp) {
+		t.Errorf("Unexpected matches: %v instead of %v", ms, exp)
+		return
+	}
+
+	ms = From(Timestamps("2006-01-02", "15:04"), 3)([]byte("at 10:30"))
+
+	if exp := [][]int{{3, 8, 1}}; fmt.Sprint(ms) != fmt.Sprint(exp) {
+		t.Errorf("Unexpected matches: %v instead of %v", ms, exp)
+		return
+	}
+
+	// submatch indices
+	re := regexp.MustCompile(`a(x)?(b)`)
+	match := FromSubmatch(func(s []byte) [][]int { return re.FindAllSubmatchIndex(s, -1) }, 2)
+	exp := [][]int{{2, 4, -1, -1, 3, 4}, {5, 8, 6, 7, 7, 8}}
+
+	if ms := match([]byte("a ab axb")); fmt.Sprint(ms) != fmt.Sprint(exp) {
+		t.Errorf("Unexpected matches: %v instead of %v", ms, exp)
+		return
+	}
+}
+
+func TestBytes(t *testing.T) {
+	cases := []struct {
+		set, src, exp string
+	}{
+		{" \t", "a \t b\tc  ", "a_b_c_"},
+		{"0123456789", "a1b22c333", "a_b_c_"},
+		{"\x00\xff", "\x00a\xff\xffb", "_a_b"},
+		{"xyz", "abc", "abc"},
+		{"?", "", ""},
+	}
+
+	for i, c := range cases {
+		if res := Replace(Bytes(c.set), "_").Do([]byte(c.src)); !bytes.Equal(res, []byte(c.exp)) {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+	}
+}
+
+func BenchmarkBytes(b *testing.B) {
+	benchSpaces(b, Replace(Bytes(" \t\n"), " ").Do)
+}
+
+func TestWindowed(t *testing.T) {
+	cases := []struct {
+		src, patt     string
+		window, limit int
+	}{
+		{"aa bb cc aa bb cc", "bb", 1, 2},
+		{"aa bb cc aa bb cc", "bb", 4, 2},
+		{"aa bb cc aa bb cc", "bb", 100, 2},
+		{"aa bb cc aa bb cc", `[a-z]+`, 3, 2},
+		{"aa bb cc aa bb cc", `\s+`, 2, 1},
+		{"abcabcabcabc", "abc", 2, 3},
+		{"abcabcabcabc", "(a)(x)?(c)?", 1, 3},
+	}
+
+	for i, c := range cases {
+		re := regexp.MustCompile(c.patt)
+		exp := re.FindAllStringSubmatchIndex(c.src, -1)
+
+		match := WindowedSubmatch(func(s []byte) [][]int {
+			return re.FindAllSubmatchIndex(s, -1)
+		}, c.window, c.limit)
+
+		if res := match([]byte(c.src)); fmt.Sprint(res) != fmt.Sprint(exp) {
+			t.Errorf("[%d] Unexpected result: %v instead of %v", i, res, exp)
+			return
+		}
+	}
+
+	// extra ints
+	if ms := Windowed(Lits("a", "b"), 4, 1)([]byte("xxxxxxab")); fmt.Sprint(ms) != "[[6 7 0] [7 8 1]]" {
+		t.Errorf("Unexpected matches: %v", ms)
+		return
+	}
+
+	// matches longer than the limit are split
+	if res := Replace(Windowed(Patt("a+"), 2, 2), "X").Do([]byte("aaaaaaaa b")); string(res) != "XX b" {
+		t.Errorf("Unexpected result: %q", string(res))
+		return
+	}
+}
+
+func TestDeleteReplaceWindowed(t *testing.T) {
+	cases := []struct {
+		src, patt, subst string
+		window, limit    int
+	}{
+		{"aa bb cc aa bb cc", "bb", "", 1, 2},
+		{"aa bb cc aa bb cc", "bb", "X", 4, 2},
+		{"aa bb cc aa bb cc", "bb", "XXX", 100, 2},
+		{"aa bb cc aa bb cc", `[a-z]+`, "-", 3, 2},
+		{"aa bb cc aa bb cc", `\s+`, "", 2, 1},
+		{"aaaaaaaa b", "a+", "X", 2, 2},
+		{"abc", "x*", "-", 2, 1},
+	}
+
+	for i, c := range cases {
+		match := Patt(c.patt)
+		exp := string(Replace(Windowed(match, c.window, c.limit), c.subst).Do([]byte(c.src)))
+
+		rw := ReplaceWindowed(match, c.subst, c.window, c.limit)
+
+		if len(c.subst) == 0 {
+			rw = DeleteWindowed(match, c.window, c.limit)
+		}
+
+		if res := string(rw.Do([]byte(c.src))); res != exp {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, res, exp)
+			return
+		}
+	}
+}
+
+func TestDoCopy(t *testing.T) {
+	cases := []struct {
+		rw       Rewriter
+		src, exp string
+	}{
+		{Delete(Lit("b")), "abcabc", "acac"},               // in-place
+		{Replace(Lit("b"), "XXX"), "abcabc", "aXXXcaXXXc"}, // new slice
+		{Delete(Lit("z")), "abcabc", "abcabc"},             // no match
+	}
+
+	for i, c := range cases {
+		src := []byte(c.src)
+		res := c.rw.DoCopy(src)
+
+		if string(res) != c.exp {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+
+		for j := range res {
+			res[j] = '-'
+		}
+
+		if string(src) != c.src {
+			t.Errorf("[%d] Source modified: %q", i, string(src))
+			return
+		}
+	}
+}
+
+func TestDoToBuffer(t *testing.T) {
+	rw := Seq(Replace(Lit("a"), "XXX"), Delete(Lit("b")))
+
+	var buf bytes.Buffer
+	var sb strings.Builder
+
+	buf.WriteString("head ")
+	sb.WriteString("head ")
+
+	for _, src := range []string{"abc ", "bbb ", "cba"} {
+		rw.DoToBuffer(&buf, []byte(src))
+		rw.DoToBuilder(&sb, []byte(src))
+	}
+
+	const exp = "head XXXc  cXXX"
+
+	if s := buf.String(); s != exp {
+		t.Errorf("Unexpected buffer content: %q instead of %q", s, exp)
+		return
+	}
+
+	if s := sb.String(); s != exp {
+		t.Errorf("Unexpected builder content: %q instead of %q", s, exp)
+		return
+	}
+}
+
+func TestDoTo(t *testing.T) {
+	rw := Seq(Replace(Lit("a"), "XXX"), Delete(Lit("b")))
+	buf := make([]byte, 5, 100)
+
+	for i, c := range []struct{ src, exp string }{{"abc", "XXXc"}, {"bbb", ""}, {"ccc", "ccc"}} {
+		res := rw.DoTo(buf, []byte(c.src))
+
+		if string(res) != c.exp {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+
+		if len(res) > 0 && &res[0] != &buf[0] {
+			t.Errorf("[%d] Result not in the destination buffer", i)
+			return
+		}
+	}
+
+	// small buffer
+	if res := rw.DoTo(make([]byte, 2), []byte("aaaa")); string(res) != "XXXXXXXXXXXX" {
+		t.Errorf("Unexpected result: %q", string(res))
+		return
+	}
+}
+
+func TestAppendDo(t *testing.T) {
+	rw := Seq(Replace(Lit("a"), "XXX"), Delete(Lit("b")))
+
+	cases := []struct {
+		dst, src, exp string
+	}{
+		{"", "", ""},
+		{"", "abc", "XXXc"},
+		{"head ", "abc", "head XXXc"},
+		{"head ", "bbb", "head "},
+		{"head ", "ccc", "head ccc"},
+	}
+
+	for i, c := range cases {
+		for _, extra := range []int{0, 100} {
+			dst := append(make([]byte, 0, len(c.dst)+extra), c.dst...)
+
+			if res := rw.AppendDo(dst, []byte(c.src)); string(res) != c.exp {
+				t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+				return
+			}
+		}
+	}
+
+	// buffer reuse
+	buf := make([]byte, 0, 100)
+
+	for i := 0; i < 3; i++ {
+		if buf = rw.AppendDo(buf[:0], []byte("abcab")); string(buf) != "XXXcXXX" || cap(buf) != 100 {
+			t.Errorf("[%d] Unexpected result: %q, capacity %d", i, string(buf), cap(buf))
+			return
+		}
+	}
+}
+
 // helper functions
 func max(a, b int) int {
 	if a > b {
@@ -360,3 +1119,27 @@ func max(a, b int) int {
 
 	return b
 }
+
+// benchSpaces benchmarks the given function collapsing runs of white space.
+func benchSpaces(b *testing.B, fn func([]byte) []byte) {
+	src := []byte(strings.Repeat("aa \t bb\n\ncc  dd ", 10))
+	exp := []byte(strings.Repeat("aa bb cc dd ", 10))
+	s := make([]byte, len(src), max(len(src), len(exp)))
+	ok := true
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for n := 0; n < b.N && ok; n++ {
+		s = s[:len(src)]
+		copy(s, src)
+		ok = bytes.Equal(fn(s), exp)
+	}
+
+	b.StopTimer()
+
+	if !ok {
+		b.Error("Benchmark failed!")
+		return
+	}
+}
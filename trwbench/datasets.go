@@ -0,0 +1,143 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trwbench
+
+import (
+	"bytes"
+	"math/rand"
+	"strconv"
+	"time"
+)
+
+// Datasets returns the built-in synthetic corpora, each consisting of one file of approximately
+// the given size: "logs" (application log lines with timestamps, IP addresses, and e-mails),
+// "prose" (English-like text), and "csv" (comma-separated records). The content is generated
+// from a fixed seed, so it is the same on every run and across releases.
+func Datasets(size int) []*Corpus {
+	return []*Corpus{
+		generate("logs", size, genLogLine),
+		generate("prose", size, genSentence),
+		generate("csv", size, genRecord),
+	}
+}
+
+func generate(name string, size int, gen func(*bytes.Buffer, *rand.Rand, int)) *Corpus {
+	var buf bytes.Buffer
+
+	buf.Grow(size + 256)
+
+	rnd := rand.New(rand.NewSource(1))
+
+	for i := 0; buf.Len() < size; i++ {
+		gen(&buf, rnd, i)
+	}
+
+	return &Corpus{
+		Name:  name,
+		Files: []File{{Name: name + ".txt", Data: buf.Bytes()}},
+	}
+}
+
+var words = [...]string{
+	"the", "of", "and", "a", "to", "in", "is", "you", "that", "it", "he", "was", "for", "on", "are",
+	"as", "with", "his", "they", "at", "be", "this", "have", "from", "or", "one", "had", "by",
+	"word", "but", "not", "what", "all", "were", "we", "when", "your", "can", "said", "there",
+	"use", "an", "each", "which", "she", "do", "how", "their", "if", "will", "up", "other",
+	"about", "out", "many", "then", "them", "these", "so", "some", "her", "would", "make",
+	"like", "him", "into", "time", "has", "look", "two", "more", "write", "go", "see", "number",
+}
+
+var levels = [...]string{"DEBUG", "INFO", "INFO", "INFO", "WARN", "ERROR"}
+
+var t0 = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func genLogLine(buf *bytes.Buffer, rnd *rand.Rand, i int) {
+	ts := t0.Add(time.Duration(i) * 1537 * time.Millisecond)
+
+	buf.WriteString(ts.Format("2006-01-02T15:04:05.000Z07:00"))
+	buf.WriteByte(' ')
+	buf.WriteString(levels[rnd.Intn(len(levels))])
+	buf.WriteString(" request from 10.")
+	buf.WriteString(strconv.Itoa(rnd.Intn(256)))
+	buf.WriteByte('.')
+	buf.WriteString(strconv.Itoa(rnd.Intn(256)))
+	buf.WriteByte('.')
+	buf.WriteString(strconv.Itoa(rnd.Intn(256)))
+	buf.WriteString(" user=")
+	buf.WriteString(words[rnd.Intn(len(words))])
+	buf.WriteString(strconv.Itoa(rnd.Intn(1000)))
+	buf.WriteString("@example.com latency=")
+	buf.WriteString(strconv.FormatFloat(rnd.Float64()*100, 'f', 3, 64))
+	buf.WriteString("ms msg=\"")
+	genWords(buf, rnd, 3+rnd.Intn(8))
+	buf.WriteString("\"\n")
+}
+
+func genSentence(buf *bytes.Buffer, rnd *rand.Rand, i int) {
+	start := buf.Len()
+
+	genWords(buf, rnd, 5+rnd.Intn(15))
+
+	if b := buf.Bytes(); b[start] >= 'a' && b[start] <= 'z' {
+		b[start] -= 'a' - 'A'
+	}
+
+	if buf.WriteString(". "); i%7 == 6 {
+		buf.WriteString("\n\n")
+	}
+}
+
+func genRecord(buf *bytes.Buffer, rnd *rand.Rand, i int) {
+	if i == 0 {
+		buf.WriteString("id,name,email,amount,comment\n")
+	}
+
+	name := words[rnd.Intn(len(words))]
+
+	buf.WriteString(strconv.Itoa(i + 1))
+	buf.WriteByte(',')
+	buf.WriteString(name)
+	buf.WriteByte(',')
+	buf.WriteString(name)
+	buf.WriteString("@example.com,")
+	buf.WriteString(strconv.FormatFloat(rnd.Float64()*1000, 'f', 2, 64))
+	buf.WriteString(",\"")
+	genWords(buf, rnd, 2+rnd.Intn(6))
+	buf.WriteString("\"\n")
+}
+
+func genWords(buf *bytes.Buffer, rnd *rand.Rand, n int) {
+	for k := 0; k < n; k++ {
+		if k > 0 {
+			buf.WriteByte(' ')
+		}
+
+		buf.WriteString(words[rnd.Intn(len(words))])
+	}
+}
@@ -0,0 +1,195 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+// Package trwbench provides standardised throughput benchmarks for trw.Rewriter pipelines
+// over realistic text corpora, loaded from a directory or a .tar.gz archive, or generated
+// from the built-in datasets.
+package trwbench
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/maxim2266/trw"
+)
+
+// File is a named piece of text in a corpus.
+type File struct {
+	Name string
+	Data []byte
+}
+
+// Corpus is a named collection of files.
+type Corpus struct {
+	Name  string
+	Files []File
+}
+
+// Size returns the total size of all the files in the corpus, in bytes.
+func (c *Corpus) Size() (n int64) {
+	for i := range c.Files {
+		n += int64(len(c.Files[i].Data))
+	}
+
+	return
+}
+
+// LoadDir loads all regular files from the given directory and its subdirectories. The corpus
+// is named after the directory, and the files are named by their paths relative to the
+// directory, in lexical order.
+func LoadDir(dir string) (*Corpus, error) {
+	c := &Corpus{Name: filepath.Base(dir)}
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+
+		data, err := ioutil.ReadFile(path)
+
+		if err != nil {
+			return err
+		}
+
+		name, err := filepath.Rel(dir, path)
+
+		if err != nil {
+			return err
+		}
+
+		c.Files = append(c.Files, File{Name: filepath.ToSlash(name), Data: data})
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// LoadTarGz loads all regular files from the given .tar.gz archive. The corpus is named after
+// the archive file, without the extension, and the files are sorted by name.
+func LoadTarGz(path string) (*Corpus, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	c, err := ReadTarGz(file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	name := filepath.Base(path)
+
+	for _, ext := range [...]string{".tar.gz", ".tgz"} {
+		if len(name) > len(ext) && name[len(name)-len(ext):] == ext {
+			name = name[:len(name)-len(ext)]
+			break
+		}
+	}
+
+	c.Name = name
+	return c, nil
+}
+
+// ReadTarGz reads all regular files from the given gzip-compressed tar stream. The corpus
+// is not named, and the files are sorted by name.
+func ReadTarGz(r io.Reader) (*Corpus, error) {
+	zr, err := gzip.NewReader(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer zr.Close()
+
+	c := &Corpus{}
+	tr := tar.NewReader(zr)
+
+	for {
+		hdr, err := tr.Next()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		data, err := ioutil.ReadAll(tr)
+
+		if err != nil {
+			return nil, err
+		}
+
+		c.Files = append(c.Files, File{Name: hdr.Name, Data: data})
+	}
+
+	sort.Slice(c.Files, func(i, j int) bool { return c.Files[i].Name < c.Files[j].Name })
+	return c, nil
+}
+
+// Run benchmarks the given Rewriter on the corpus, applying it to every file on each iteration.
+// The throughput is reported in bytes of input per second, along with the allocation statistics.
+// The input files are never modified.
+func Run(b *testing.B, rw trw.Rewriter, c *Corpus) {
+	var buf, spare []byte
+
+	b.SetBytes(c.Size())
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		for i := range c.Files {
+			buf, spare = rw(spare[:0], append(buf[:0], c.Files[i].Data...))
+		}
+	}
+}
+
+// Benchmark runs the benchmark of the given Rewriter on the corpus outside of "go test", and
+// returns the result, as in testing.Benchmark().
+func Benchmark(rw trw.Rewriter, c *Corpus) testing.BenchmarkResult {
+	return testing.Benchmark(func(b *testing.B) { Run(b, rw, c) })
+}
@@ -0,0 +1,187 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trwbench
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/maxim2266/trw"
+)
+
+func TestLoadDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trwbench")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	if err = os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, data := range map[string]string{"b.txt": "bbb", "a.txt": "a", "sub/c.txt": "cc"} {
+		if err = ioutil.WriteFile(filepath.Join(dir, filepath.FromSlash(name)), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c, err := LoadDir(dir)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	checkCorpus(t, c, filepath.Base(dir), "a.txt", "b.txt", "sub/c.txt")
+
+	if c.Size() != 6 {
+		t.Errorf("Unexpected corpus size: %d", c.Size())
+		return
+	}
+
+	if _, err = LoadDir(filepath.Join(dir, "none")); err == nil {
+		t.Error("Missing error")
+		return
+	}
+}
+
+func TestLoadTarGz(t *testing.T) {
+	var buf bytes.Buffer
+
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+
+	for _, f := range []File{{"z.log", []byte("zzz")}, {"dir/", nil}, {"a.log", []byte("a")}} {
+		hdr := &tar.Header{Name: f.Name, Mode: 0644, Size: int64(len(f.Data)), Typeflag: tar.TypeReg}
+
+		if f.Data == nil {
+			hdr.Typeflag = tar.TypeDir
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := tw.Write(f.Data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "trwbench")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "logs.tar.gz")
+
+	if err = ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := LoadTarGz(path)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	checkCorpus(t, c, "logs", "a.log", "z.log")
+
+	if _, err = ReadTarGz(bytes.NewReader([]byte("not gzip"))); err == nil {
+		t.Error("Missing error")
+		return
+	}
+}
+
+func TestDatasets(t *testing.T) {
+	a, b := Datasets(10000), Datasets(10000)
+
+	if len(a) != 3 {
+		t.Errorf("Unexpected number of datasets: %d", len(a))
+		return
+	}
+
+	for i, c := range a {
+		if c.Size() < 10000 || c.Size() > 10500 {
+			t.Errorf("[%d] Unexpected size of %q: %d", i, c.Name, c.Size())
+			return
+		}
+
+		if !bytes.Equal(c.Files[0].Data, b[i].Files[0].Data) {
+			t.Errorf("[%d] Non-deterministic dataset %q", i, c.Name)
+			return
+		}
+	}
+}
+
+func BenchmarkDatasets(b *testing.B) {
+	rw := trw.Seq(
+		trw.Replace(trw.IPs(), "x.x.x.x"),
+		trw.Replace(trw.Patt(`[a-z0-9]+@example\.com`), "[EMAIL]"),
+	)
+
+	for _, c := range Datasets(1 << 20) {
+		c := c
+
+		b.Run(c.Name, func(b *testing.B) { Run(b, rw, c) })
+	}
+}
+
+func checkCorpus(t *testing.T, c *Corpus, name string, files ...string) {
+	t.Helper()
+
+	if c.Name != name || len(c.Files) != len(files) {
+		t.Fatalf("Unexpected corpus: %q, %d files", c.Name, len(c.Files))
+	}
+
+	for i, f := range c.Files {
+		if f.Name != files[i] {
+			t.Fatalf("[%d] Unexpected file name: %q instead of %q", i, f.Name, files[i])
+		}
+	}
+}
@@ -0,0 +1,268 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalize creates a Rewriter that converts its input to the given Unicode normalization
+// form (norm.NFC, norm.NFD, norm.NFKC, or norm.NFKD). Input that is already in the requested
+// form is passed through without copying.
+func Normalize(form norm.Form) Rewriter {
+	return func(dest, src []byte) ([]byte, []byte) {
+		if form.IsNormal(src) {
+			return src, dest
+		}
+
+		// (speculatively) reallocate destination slice
+		if len(src) > cap(dest) {
+			dest = make([]byte, 0, len(src)+len(src)/5) // +20%
+		}
+
+		return form.Append(dest[:0], src...), src
+	}
+}
+
+// StripDiacritics creates a Rewriter that removes diacritical marks from the input text,
+// converting accented letters to their base forms ("é" to "e", "ü" to "u"). Letters with
+// stroke that have no Unicode decomposition ("ø", "ł", "đ") are converted as well. Only the marks
+// on Latin, Greek, and Cyrillic letters are removed: in other scripts, like Devanagari or Japanese
+// kana, nonspacing marks are not diacritics, but essential parts of the letters, so they are kept
+// ("が" stays intact). The result is in Unicode normalization form NFC.
+func StripDiacritics() Rewriter {
+	return func(dest, src []byte) ([]byte, []byte) {
+		i := 0
+
+		for i < len(src) && src[i] < utf8.RuneSelf {
+			i++
+		}
+
+		if i == len(src) {
+			return src, dest
+		}
+
+		// the last ASCII letter may be the base for the following marks
+		if i > 0 {
+			i--
+		}
+
+		// (speculatively) reallocate destination slice
+		if len(src) > cap(dest) {
+			dest = make([]byte, 0, len(src)+len(src)/5) // +20%
+		}
+
+		dest = append(dest[:0], src[:i]...)
+
+		var it norm.Iter
+		var seg []byte
+
+		for it.Init(norm.NFD, src[i:]); !it.Done(); {
+			s := it.Next()
+
+			if len(s) == 1 && s[0] < utf8.RuneSelf {
+				dest = append(dest, s[0])
+				continue
+			}
+
+			// base letter of the segment
+			if r, _ := utf8.DecodeRune(s); !unicode.In(r, unicode.Latin, unicode.Greek, unicode.Cyrillic) {
+				dest = norm.NFC.Append(dest, s...)
+				continue
+			}
+
+			seg = seg[:0]
+
+			for len(s) > 0 {
+				r, n := utf8.DecodeRune(s)
+
+				if !unicode.Is(unicode.Mn, r) {
+					if b, ok := strokes[r]; ok {
+						seg = append(seg, b)
+					} else {
+						seg = append(seg, s[:n]...)
+					}
+				}
+
+				s = s[n:]
+			}
+
+			dest = norm.NFC.Append(dest, seg...)
+		}
+
+		return dest, src
+	}
+}
+
+// letters with stroke, and their base forms
+var strokes = map[rune]byte{
+	'ø': 'o', 'Ø': 'O', 'ł': 'l', 'Ł': 'L', 'đ': 'd', 'Đ': 'D', 'ħ': 'h', 'Ħ': 'H', 'ŧ': 't', 'Ŧ': 'T',
+}
+
+// Runes creates a Matcher for maximal runs of runes satisfying the given predicate. Invalid UTF-8
+// bytes are passed to the predicate as utf8.RuneError, one byte at a time.
+func Runes(f func(rune) bool) Matcher {
+	if f == nil {
+		panic("nil predicate in trw.Runes() function")
+	}
+
+	return func(s []byte) (ms [][]int) {
+		start := -1
+
+		for i := 0; i < len(s); {
+			r, n := rune(s[i]), 1
+
+			if r >= utf8.RuneSelf {
+				r, n = utf8.DecodeRune(s[i:])
+			}
+
+			switch ok := f(r); {
+			case ok && start < 0:
+				start = i
+			case !ok && start >= 0:
+				ms = append(ms, []int{start, i})
+				start = -1
+			}
+
+			i += n
+		}
+
+		if start >= 0 {
+			ms = append(ms, []int{start, len(s)})
+		}
+
+		return
+	}
+}
+
+// RunesIn creates a Matcher for maximal runs of runes from any of the given Unicode range tables,
+// as in unicode.In(). For example, RunesIn(unicode.White_Space) matches runs of white space.
+func RunesIn(tables ...*unicode.RangeTable) Matcher {
+	if len(tables) == 0 {
+		panic("empty table list in trw.RunesIn() function")
+	}
+
+	if len(tables) == 1 {
+		table := tables[0]
+
+		return Runes(func(r rune) bool { return unicode.Is(table, r) })
+	}
+
+	return Runes(func(r rune) bool { return unicode.In(r, tables...) })
+}
+
+// StripBOM creates a Rewriter that removes the UTF-8 byte order mark from the beginning
+// of its input, if present. The rewriting is done in place.
+func StripBOM() Rewriter {
+	return func(dest, src []byte) ([]byte, []byte) {
+		if hasPrefix(src, utf8BOM) {
+			src = src[:copy(src, src[len(utf8BOM):])]
+		}
+
+		return src, dest
+	}
+}
+
+// DecodeBOM creates a Rewriter that detects the byte order mark at the beginning of its input,
+// and converts UTF-16LE and UTF-16BE text to UTF-8, removing the byte order mark. For UTF-8
+// input, the byte order mark is removed, as in StripBOM(), and input without a byte order
+// mark is passed through unchanged. The Rewriter is meant to be the first stage of a pipeline
+// that may be fed with UTF-16 text, like exports from Windows tools. Unpaired surrogates,
+// as well as a trailing odd byte, are converted to U+FFFD.
+func DecodeBOM() Rewriter {
+	return func(dest, src []byte) ([]byte, []byte) {
+		switch {
+		case hasPrefix(src, utf16LE):
+			return decodeUTF16(dest, src[2:], false), src
+		case hasPrefix(src, utf16BE):
+			return decodeUTF16(dest, src[2:], true), src
+		default:
+			return StripBOM()(dest, src)
+		}
+	}
+}
+
+// byte order marks
+const (
+	utf8BOM = "\xEF\xBB\xBF"
+	utf16LE = "\xFF\xFE"
+	utf16BE = "\xFE\xFF"
+)
+
+func hasPrefix(s []byte, prefix string) bool {
+	return len(s) >= len(prefix) && string(s[:len(prefix)]) == prefix
+}
+
+// decodeUTF16 converts the given UTF-16 text to UTF-8, appending the result to dest[:0].
+func decodeUTF16(dest, src []byte, bigEndian bool) []byte {
+	// (speculatively) reallocate destination slice
+	if n := len(src) / 2 * 3; n > cap(dest) {
+		dest = make([]byte, 0, n)
+	}
+
+	dest = dest[:0]
+
+	unit := func(i int) rune {
+		if bigEndian {
+			return rune(src[i])<<8 | rune(src[i+1])
+		}
+
+		return rune(src[i+1])<<8 | rune(src[i])
+	}
+
+	for i := 0; i+1 < len(src); i += 2 {
+		r := unit(i)
+
+		switch {
+		case r < utf8.RuneSelf:
+			dest = append(dest, byte(r))
+			continue
+		case utf16.IsSurrogate(r):
+			if i+3 < len(src) {
+				if r = utf16.DecodeRune(r, unit(i+2)); r != utf8.RuneError {
+					i += 2
+				}
+			} else {
+				r = utf8.RuneError
+			}
+		}
+
+		dest = appendRune(dest, r)
+	}
+
+	if len(src)%2 != 0 {
+		dest = appendRune(dest, utf8.RuneError)
+	}
+
+	return dest
+}
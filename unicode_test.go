@@ -0,0 +1,155 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"bytes"
+	"testing"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+func TestNormalize(t *testing.T) {
+	cases := []struct {
+		form     norm.Form
+		src, exp string
+	}{
+		{norm.NFC, "Cafe\u0301 cafe\u0301", "Caf\u00e9 caf\u00e9"},
+		{norm.NFD, "Caf\u00e9", "Cafe\u0301"},
+		{norm.NFKC, "\ufb01le \u2460", "file 1"},
+		{norm.NFKD, "\u00c5\ufb01", "A\u030afi"},
+		{norm.NFC, "plain ASCII", "plain ASCII"},
+		{norm.NFC, "", ""},
+	}
+
+	for i, c := range cases {
+		if res := Normalize(c.form).Do([]byte(c.src)); !bytes.Equal(res, []byte(c.exp)) {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+	}
+
+	// in a sequence, with buffer reuse
+	rw := Seq(Normalize(norm.NFD), Normalize(norm.NFC), Normalize(norm.NFD))
+
+	if res := rw.Do([]byte("\u00e9t\u00e9")); string(res) != "e\u0301te\u0301" {
+		t.Errorf("Unexpected result: %q", string(res))
+		return
+	}
+}
+
+func TestStripDiacritics(t *testing.T) {
+	cases := []struct {
+		src, exp string
+	}{
+		{"", ""},
+		{"plain ASCII", "plain ASCII"},
+		{"Caf\u00e9 cr\u00e8me br\u00fbl\u00e9e, \u00fcber", "Cafe creme brulee, uber"},
+		{"Cafe\u0301 \u00c5ngstr\u00f6m", "Cafe Angstrom"},
+		{"K\u00f8benhavn, \u0141\u00f3d\u017a", "Kobenhavn, Lodz"},
+		{"\u1e9b\u0323 \u0390", "\u017f \u03b9"},
+		{"\ud55c\uae00 \u65e5\u672c\u8a9e", "\ud55c\uae00 \u65e5\u672c\u8a9e"},
+		{"na\u00efve\xff", "naive\xff"},
+		{"\u0439\u043e\u0301\u0433\u0430", "\u0438\u043e\u0433\u0430"},
+		{"\u304c\u304b\u3099 \u30d1", "\u304c\u304c \u30d1"},
+		{"\u0915\u094d\u0937 \u0915\u0941", "\u0915\u094d\u0937 \u0915\u0941"},
+		{"\u0301a", "\u0301a"},
+	}
+
+	for i, c := range cases {
+		if res := StripDiacritics().Do([]byte(c.src)); !bytes.Equal(res, []byte(c.exp)) {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+	}
+}
+
+func TestRunes(t *testing.T) {
+	cases := []struct {
+		match    Matcher
+		src, exp string
+	}{
+		{RunesIn(unicode.White_Space), " a \t\u00a0b\u2003\n", "_a_b_"},
+		{RunesIn(unicode.Han, unicode.Hiragana), "x\u65e5\u672c\u3054y\u8a9e", "x_y_"},
+		{RunesIn(unicode.Digit), "abc", "abc"},
+		{Runes(unicode.IsUpper), "ABcDÉf", "_c_f"},
+		{Runes(func(r rune) bool { return r == utf8.RuneError }), "a\xff\xfeb\xef\xbf\xbd", "a_b_"},
+		{Runes(unicode.IsLetter), "", ""},
+	}
+
+	for i, c := range cases {
+		if res := Replace(c.match, "_").Do([]byte(c.src)); !bytes.Equal(res, []byte(c.exp)) {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+	}
+}
+
+func BenchmarkRunes(b *testing.B) {
+	benchSpaces(b, Replace(RunesIn(unicode.White_Space), " ").Do)
+}
+
+func BenchmarkRunesRegex(b *testing.B) {
+	benchSpaces(b, Replace(Patt(`[[:space:]]+`), " ").Do)
+}
+
+func TestBOM(t *testing.T) {
+	cases := []struct {
+		rw       Rewriter
+		src, exp string
+	}{
+		{StripBOM(), "\xEF\xBB\xBFabc", "abc"},
+		{StripBOM(), "abc\xEF\xBB\xBF", "abc\xEF\xBB\xBF"},
+		{StripBOM(), "\xFF\xFEa\x00", "\xFF\xFEa\x00"},
+		{DecodeBOM(), "\xEF\xBB\xBFabc", "abc"},
+		{DecodeBOM(), "abc", "abc"},
+		{DecodeBOM(), "\xFF\xFEa\x00\xE9\x00\x3D\xD8\x00\xDE\n\x00", "aé😀\n"},
+		{DecodeBOM(), "\xFE\xFF\x00a\x00\xE9\xD8\x3D\xDE\x00\x00\n", "aé😀\n"},
+		{DecodeBOM(), "\xFF\xFE\x3D\xD8a\x00\x3D\xD8", "\uFFFDa\uFFFD"},
+		{DecodeBOM(), "\xFF\xFEa\x00b", "a\uFFFD"},
+		{DecodeBOM(), "\xFF\xFE", ""},
+	}
+
+	for i, c := range cases {
+		if res := c.rw.Do([]byte(c.src)); !bytes.Equal(res, []byte(c.exp)) {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+	}
+
+	// as the first stage of a pipeline
+	rw := Seq(DecodeBOM(), Replace(Lit("\r\n"), "\n"))
+
+	if res := rw.Do([]byte("\xFF\xFEa\x00\r\x00\n\x00")); string(res) != "a\n" {
+		t.Errorf("Unexpected result: %q", string(res))
+		return
+	}
+}
@@ -0,0 +1,135 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"bytes"
+	"net/url"
+)
+
+// URLs creates a Matcher for absolute URLs, like "https://example.com/a?b=c#d". A URL is
+// terminated by whitespace, quotes, angle brackets, or the end of the input; trailing punctuation
+// (as at the end of a sentence) and unbalanced closing parentheses are not included in the match.
+func URLs() Matcher {
+	return func(s []byte) (ms [][]int) {
+		for i := 0; i < len(s); {
+			k := bytes.Index(s[i:], []byte("://"))
+
+			if k < 0 {
+				break
+			}
+
+			k += i
+
+			// scheme
+			j := k
+
+			for j > i && isSchemeChar(s[j-1]) {
+				j--
+			}
+
+			for j < k && !isAlpha(s[j]) {
+				j++
+			}
+
+			if j == k || (j > 0 && isAlnum(s[j-1])) {
+				i = k + 3
+				continue
+			}
+
+			// the rest of the URL
+			if end := urlEnd(s, k+3); end > k+3 {
+				ms = append(ms, []int{j, end})
+				i = end
+			} else {
+				i = k + 3
+			}
+		}
+
+		return
+	}
+}
+
+// RewriteURLs creates a Rewriter that passes every URL matched by URLs() to the given function,
+// and substitutes the URL with the one returned, for example, to strip tracking parameters.
+// The function may modify and return its argument. URLs that cannot be parsed, and those for
+// which the function returns nil, are left intact.
+func RewriteURLs(fn func(*url.URL) *url.URL) Rewriter {
+	if fn == nil {
+		panic("nil function in trw.RewriteURLs() function")
+	}
+
+	return rewrite(URLs(), func(dest, src []byte, m []int) []byte {
+		raw := src[m[0]:m[1]]
+
+		if u, err := url.Parse(string(raw)); err == nil {
+			if u = fn(u); u != nil {
+				return append(dest, u.String()...)
+			}
+		}
+
+		return append(dest, raw...)
+	})
+}
+
+// urlEnd returns the end index of the URL whose part after the scheme starts at s[i].
+func urlEnd(s []byte, i int) int {
+	end, depth := i, 0
+
+	for ; i < len(s) && isURLChar(s[i]); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				return end
+			}
+
+			depth--
+		case '.', ',', ';', ':', '!', '?':
+			continue
+		}
+
+		end = i + 1
+	}
+
+	return end
+}
+
+func isURLChar(c byte) bool {
+	return c > ' ' && c < 0x7F && c != '"' && c != '\'' && c != '<' && c != '>' && c != '`'
+}
+
+func isSchemeChar(c byte) bool {
+	return isAlnum(c) || c == '+' || c == '-' || c == '.'
+}
+
+func isAlpha(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -0,0 +1,96 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestURLs(t *testing.T) {
+	cases := []struct {
+		src, exp string
+	}{
+		{"", ""},
+		{"no urls://", "no urls://"},
+		{"see https://example.com/a?b=c#d.", "see <https://example.com/a?b=c#d>."},
+		{"(http://x.org/a), ftp://y.org:21/f!", "(<http://x.org/a>), <ftp://y.org:21/f>!"},
+		{"https://en.wikipedia.org/wiki/Go_(language) x", "<https://en.wikipedia.org/wiki/Go_(language)> x"},
+		{`<a href="http://x.org/">x</a>`, `<a href="<http://x.org/>">x</a>`},
+		{"+git+ssh://host/repo 1http://foo ://bar", "+<git+ssh://host/repo> 1http://foo ://bar"},
+	}
+
+	rw := rewrite(URLs(), func(dest, src []byte, m []int) []byte {
+		return append(append(append(dest, '<'), src[m[0]:m[1]]...), '>')
+	})
+
+	for i, c := range cases {
+		if res := rw.Do([]byte(c.src)); !bytes.Equal(res, []byte(c.exp)) {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+	}
+}
+
+func TestRewriteURLs(t *testing.T) {
+	rw := RewriteURLs(func(u *url.URL) *url.URL {
+		if u.Host == "old.example.com" {
+			u.Host = "new.example.com"
+		}
+
+		q := u.Query()
+
+		for key := range q {
+			if strings.HasPrefix(key, "utm_") {
+				q.Del(key)
+			}
+		}
+
+		u.RawQuery = q.Encode()
+		return u
+	})
+
+	cases := []struct {
+		src, exp string
+	}{
+		{"", ""},
+		{"go to https://example.com/a?id=1&utm_source=x.", "go to https://example.com/a?id=1."},
+		{"http://old.example.com/?utm_medium=y#top", "http://new.example.com/#top"},
+		{"bad http://[::1/ url", "bad http://[::1/ url"},
+	}
+
+	for i, c := range cases {
+		if res := rw.Do([]byte(c.src)); !bytes.Equal(res, []byte(c.exp)) {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+	}
+}
@@ -0,0 +1,240 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// WrapLines creates a Rewriter that reflows every paragraph of the text, so that no line is longer
+// than the given number of characters, like fmt(1) does. Paragraphs are separated by blank lines,
+// which are kept as they are. Lines are only broken at spaces and tabs, never at hyphens, and
+// words longer than the width are put on separate lines. The indentation of the first line of
+// a paragraph is applied to all its lines, and the line terminator ("\n" or "\r\n") of the first
+// line is used for all the inserted line breaks.
+func WrapLines(width int) Rewriter {
+	if width <= 0 {
+		panic("non-positive width in trw.WrapLines() function")
+	}
+
+	return reflow(width)
+}
+
+// UnwrapParagraphs creates a Rewriter that joins the hard-wrapped lines of every paragraph of
+// the text into a single line, with words separated by single spaces. Paragraphs are separated
+// by blank lines, which are kept as they are. The indentation of the first line of a paragraph
+// is preserved. This is the reverse of WrapLines() for most text.
+func UnwrapParagraphs() Rewriter {
+	return reflow(0)
+}
+
+// Truncate creates a Rewriter that shortens the text longer than the given number of characters
+// to that many characters, including the ellipsis appended to the result, as in Truncate(100, "…").
+// The text is only cut at a rune boundary, and the shorter text is passed through unchanged.
+// The ellipsis may be empty.
+func Truncate(n int, ellipsis string) Rewriter {
+	return truncate(n, ellipsis, false, "Truncate")
+}
+
+// TruncateWords creates a Rewriter that works like Truncate(), but cuts the text at a word boundary,
+// where possible, removing the whitespace before the ellipsis. If there is no whitespace within
+// the first n characters of the text, it is cut at a rune boundary.
+func TruncateWords(n int, ellipsis string) Rewriter {
+	return truncate(n, ellipsis, true, "TruncateWords")
+}
+
+func truncate(n int, ellipsis string, words bool, fn string) Rewriter {
+	if n <= utf8.RuneCountInString(ellipsis) {
+		panic("invalid length in trw." + fn + "() function")
+	}
+
+	e := utf8.RuneCountInString(ellipsis)
+	n -= e
+
+	return func(dest, src []byte) ([]byte, []byte) {
+		// cut point
+		cut := 0
+
+		for k := 0; k < n && cut < len(src); k++ {
+			cut += runeLen(src[cut:])
+		}
+
+		// the text is not changed if the rest of it is not longer than the ellipsis
+		end, k := cut, 0
+
+		for ; k <= e && end < len(src); k++ {
+			end += runeLen(src[end:])
+		}
+
+		if end == len(src) && k <= e {
+			return src, dest
+		}
+
+		if words {
+			cut = wordCut(src, cut)
+		}
+
+		// in-place, if the ellipsis fits
+		if cut+len(ellipsis) <= len(src) {
+			return append(src[:cut], ellipsis...), dest
+		}
+
+		return append(append(dest[:0], src[:cut]...), ellipsis...), src
+	}
+}
+
+// wordCut returns the cut point in s at or before the given index, trimmed to the end of the last
+// word, or the index itself, if there is no whitespace before it.
+func wordCut(s []byte, cut int) int {
+	if r, _ := utf8.DecodeRune(s[cut:]); unicode.IsSpace(r) {
+		return trimSpaceEnd(s, cut)
+	}
+
+	for i := cut; i > 0; {
+		r, n := utf8.DecodeLastRune(s[:i])
+
+		if i -= n; unicode.IsSpace(r) {
+			if end := trimSpaceEnd(s, i); end > 0 {
+				return end
+			}
+
+			break
+		}
+	}
+
+	return cut
+}
+
+// trimSpaceEnd returns the index of the end of s[:i] with the trailing whitespace removed.
+func trimSpaceEnd(s []byte, i int) int {
+	for i > 0 {
+		r, n := utf8.DecodeLastRune(s[:i])
+
+		if !unicode.IsSpace(r) {
+			break
+		}
+
+		i -= n
+	}
+
+	return i
+}
+
+// reflow creates a Rewriter that reflows paragraphs to the given width, or joins them into single
+// lines, if the width is 0.
+func reflow(width int) Rewriter {
+	return func(dest, src []byte) ([]byte, []byte) {
+		if cap(dest) < len(src)+len(src)/5 {
+			dest = make([]byte, 0, len(src)+len(src)/5) // +20%
+		}
+
+		dest = dest[:0]
+
+		for i := 0; i < len(src); {
+			if end, next := nextLine(src, i); trimLineEnd(src, i, end) == skipSpaces(src, i) {
+				// blank line
+				dest = append(dest, src[i:next]...)
+				i = next
+				continue
+			}
+
+			dest, i = reflowParagraph(dest, src, i, width)
+		}
+
+		return dest, src
+	}
+}
+
+// reflowParagraph appends to the destination slice the paragraph starting at s[i], reflowed
+// to the given width, and returns the resulting slice together with the index of the first byte
+// after the paragraph.
+func reflowParagraph(dest, s []byte, i, width int) ([]byte, int) {
+	// indentation and line terminator of the first line
+	indent := s[i:skipSpaces(s, i)]
+	eol := "\n"
+
+	if end, _ := nextLine(s, i); end > i && end < len(s) && s[end-1] == '\r' {
+		eol = "\r\n"
+	}
+
+	dest = append(dest, indent...)
+	base := utf8.RuneCount(indent)
+	col := base
+	first := true
+	last := "" // line terminator of the last line of the paragraph
+
+	for i < len(s) {
+		end, next := nextLine(s, i)
+		stop := trimLineEnd(s, i, end)
+
+		if stop == skipSpaces(s, i) {
+			break // blank line
+		}
+
+		// words
+		for j := skipSpaces(s, i); j < stop; j = skipSpaces(s, j) {
+			k := j
+
+			for k < stop && s[k] != ' ' && s[k] != '\t' {
+				k++
+			}
+
+			w := utf8.RuneCount(s[j:k])
+
+			if !first {
+				if width > 0 && col+1+w > width {
+					dest = append(append(dest, eol...), indent...)
+					col = base
+				} else {
+					dest = append(dest, ' ')
+					col++
+				}
+			}
+
+			dest = append(dest, s[j:k]...)
+			col += w
+			first = false
+			j = k
+		}
+
+		switch {
+		case next == end:
+			last = ""
+		case end > i && s[end-1] == '\r':
+			last = "\r\n"
+		default:
+			last = "\n"
+		}
+
+		i = next
+	}
+
+	return append(dest, last...), i
+}
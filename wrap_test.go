@@ -0,0 +1,97 @@
+/*
+Copyright (c) 2019,2020 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package trw
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWrapLines(t *testing.T) {
+	cases := []struct {
+		src, wrapped, unwrapped string
+	}{
+		{"", "", ""},
+		{"\n \n", "\n \n", "\n \n"},
+		{"one", "one", "one"},
+		{
+			"The quick brown fox jumps over the lazy dog.\n",
+			"The quick\nbrown fox\njumps over\nthe lazy\ndog.\n",
+			"The quick brown fox jumps over the lazy dog.\n",
+		},
+		{
+			"  well-known  text\n  re-\nflow\n\n\nsecond paragraph here",
+			"  well-known\n  text re-\n  flow\n\n\nsecond\nparagraph\nhere",
+			"  well-known text re- flow\n\n\nsecond paragraph here",
+		},
+		{
+			"a verylongwordhere b\r\nc\r\n\r\nпривет мир всем",
+			"a\r\nverylongwordhere\r\nb c\r\n\r\nпривет мир\nвсем",
+			"a verylongwordhere b c\r\n\r\nпривет мир всем",
+		},
+	}
+
+	for i, c := range cases {
+		if res := WrapLines(10).Do([]byte(c.src)); !bytes.Equal(res, []byte(c.wrapped)) {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.wrapped)
+			return
+		}
+
+		if res := UnwrapParagraphs().Do([]byte(c.src)); !bytes.Equal(res, []byte(c.unwrapped)) {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.unwrapped)
+			return
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	cases := []struct {
+		rw       Rewriter
+		src, exp string
+	}{
+		{Truncate(5, "…"), "", ""},
+		{Truncate(5, "…"), "hello", "hello"},
+		{Truncate(5, "…"), "hello!", "hell…"},
+		{Truncate(5, ""), "hello!", "hello"},
+		{Truncate(6, "..."), "привет, мир", "при..."},
+		{Truncate(3, "…"), "a€€€", "a€…"},
+		{TruncateWords(12, "…"), "The quick brown fox", "The quick…"},
+		{TruncateWords(10, "…"), "The quick brown fox", "The quick…"},
+		{TruncateWords(9, "…"), "The quick brown fox", "The…"},
+		{TruncateWords(8, "..."), "Supercalifragilistic", "Super..."},
+		{TruncateWords(20, "…"), "The quick brown fox", "The quick brown fox"},
+	}
+
+	for i, c := range cases {
+		if res := c.rw.Do([]byte(c.src)); !bytes.Equal(res, []byte(c.exp)) {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, string(res), c.exp)
+			return
+		}
+	}
+}